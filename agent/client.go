@@ -12,6 +12,8 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
@@ -126,13 +128,30 @@ type Client struct {
 	network string
 	address string
 	dialer  net.Dialer
+
+	// dial, when set, connects to the agent in place of dialing its address.
+	dial func(context.Context) (net.Conn, error)
+
+	mu           sync.Mutex
+	negotiated   bool
+	capabilities []string // nil when the agent only speaks the legacy protocol
+	requests     uint64
 }
 
 var errDone = errors.New("done")
 
+// connect opens a connection to the agent.
+func (c *Client) connect(ctx context.Context) (net.Conn, error) {
+	if c.dial != nil {
+		return c.dial(ctx)
+	}
+
+	return c.dialContext(ctx)
+}
+
 func (c *Client) do(parent context.Context, fn func(net.Conn) error) (err error) {
 	var conn net.Conn
-	if conn, err = c.dialContext(parent); err != nil {
+	if conn, err = c.connect(parent); err != nil {
 		return err
 	}
 
@@ -163,9 +182,157 @@ func (c *Client) do(parent context.Context, fn func(net.Conn) error) (err error)
 	return
 }
 
+// HelloResponse is the agent's side of the negotiation of the structured
+// protocol.
+type HelloResponse struct {
+	ProtocolVersion    int
+	MinProtocolVersion int
+	Version            semver.Version
+	Capabilities       []string
+}
+
+// negotiate finds out, once per client, whether the agent speaks the
+// structured protocol and which methods it supports. Agents predating it
+// answer the hello request with a legacy error, in which case the client
+// falls back to the legacy protocol.
+func (c *Client) negotiate(ctx context.Context) (structured bool, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.negotiated {
+		return c.capabilities != nil, nil
+	}
+
+	var res HelloResponse
+	err = c.do(ctx, func(conn net.Conn) error {
+		id, err := c.send(conn, true, "hello")
+		if err != nil {
+			return err
+		}
+
+		data, err := proto.Read(conn)
+		switch {
+		case err != nil:
+			return err
+		case !proto.IsStructured(data):
+			return nil // legacy agent
+		default:
+			return decodeResponse(data, id, &res)
+		}
+	})
+	if err != nil {
+		return false, err
+	}
+
+	if res.MinProtocolVersion <= proto.Version && res.Capabilities != nil {
+		c.capabilities = res.Capabilities
+	}
+	c.negotiated = true
+
+	return c.capabilities != nil, nil
+}
+
+// Capabilities returns the methods the agent supports over the structured
+// protocol, or nil if it only speaks the legacy protocol.
+func (c *Client) Capabilities(ctx context.Context) ([]string, error) {
+	if _, err := c.negotiate(ctx); err != nil {
+		return nil, err
+	}
+
+	return c.capabilities, nil
+}
+
+// call sends a request for method to the agent and decodes its result into
+// res, which may be nil.
+func (c *Client) call(ctx context.Context, method string, res interface{}, args ...string) error {
+	structured, err := c.negotiate(ctx)
+	if err != nil {
+		return err
+	}
+
+	return c.do(ctx, func(conn net.Conn) error {
+		id, err := c.send(conn, structured, method, args...)
+		if err != nil {
+			return err
+		}
+
+		return c.receive(conn, id, res)
+	})
+}
+
+// send writes a request for method to conn and returns its ID, which is
+// empty over the legacy protocol.
+func (c *Client) send(conn net.Conn, structured bool, method string, args ...string) (string, error) {
+	if !structured {
+		return "", proto.Write(conn, method, args...)
+	}
+
+	id := strconv.FormatUint(atomic.AddUint64(&c.requests, 1), 10)
+
+	return id, proto.WriteJSON(conn, proto.Request{
+		ID:      id,
+		Version: proto.Version,
+		Method:  method,
+		Args:    args,
+	})
+}
+
+// receive reads the response to the request with the given ID from conn and
+// decodes its result into res, which may be nil.
+func (c *Client) receive(conn net.Conn, id string, res interface{}) error {
+	data, err := proto.Read(conn)
+	if err != nil {
+		return err
+	}
+
+	if proto.IsStructured(data) {
+		return decodeResponse(data, id, res)
+	}
+
+	switch {
+	default:
+		return errInvalidResponse(data)
+	case string(data) == "ok":
+		return nil
+	case isOK(data):
+		if res == nil {
+			return nil
+		}
+		return unmarshal(res, extractOK(data))
+	case isError(data):
+		return extractError(data)
+	}
+}
+
+func decodeResponse(data []byte, id string, res interface{}) error {
+	var r proto.Response
+	if err := json.Unmarshal(data, &r); err != nil || r.ID != id {
+		return errInvalidResponse(data)
+	}
+
+	switch {
+	case r.Error != nil:
+		return &Error{Code: r.Error.Code, Message: r.Error.Message}
+	case res == nil, len(r.Result) == 0:
+		return nil
+	}
+
+	if err := json.Unmarshal(r.Result, res); err != nil {
+		return fmt.Errorf("failed decoding response: %w", err)
+	}
+
+	return nil
+}
+
 func (c *Client) Kill(ctx context.Context) error {
+	structured, err := c.negotiate(ctx)
+	if err != nil {
+		return err
+	}
+
 	return c.do(ctx, func(conn net.Conn) error {
-		return proto.Write(conn, "kill")
+		_, err := c.send(conn, structured, "kill")
+		return err
 	})
 }
 
@@ -182,24 +349,7 @@ func (err errInvalidResponse) Error() string {
 }
 
 func (c *Client) Ping(ctx context.Context) (res PingResponse, err error) {
-	err = c.do(ctx, func(conn net.Conn) (err error) {
-		if err = proto.Write(conn, "ping"); err != nil {
-			return
-		}
-
-		var data []byte
-		if data, err = proto.Read(conn); err != nil {
-			return
-		}
-
-		if isOK(data) {
-			err = unmarshal(&res, data)
-		} else {
-			err = errInvalidResponse(data)
-		}
-
-		return
-	})
+	err = c.call(ctx, "ping", &res)
 
 	return
 }
@@ -230,44 +380,84 @@ func isPrefixedWith(data []byte, prefix string) bool {
 	return strings.HasPrefix(string(data), prefix)
 }
 
+// StatusResponse describes what the agent is doing.
+type StatusResponse struct {
+	PID        int
+	Version    semver.Version
+	Background bool
+	StartedAt  time.Time
+
+	// Sessions counts the connections to the agent currently open;
+	// TotalSessions counts all of them since the agent started.
+	Sessions      int64
+	TotalSessions uint64
+
+	Tunnels []TunnelStatus
+}
+
+// TunnelStatus describes the tunnel the agent keeps to an organization.
+type TunnelStatus struct {
+	Org           string
+	State         string
+	Peer          string
+	Region        string
+	EstablishedAt time.Time
+
+	// Fallback reports whether the agent failed over to a fallback peer.
+	// Failovers counts failovers to other endpoints and peers, and
+	// HandshakeLatency is how long the last handshake the agent measured
+	// took.
+	Fallback         bool
+	Failovers        uint64
+	HandshakeLatency time.Duration
+
+	// Connections counts the connections currently proxied through the
+	// tunnel and TotalConnections all of them since it was established.
+	// BytesSent and BytesReceived count the bytes proxied over them.
+	Connections      int64
+	TotalConnections uint64
+	BytesSent        uint64
+	BytesReceived    uint64
+
+	// Endpoint, LastHandshake, RxBytes and TxBytes are the statistics of
+	// the WireGuard peer.
+	Endpoint      string
+	LastHandshake time.Time
+	RxBytes       uint64
+	TxBytes       uint64
+}
+
+// Tunnel states reported by the agent.
+const (
+	TunnelUp         = "up"
+	TunnelConnecting = "connecting"
+	TunnelStale      = "stale"
+)
+
+func (c *Client) Status(ctx context.Context) (res StatusResponse, err error) {
+	err = c.call(ctx, "status", &res)
+
+	return
+}
+
 type EstablishResponse struct {
 	WireGuardState *wg.WireGuardState
 	TunnelConfig   *wg.Config
 }
 
-func (c *Client) doEstablish(ctx context.Context, slug string, recycle bool) (res *EstablishResponse, err error) {
-	err = c.do(ctx, func(conn net.Conn) (err error) {
-		verb := "establish"
-		if recycle {
-			verb = "reestablish"
-		}
-
-		if err = proto.Write(conn, verb, slug); err != nil {
-			return
-		}
-
-		// this goes out to the API; don't time it out aggressively
-		var data []byte
-		if data, err = proto.Read(conn); err != nil {
-			return
-		}
-
-		switch {
-		default:
-			err = errInvalidResponse(data)
-		case isOK(data):
-			res = &EstablishResponse{}
-			if err = unmarshal(res, data); err != nil {
-				res = nil
-			}
-		case isError(data):
-			err = extractError(data)
-		}
+func (c *Client) doEstablish(ctx context.Context, slug string, recycle bool) (*EstablishResponse, error) {
+	verb := "establish"
+	if recycle {
+		verb = "reestablish"
+	}
 
-		return
-	})
+	// this goes out to the API; don't time it out aggressively
+	res := &EstablishResponse{}
+	if err := c.call(ctx, verb, res, slug); err != nil {
+		return nil, err
+	}
 
-	return
+	return res, nil
 }
 
 func (c *Client) Establish(ctx context.Context, slug string) (res *EstablishResponse, err error) {
@@ -279,53 +469,13 @@ func (c *Client) Reestablish(ctx context.Context, slug string) (res *EstablishRe
 }
 
 func (c *Client) Probe(ctx context.Context, slug string) error {
-	return c.do(ctx, func(conn net.Conn) (err error) {
-		if err = proto.Write(conn, "probe", slug); err != nil {
-			return
-		}
-
-		var data []byte
-		if data, err = proto.Read(conn); err != nil {
-			return
-		}
-
-		switch {
-		default:
-			err = errInvalidResponse(data)
-		case string(data) == "ok":
-			return // up and running
-		case isError(data):
-			err = extractError(data)
-		}
-
-		return
-	})
+	return c.call(ctx, "probe", nil, slug)
 }
 
 func (c *Client) Resolve(ctx context.Context, slug, host string) (addr string, err error) {
-	err = c.do(ctx, func(conn net.Conn) (err error) {
-		if err = proto.Write(conn, "resolve", slug, host); err != nil {
-			return
-		}
-
-		var data []byte
-		if data, err = proto.Read(conn); err != nil {
-			return
-		}
-
-		switch {
-		default:
-			err = errInvalidResponse(data)
-		case string(data) == "ok":
-			err = ErrNoSuchHost
-		case isOK(data):
-			addr = string(extractOK(data))
-		case isError(data):
-			err = extractError(data)
-		}
-
-		return
-	})
+	if err = c.call(ctx, "resolve", &addr, slug, host); err == nil && addr == "" {
+		err = ErrNoSuchHost
+	}
 
 	return
 }
@@ -384,28 +534,8 @@ func (c *Client) Instances(ctx context.Context, org, app string) (instances Inst
 	gqlChan := make(chan instancesResult)
 	var agentInstances Instances
 	go func() {
-		agentChan <- c.do(ctx, func(conn net.Conn) (err error) {
-			if err = proto.Write(conn, "instances", org, app); err != nil {
-				return
-			}
-
-			// this goes out to the network; don't time it out aggressively
-			var data []byte
-			if data, err = proto.Read(conn); err != nil {
-				return
-			}
-
-			switch {
-			default:
-				err = errInvalidResponse(data)
-			case isOK(data):
-				err = unmarshal(&agentInstances, data)
-			case isError(data):
-				err = extractError(data)
-			}
-
-			return
-		})
+		// this goes out to the network; don't time it out aggressively
+		agentChan <- c.call(ctx, "instances", &agentInstances, org, app)
 	}()
 	go func() {
 		gqlChan <- gqlGetInstances(ctx, org, app)
@@ -541,8 +671,16 @@ func gqlGetInstances(ctx context.Context, orgSlug, appName string) instancesResu
 	return instancesResult{result, nil}
 }
 
+// unmarshal decodes the arguments of a legacy ok response into dst. Plain
+// string arguments, such as resolved addresses, aren't JSON encoded.
 func unmarshal(dst interface{}, data []byte) (err error) {
-	src := bytes.NewReader(extractOK(data))
+	if s, ok := dst.(*string); ok {
+		*s = string(data)
+
+		return
+	}
+
+	src := bytes.NewReader(data)
 
 	dec := json.NewDecoder(src)
 	if err = dec.Decode(dst); err != nil {
@@ -611,7 +749,12 @@ func (d *dialer) Config() *wg.Config {
 }
 
 func (d *dialer) DialContext(ctx context.Context, network, addr string) (conn net.Conn, err error) {
-	if conn, err = d.client.dialContext(ctx); err != nil {
+	structured, err := d.client.negotiate(ctx)
+	if err != nil {
+		return
+	}
+
+	if conn, err = d.client.connect(ctx); err != nil {
 		return
 	}
 	defer func() {
@@ -623,25 +766,18 @@ func (d *dialer) DialContext(ctx context.Context, network, addr string) (conn ne
 	c := make(chan error, 1)
 	go func() {
 		timeout := strconv.FormatInt(int64(d.timeout), 10)
-		if err := proto.Write(conn, "connect", d.slug, addr, timeout); err != nil {
-			c <- err
-			return
+		verb := "connect"
+		if isUDP(network) {
+			verb = "connectudp"
 		}
 
-		data, err := proto.Read(conn)
+		id, err := d.client.send(conn, structured, verb, d.slug, addr, timeout)
 		if err != nil {
 			c <- err
 			return
 		}
 
-		switch {
-		default:
-			c <- errInvalidResponse(data)
-		case string(data) == "ok":
-			close(c)
-		case isError(data):
-			c <- extractError(data)
-		}
+		c <- d.client.receive(conn, id, nil)
 	}()
 
 	select {
@@ -649,9 +785,47 @@ func (d *dialer) DialContext(ctx context.Context, network, addr string) (conn ne
 		err = ctx.Err()
 	case err = <-c:
 	}
+
+	if err == nil && isUDP(network) {
+		conn = &datagramConn{Conn: conn}
+	}
+
 	return
 }
 
+func isUDP(network string) bool {
+	switch network {
+	case "udp", "udp4", "udp6":
+		return true
+	default:
+		return false
+	}
+}
+
+// datagramConn reads and writes the datagrams the agent frames over the
+// connection it proxies UDP over. Like with UDP, datagrams larger than the
+// buffers they're read into are truncated.
+type datagramConn struct {
+	net.Conn
+}
+
+func (c *datagramConn) Read(p []byte) (int, error) {
+	data, err := proto.Read(c.Conn)
+	if err != nil {
+		return 0, err
+	}
+
+	return copy(p, data), nil
+}
+
+func (c *datagramConn) Write(p []byte) (int, error) {
+	if err := proto.WriteFrame(c.Conn, p); err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
+
 // Pinger wraps a connection to the flyctl agent over which ICMP
 // requests and replies are written. There's a simple protocol
 // for encapsulating requests and responses; drive it with the Pinger
@@ -672,12 +846,17 @@ func (c *Client) Pinger(ctx context.Context, slug string) (p *Pinger, err error)
 		return nil, fmt.Errorf("pinger: %w", err)
 	}
 
-	conn, err := c.dialContext(ctx)
+	structured, err := c.negotiate(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("pinger: %w", err)
+	}
+
+	conn, err := c.connect(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("pinger: %w", err)
 	}
 
-	if err = proto.Write(conn, "ping6", slug); err != nil {
+	if _, err = c.send(conn, structured, "ping6", slug); err != nil {
 		return nil, fmt.Errorf("pinger: %w", err)
 	}
 
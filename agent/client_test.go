@@ -0,0 +1,214 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/superfly/flyctl/agent/internal/proto"
+)
+
+// fakeAgent returns a client whose connections are answered by respond, which
+// is given each request the client sends and returns the payload to answer
+// with. It also returns the requests received.
+func fakeAgent(t *testing.T, respond func(req []byte) []byte) (*Client, *[]string) {
+	t.Helper()
+
+	var requests []string
+
+	c := newClient("unix", "unused")
+	c.dial = func(context.Context) (net.Conn, error) {
+		client, conn := net.Pipe()
+
+		go func() {
+			defer conn.Close()
+
+			req, err := proto.Read(conn)
+			if err != nil {
+				return
+			}
+			requests = append(requests, string(req))
+
+			_ = proto.WriteFrame(conn, respond(req))
+		}()
+
+		return client, nil
+	}
+
+	return c, &requests
+}
+
+func structuredResponse(t *testing.T, req []byte, result interface{}, err *proto.Error) []byte {
+	t.Helper()
+
+	var r proto.Request
+	require.NoError(t, json.Unmarshal(req, &r))
+
+	res := proto.Response{ID: r.ID, Version: proto.Version, Error: err}
+	if result != nil {
+		data, err := json.Marshal(result)
+		require.NoError(t, err)
+		res.Result = data
+	}
+
+	data, merr := json.Marshal(res)
+	require.NoError(t, merr)
+
+	return data
+}
+
+func TestClientFallsBackToLegacyProtocol(t *testing.T) {
+	ctx := context.Background()
+
+	// an agent predating the structured protocol, which takes the whole
+	// payload as a verb
+	c, requests := fakeAgent(t, func(req []byte) []byte {
+		if string(req) == "ping" {
+			return []byte(`ok {"PID":42,"Version":"0.1.0","Background":true}`)
+		}
+
+		return []byte("err unsupported command")
+	})
+
+	res, err := c.Ping(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 42, res.PID)
+	assert.Equal(t, "0.1.0", res.Version.String())
+	assert.True(t, res.Background)
+
+	caps, err := c.Capabilities(ctx)
+	require.NoError(t, err)
+	assert.Nil(t, caps)
+
+	require.Len(t, *requests, 2)
+	assert.True(t, proto.IsStructured([]byte((*requests)[0])))
+	assert.Contains(t, (*requests)[0], `"method":"hello"`)
+	assert.Equal(t, "ping", (*requests)[1])
+}
+
+func TestClientStructuredProtocol(t *testing.T) {
+	ctx := context.Background()
+
+	c, requests := fakeAgent(t, func(req []byte) []byte {
+		var r proto.Request
+		require.NoError(t, json.Unmarshal(req, &r))
+		assert.Equal(t, proto.Version, r.Version)
+
+		switch r.Method {
+		case "hello":
+			return structuredResponse(t, req, HelloResponse{
+				ProtocolVersion:    proto.Version,
+				MinProtocolVersion: proto.MinVersion,
+				Capabilities:       []string{"hello", "ping", "resolve"},
+			}, nil)
+		case "ping":
+			return structuredResponse(t, req, PingResponse{PID: 7}, nil)
+		case "resolve":
+			if r.Args[1] == "missing.internal" {
+				return structuredResponse(t, req, nil, &proto.Error{Code: ErrCodeNoSuchHost, Message: "no such host"})
+			}
+			return structuredResponse(t, req, "fdaa::3", nil)
+		default:
+			return structuredResponse(t, req, nil, &proto.Error{Code: ErrCodeUnsupportedMethod, Message: "unsupported command"})
+		}
+	})
+
+	res, err := c.Ping(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 7, res.PID)
+
+	caps, err := c.Capabilities(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"hello", "ping", "resolve"}, caps)
+
+	addr, err := c.Resolve(ctx, "personal", "app.internal")
+	require.NoError(t, err)
+	assert.Equal(t, "fdaa::3", addr)
+
+	_, err = c.Resolve(ctx, "personal", "missing.internal")
+	assert.ErrorIs(t, err, ErrNoSuchHost)
+
+	var agentErr *Error
+	err = c.call(ctx, "bogus", nil)
+	require.ErrorAs(t, err, &agentErr)
+	assert.Equal(t, ErrCodeUnsupportedMethod, agentErr.Code)
+
+	// hello is only sent once, and every request is structured
+	hellos := 0
+	for _, req := range *requests {
+		assert.True(t, proto.IsStructured([]byte(req)), req)
+		if strings.Contains(req, `"method":"hello"`) {
+			hellos++
+		}
+	}
+	assert.Equal(t, 1, hellos)
+}
+
+func TestClientRejectsNewerProtocol(t *testing.T) {
+	c, _ := fakeAgent(t, func(req []byte) []byte {
+		if proto.IsStructured(req) {
+			return structuredResponse(t, req, HelloResponse{
+				ProtocolVersion:    proto.Version + 1,
+				MinProtocolVersion: proto.Version + 1,
+				Capabilities:       []string{"ping"},
+			}, nil)
+		}
+
+		return []byte(`ok {"PID":1}`)
+	})
+
+	// the agent doesn't answer this build's version anymore; the legacy verbs
+	// remain
+	res, err := c.Ping(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 1, res.PID)
+}
+
+func TestDecodeResponse(t *testing.T) {
+	var res PingResponse
+
+	err := decodeResponse([]byte(`{"id":"2","version":1,"result":{"PID":3}}`), "2", &res)
+	require.NoError(t, err)
+	assert.Equal(t, 3, res.PID)
+
+	assert.NoError(t, decodeResponse([]byte(`{"id":"2","version":1}`), "2", &res))
+	assert.NoError(t, decodeResponse([]byte(`{"id":"2","version":1,"result":{"PID":3}}`), "2", nil))
+
+	err = decodeResponse([]byte(`{"id":"2","version":1,"error":{"code":"tunnel_unavailable","message":"tunnel unavailable"}}`), "2", &res)
+	assert.ErrorIs(t, err, ErrTunnelUnavailable)
+	assert.EqualError(t, err, "tunnel unavailable")
+
+	var invalid errInvalidResponse
+	assert.ErrorAs(t, decodeResponse([]byte(`{"id":"3","version":1}`), "2", &res), &invalid)
+	assert.ErrorAs(t, decodeResponse([]byte(`{"id":`), "2", &res), &invalid)
+}
+
+func TestReceiveLegacyResponses(t *testing.T) {
+	receive := func(payload string, res interface{}) error {
+		client, conn := net.Pipe()
+		defer client.Close()
+
+		go func() {
+			defer conn.Close()
+			_ = proto.WriteFrame(conn, []byte(payload))
+		}()
+
+		return (&Client{}).receive(client, "", res)
+	}
+
+	var res PingResponse
+	assert.NoError(t, receive("ok", &res))
+	assert.NoError(t, receive(`ok {"PID":5}`, nil))
+	require.NoError(t, receive(`ok {"PID":5}`, &res))
+	assert.Equal(t, 5, res.PID)
+
+	assert.EqualError(t, receive("err tunnel unavailable", &res), "tunnel unavailable")
+
+	var invalid errInvalidResponse
+	assert.ErrorAs(t, receive("what", &res), &invalid)
+}
@@ -5,4 +5,43 @@ import "errors"
 var (
 	ErrNoSuchHost        = errors.New("host was not found in DNS")
 	ErrTunnelUnavailable = errors.New("tunnel unavailable")
+	ErrNoSuchForward     = errors.New("no such forward")
 )
+
+// Error codes reported by the agent over the structured protocol.
+const (
+	ErrCodeInternal           = "internal"
+	ErrCodeMalformedRequest   = "malformed_request"
+	ErrCodeUnsupportedMethod  = "unsupported_method"
+	ErrCodeUnsupportedVersion = "unsupported_version"
+	ErrCodeTunnelUnavailable  = "tunnel_unavailable"
+	ErrCodeNoSuchHost         = "no_such_host"
+	ErrCodeNoSuchOrg          = "no_such_org"
+	ErrCodeTimeout            = "timeout"
+	ErrCodeNoSuchForward      = "no_such_forward"
+)
+
+// Error is an error reported by the agent over the structured protocol.
+type Error struct {
+	Code    string
+	Message string
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Is reports whether the error matches the sentinel error of its code, so
+// that callers can keep using errors.Is(err, ErrTunnelUnavailable) and alike.
+func (e *Error) Is(target error) bool {
+	switch e.Code {
+	case ErrCodeTunnelUnavailable:
+		return target == ErrTunnelUnavailable
+	case ErrCodeNoSuchHost:
+		return target == ErrNoSuchHost
+	case ErrCodeNoSuchForward:
+		return target == ErrNoSuchForward
+	default:
+		return false
+	}
+}
@@ -0,0 +1,79 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/samber/lo"
+)
+
+// Forward is a local port the agent forwards to an address on the private
+// network of an organization, over the tunnel to it.
+type Forward struct {
+	// Local is the local port, or the path of the unix socket, the agent
+	// listens on. It identifies the forward.
+	Local  string
+	Remote string
+	Org    string
+	App    string
+
+	CreatedAt        time.Time
+	TotalConnections uint64
+
+	// Error is why the agent isn't listening on Local, or why it last failed
+	// to reach Remote.
+	Error string `json:",omitempty"`
+}
+
+// ErrForwardsUnsupported is returned by agents predating background forwards.
+var ErrForwardsUnsupported = errors.New("the running agent doesn't support background forwards; restart it with 'fly agent restart'")
+
+func (c *Client) supports(ctx context.Context, method string) error {
+	caps, err := c.Capabilities(ctx)
+	if err != nil {
+		return err
+	}
+
+	if !lo.Contains(caps, method) {
+		return ErrForwardsUnsupported
+	}
+
+	return nil
+}
+
+// Forward has the agent forward the local port to the remote address over
+// the tunnel to the org. The agent keeps the forward until it's stopped,
+// including across restarts.
+func (c *Client) Forward(ctx context.Context, org, app, local, remote string) (res *Forward, err error) {
+	if err = c.supports(ctx, "forward"); err != nil {
+		return
+	}
+
+	res = &Forward{}
+	if err = c.call(ctx, "forward", res, org, app, local, remote); err != nil {
+		res = nil
+	}
+
+	return
+}
+
+// Forwards returns the forwards the agent keeps.
+func (c *Client) Forwards(ctx context.Context) (res []Forward, err error) {
+	if err = c.supports(ctx, "forwards"); err != nil {
+		return
+	}
+
+	err = c.call(ctx, "forwards", &res)
+
+	return
+}
+
+// Unforward stops the forward of the local port.
+func (c *Client) Unforward(ctx context.Context, local string) error {
+	if err := c.supports(ctx, "unforward"); err != nil {
+		return err
+	}
+
+	return c.call(ctx, "unforward", nil, local)
+}
@@ -1,11 +1,66 @@
 // Package proto implements the agent's protocol.
+//
+// Every message is framed as a little-endian uint16 length followed by the
+// payload. The legacy protocol's payloads are space-separated verbs and
+// arguments, answered by "ok [args...]" or "err message".
+//
+// The structured protocol's payloads are JSON documents: clients send a
+// Request and the agent answers with a Response carrying the same ID. The
+// agent tells both apart by the first byte of the payload, so legacy clients
+// keep working.
+//
+// Connections the agent proxies UDP over carry datagrams, each in a frame of
+// its own, once the agent answered the connectudp request.
 package proto
 
 import (
 	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
+	"math"
 )
 
+const (
+	// Version is the version of the structured protocol spoken by this build.
+	Version = 1
+
+	// MinVersion is the oldest version of the structured protocol this build
+	// still answers.
+	MinVersion = 1
+)
+
+// Request is a request of the structured protocol. Args are the same
+// positional arguments the legacy verb of the method takes.
+type Request struct {
+	ID      string   `json:"id"`
+	Version int      `json:"version"`
+	Method  string   `json:"method"`
+	Args    []string `json:"args,omitempty"`
+}
+
+// Response answers the Request with the same ID. Exactly one of Result and
+// Error is set.
+type Response struct {
+	ID      string          `json:"id"`
+	Version int             `json:"version"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *Error          `json:"error,omitempty"`
+}
+
+// Error is a failed Response. Code is stable and meant for programs; Message
+// is meant for humans.
+type Error struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// IsStructured reports whether data is a message of the structured protocol.
+func IsStructured(data []byte) bool {
+	return len(data) > 0 && data[0] == '{'
+}
+
 func Read(r io.Reader) (data []byte, err error) {
 	var b [2]byte
 	if _, err = io.ReadFull(r, b[:]); err == nil {
@@ -46,3 +101,70 @@ func Write(w io.Writer, verb string, args ...string) (err error) {
 
 	return
 }
+
+// WriteJSON writes v as a message of the structured protocol.
+func WriteJSON(w io.Writer, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	return WriteFrame(w, data)
+}
+
+// WriteFrame writes data in a single frame.
+func WriteFrame(w io.Writer, data []byte) error {
+	if len(data) > math.MaxUint16 {
+		return fmt.Errorf("message too large (%d bytes)", len(data))
+	}
+
+	buf := make([]byte, 2, 2+len(data))
+	binary.LittleEndian.PutUint16(buf, uint16(len(data)))
+
+	_, err := w.Write(append(buf, data...))
+	return err
+}
+
+// FrameDatagrams writes each datagram read from src to dst in a frame of its
+// own, until src fails. It returns the number of bytes of the datagrams.
+func FrameDatagrams(dst io.Writer, src io.Reader) (n int64, err error) {
+	buf := make([]byte, math.MaxUint16)
+
+	for {
+		var m int
+		if m, err = src.Read(buf); m > 0 {
+			if err := WriteFrame(dst, buf[:m]); err != nil {
+				return n, err
+			}
+			n += int64(m)
+		}
+
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				err = nil
+			}
+
+			return
+		}
+	}
+}
+
+// UnframeDatagrams writes each frame read from src to dst as a datagram,
+// until src fails. It returns the number of bytes of the datagrams.
+func UnframeDatagrams(dst io.Writer, src io.Reader) (n int64, err error) {
+	for {
+		var data []byte
+		if data, err = Read(src); err != nil {
+			if errors.Is(err, io.EOF) {
+				err = nil
+			}
+
+			return
+		}
+
+		if _, err = dst.Write(data); err != nil {
+			return
+		}
+		n += int64(len(data))
+	}
+}
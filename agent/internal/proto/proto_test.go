@@ -0,0 +1,79 @@
+package proto
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLegacyFraming(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, Write(&buf, "resolve", "personal", "app.internal"))
+	require.NoError(t, Write(&buf, "ping"))
+
+	assert.Equal(t, []byte{29, 0}, buf.Bytes()[:2])
+
+	data, err := Read(&buf)
+	require.NoError(t, err)
+	assert.Equal(t, "resolve personal app.internal", string(data))
+	assert.False(t, IsStructured(data))
+
+	data, err = Read(&buf)
+	require.NoError(t, err)
+	assert.Equal(t, "ping", string(data))
+
+	_, err = Read(&buf)
+	assert.Error(t, err)
+}
+
+func TestStructuredFraming(t *testing.T) {
+	var buf bytes.Buffer
+
+	req := Request{ID: "1", Version: Version, Method: "resolve", Args: []string{"personal", "app.internal"}}
+	require.NoError(t, WriteJSON(&buf, req))
+
+	data, err := Read(&buf)
+	require.NoError(t, err)
+	assert.True(t, IsStructured(data))
+
+	var got Request
+	require.NoError(t, json.Unmarshal(data, &got))
+	assert.Equal(t, req, got)
+
+	assert.Error(t, WriteFrame(&buf, make([]byte, math.MaxUint16+1)))
+	assert.Zero(t, buf.Len())
+
+	assert.False(t, IsStructured(nil))
+}
+
+func TestDatagramFraming(t *testing.T) {
+	datagrams := [][]byte{[]byte("one"), []byte("two, longer"), {}}
+
+	var framed bytes.Buffer
+	for _, d := range datagrams {
+		n, err := FrameDatagrams(&framed, bytes.NewReader(d))
+		require.NoError(t, err)
+		assert.Equal(t, int64(len(d)), n)
+	}
+
+	var out datagramRecorder
+	n, err := UnframeDatagrams(&out, &framed)
+	require.NoError(t, err)
+	assert.Equal(t, int64(14), n)
+	assert.Equal(t, []string{"one", "two, longer"}, out.datagrams)
+}
+
+// datagramRecorder records each write as a datagram.
+type datagramRecorder struct {
+	datagrams []string
+}
+
+func (r *datagramRecorder) Write(p []byte) (int, error) {
+	r.datagrams = append(r.datagrams, string(p))
+
+	return len(p), nil
+}
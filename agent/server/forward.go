@@ -0,0 +1,238 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/superfly/flyctl/agent"
+	"github.com/superfly/flyctl/proxy"
+	"github.com/superfly/flyctl/wg"
+)
+
+// forward is a local port the agent forwards to an address on the private
+// network of an org. It dials through whichever tunnel to the org is current,
+// establishing one when there's none, so forwards outlive tunnels.
+type forward struct {
+	agent.Forward
+
+	cancel           context.CancelFunc
+	listener         net.Listener
+	totalConnections uint64
+	err              atomic.Value // string
+}
+
+// stop stops listening for connections to the forward.
+func (f *forward) stop() {
+	if f.cancel != nil {
+		f.cancel()
+		_ = f.listener.Close()
+	}
+}
+
+func (f *forward) status() agent.Forward {
+	res := f.Forward
+	res.TotalConnections = atomic.LoadUint64(&f.totalConnections)
+	if err, _ := f.err.Load().(string); err != "" {
+		res.Error = err
+	}
+
+	return res
+}
+
+var errForwardExists = errors.New("the local port is already forwarded")
+
+// startForward listens on the local port of f and starts forwarding it. The
+// forward is registered, with its error, even when the agent fails listening:
+// forwards restored as the agent starts are kept that way, to be retried when
+// it restarts, while those requested by clients are stopped, so that the
+// client gets the error instead.
+func (s *server) startForward(f *forward) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.forwards[f.Local]; exists {
+		return errForwardExists
+	}
+	s.forwards[f.Local] = f
+
+	l, err := proxy.Listen(f.Local)
+	if err != nil {
+		err = fmt.Errorf("failed listening on %s: %w", f.Local, err)
+		f.err.Store(err.Error())
+
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	f.cancel, f.listener = cancel, l
+
+	srv := &proxy.Server{
+		Addr:     f.Remote,
+		Listener: l,
+		Dial: func(ctx context.Context, _, addr string) (net.Conn, error) {
+			atomic.AddUint64(&f.totalConnections, 1)
+
+			conn, err := s.dialForward(ctx, f.Org, addr)
+			if err != nil {
+				s.printf("forward %s: %v", f.Local, err)
+				f.err.Store(err.Error())
+
+				return nil, err
+			}
+			f.err.Store("")
+
+			return conn, nil
+		},
+	}
+
+	go func() {
+		if err := srv.ProxyServer(ctx); err != nil && ctx.Err() == nil {
+			s.printf("forward %s: %v", f.Local, err)
+			f.err.Store(err.Error())
+		}
+	}()
+
+	s.printf("forwarding %s to %s (%s)", f.Local, f.Remote, f.Org)
+
+	return nil
+}
+
+// dialForward dials addr, resolving it if needed, over the tunnel to the
+// org, establishing the tunnel first if there's none.
+func (s *server) dialForward(parent context.Context, slug, addr string) (net.Conn, error) {
+	ctx, cancel := context.WithTimeout(parent, 30*time.Second)
+	defer cancel()
+
+	tunnel, err := s.ensureTunnel(ctx, slug)
+	if err != nil {
+		return nil, err
+	}
+
+	resolved, err := resolve(ctx, tunnel, addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed resolving %s: %w", addr, err)
+	}
+
+	return tunnel.DialContext(ctx, "tcp", resolved)
+}
+
+func (s *server) ensureTunnel(ctx context.Context, slug string) (*wg.Tunnel, error) {
+	if tunnel := s.tunnelFor(slug); tunnel != nil {
+		return tunnel, nil
+	}
+
+	org, err := s.fetchOrg(ctx, slug)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.buildTunnel(org, false)
+}
+
+func (s *server) stopForward(local string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f := s.forwards[local]
+	if f == nil {
+		return agent.ErrNoSuchForward
+	}
+	delete(s.forwards, local)
+
+	f.stop()
+
+	s.printf("stopped forwarding %s", local)
+
+	return nil
+}
+
+// stopForwards stops all forwards without forgetting them, as the agent
+// shuts down.
+func (s *server) stopForwards() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, f := range s.forwards {
+		f.stop()
+	}
+}
+
+func (s *server) listForwards() []agent.Forward {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	res := make([]agent.Forward, 0, len(s.forwards))
+	for _, f := range s.forwards {
+		res = append(res, f.status())
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Local < res[j].Local
+	})
+
+	return res
+}
+
+// saveForwards persists the forwards so that they're restored when the agent
+// restarts.
+func (s *server) saveForwards() error {
+	if s.ForwardsFile == "" {
+		return nil
+	}
+
+	forwards := s.listForwards()
+	for i := range forwards {
+		forwards[i].TotalConnections = 0
+		forwards[i].Error = ""
+	}
+
+	data, err := json.MarshalIndent(forwards, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := s.ForwardsFile + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, s.ForwardsFile)
+}
+
+// restoreForwards starts the forwards the agent kept before it restarted.
+func (s *server) restoreForwards() {
+	if s.ForwardsFile == "" {
+		return
+	}
+
+	data, err := os.ReadFile(s.ForwardsFile)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		return
+	case err != nil:
+		s.printf("failed reading forwards: %v", err)
+
+		return
+	}
+
+	var forwards []agent.Forward
+	if err := json.Unmarshal(data, &forwards); err != nil {
+		s.printf("failed decoding %s: %v", filepath.Base(s.ForwardsFile), err)
+
+		return
+	}
+
+	for _, f := range forwards {
+		if err := s.startForward(&forward{Forward: f}); err != nil {
+			s.printf("failed restoring forward %s: %v", f.Local, err)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package server
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/superfly/flyctl/agent"
+	"github.com/superfly/flyctl/agent/internal/proto"
+)
+
+func forwardRequest(id string, args ...string) proto.Request {
+	return proto.Request{ID: id, Version: proto.Version, Method: "forward", Args: args}
+}
+
+func TestForwardsSaveAndRestore(t *testing.T) {
+	srv := newTestServer(t)
+	dir := t.TempDir()
+	web, db := filepath.Join(dir, "web.sock"), filepath.Join(dir, "db.sock")
+
+	for i, args := range [][]string{
+		{"acme", "web", web, "web.internal:8080"},
+		{"acme", "db", db, "db.internal:5432"},
+	} {
+		res := structuredRoundTrip(t, srv, forwardRequest(string(rune('1'+i)), args...))
+		require.Nil(t, res.Error)
+	}
+	defer srv.stopForwards()
+
+	// counters and errors aren't kept across restarts
+	srv.forwards[web].totalConnections = 3
+	srv.forwards[web].err.Store("failed dialing")
+	require.NoError(t, srv.saveForwards())
+
+	var saved []agent.Forward
+	require.NoError(t, json.Unmarshal(mustReadFile(t, srv.ForwardsFile), &saved))
+	require.Len(t, saved, 2)
+	assert.Equal(t, db, saved[0].Local)
+	assert.Equal(t, web, saved[1].Local)
+	assert.Zero(t, saved[1].TotalConnections)
+	assert.Empty(t, saved[1].Error)
+
+	srv.stopForwards()
+
+	restored := newTestServer(t)
+	restored.ForwardsFile = srv.ForwardsFile
+	restored.restoreForwards()
+	defer restored.stopForwards()
+
+	forwards := restored.listForwards()
+	require.Len(t, forwards, 2)
+	for i, f := range forwards {
+		assert.Equal(t, saved[i].Local, f.Local)
+		assert.Equal(t, saved[i].Remote, f.Remote)
+		assert.Equal(t, saved[i].Org, f.Org)
+		assert.Equal(t, saved[i].App, f.App)
+		assert.True(t, saved[i].CreatedAt.Equal(f.CreatedAt))
+		assert.Empty(t, f.Error)
+		assert.NotNil(t, restored.forwards[f.Local].listener, f.Local)
+	}
+
+	// unforwarding forgets the forward for good
+	res := structuredRoundTrip(t, restored, proto.Request{ID: "3", Version: proto.Version, Method: "unforward", Args: []string{web}})
+	require.Nil(t, res.Error)
+	require.NoError(t, json.Unmarshal(mustReadFile(t, restored.ForwardsFile), &saved))
+	require.Len(t, saved, 1)
+	assert.Equal(t, db, saved[0].Local)
+}
+
+func TestRestoreForwardsKeepsFailedForwards(t *testing.T) {
+	srv := newTestServer(t)
+	local := filepath.Join(t.TempDir(), "taken.sock")
+	require.NoError(t, os.WriteFile(local, nil, 0o600))
+
+	data, err := json.Marshal([]agent.Forward{
+		{Local: local, Remote: "web.internal:8080", Org: "acme", App: "web", CreatedAt: time.Now()},
+	})
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(srv.ForwardsFile, data, 0o600))
+
+	srv.restoreForwards()
+	defer srv.stopForwards()
+
+	forwards := srv.listForwards()
+	require.Len(t, forwards, 1)
+	assert.Equal(t, local, forwards[0].Local)
+	assert.Contains(t, forwards[0].Error, "failed listening on "+local)
+}
+
+func TestForwardDuplicateLocal(t *testing.T) {
+	srv := newTestServer(t)
+	local := filepath.Join(t.TempDir(), "web.sock")
+
+	res := structuredRoundTrip(t, srv, forwardRequest("1", "acme", "web", local, "web.internal:8080"))
+	require.Nil(t, res.Error)
+	defer srv.stopForwards()
+
+	res = structuredRoundTrip(t, srv, forwardRequest("2", "acme", "db", local, "db.internal:5432"))
+	require.NotNil(t, res.Error)
+	assert.Contains(t, res.Error.Message, errForwardExists.Error())
+
+	// the forward that was there first is left alone
+	forwards := srv.listForwards()
+	require.Len(t, forwards, 1)
+	assert.Equal(t, "web.internal:8080", forwards[0].Remote)
+	assert.NotNil(t, srv.forwards[local].listener)
+	_, err := os.Stat(local)
+	assert.NoError(t, err)
+
+	var saved []agent.Forward
+	require.NoError(t, json.Unmarshal(mustReadFile(t, srv.ForwardsFile), &saved))
+	require.Len(t, saved, 1)
+	assert.Equal(t, "web", saved[0].App)
+}
+
+func mustReadFile(t *testing.T, path string) []byte {
+	t.Helper()
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+
+	return data
+}
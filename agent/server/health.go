@@ -0,0 +1,209 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/azazeal/pause"
+
+	"github.com/superfly/flyctl/internal/wireguard"
+	"github.com/superfly/flyctl/wg"
+)
+
+const (
+	// tunnelCheckInterval is how often the agent checks its tunnels.
+	tunnelCheckInterval = time.Minute
+
+	// handshakeWait is how long a peer has to complete a handshake before the
+	// agent fails over.
+	handshakeWait = 10 * time.Second
+
+	// maxFallbackPeers is how many fallback peers the agent tries per
+	// failover.
+	maxFallbackPeers = 2
+)
+
+var errNoHandshake = errors.New("no handshake with the peer")
+
+// watchTunnels checks the tunnels periodically until ctx is done.
+func (s *server) watchTunnels(ctx context.Context) {
+	for {
+		if pause.For(ctx, tunnelCheckInterval); ctx.Err() != nil {
+			break
+		}
+
+		s.mu.Lock()
+		slugs := make([]string, 0, len(s.tunnels))
+		for slug := range s.tunnels {
+			slugs = append(slugs, slug)
+		}
+		s.mu.Unlock()
+
+		for _, slug := range slugs {
+			s.checkTunnel(ctx, slug)
+		}
+	}
+}
+
+// checkTunnel fails the tunnel to the org over when its handshake went stale
+// and its peer doesn't complete a new one. Tunnels that handshook recently
+// are left alone, so idle tunnels only see traffic every handshakeTimeout.
+func (s *server) checkTunnel(ctx context.Context, slug string) {
+	tunnel := s.tunnelFor(slug)
+	if tunnel == nil {
+		return
+	}
+
+	stats, err := tunnel.Stats()
+	if err != nil {
+		return // closed in the meantime
+	}
+	if time.Since(stats.LastHandshake) < handshakeTimeout {
+		return
+	}
+
+	if err := s.handshake(ctx, slug, tunnel); err == nil || ctx.Err() != nil {
+		return
+	}
+
+	s.printf("handshake with the peer of %q went stale; failing over ...", slug)
+
+	if err := s.failover(ctx, slug, tunnel); err != nil {
+		s.printf("failed failing over %q: %v", slug, err)
+	}
+}
+
+// handshake sends traffic through the tunnel and waits for the handshake it
+// requires, recording how long it took.
+func (s *server) handshake(parent context.Context, slug string, tunnel *wg.Tunnel) error {
+	ctx, cancel := context.WithTimeout(parent, handshakeWait)
+	defer cancel()
+
+	since := time.Now()
+
+	go func() {
+		_, _ = tunnel.LookupAAAA(ctx, "_api.internal")
+	}()
+
+	latency, err := tunnel.AwaitHandshake(ctx, since)
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			err = errNoHandshake
+		}
+
+		return err
+	}
+
+	if stats := s.statsFor(slug); stats != nil {
+		atomic.StoreInt64(&stats.handshakeLatency, int64(latency))
+	}
+
+	s.printf("%q handshook in %v", slug, latency.Round(time.Millisecond))
+
+	return nil
+}
+
+// failover moves the tunnel to the org to another address of its peer's
+// endpoint and, failing that, to a fallback peer in another region.
+func (s *server) failover(ctx context.Context, slug string, tunnel *wg.Tunnel) error {
+	for {
+		endpoint, ok, err := tunnel.NextEndpoint()
+		if err != nil {
+			return err
+		}
+		if !ok {
+			break
+		}
+
+		s.printf("trying %q over %s ...", slug, endpoint)
+
+		if err := s.handshake(ctx, slug, tunnel); err == nil {
+			s.countFailover(slug)
+			s.printf("failed %q over to %s", slug, endpoint)
+
+			return nil
+		}
+	}
+
+	org, err := s.fetchOrg(ctx, slug)
+	if err != nil {
+		return err
+	}
+
+	tried := []string{tunnel.State.Region}
+
+	for i := 0; i < maxFallbackPeers; i++ {
+		state, err := wireguard.FallbackForOrg(ctx, s.Client, org, tried...)
+		if err != nil {
+			return err
+		}
+		tried = append(tried, state.Region)
+
+		s.printf("trying %q through peer %s in %s ...", slug, state.Name, state.Region)
+
+		fallback, err := connectTunnel(state)
+		if err != nil {
+			s.printf("failed connecting to %s: %v", state.Name, err)
+
+			continue
+		}
+
+		if err := s.handshake(ctx, slug, fallback); err != nil {
+			s.printf("failed handshaking with %s: %v", state.Name, err)
+			_ = fallback.Close()
+
+			continue
+		}
+
+		if !s.swapTunnel(slug, tunnel, fallback) {
+			_ = fallback.Close() // replaced or closed in the meantime
+
+			return nil
+		}
+
+		// so that the agent doesn't go back to the dead peer when it restarts
+		if err := wireguard.PreferFallback(slug, state.Region); err != nil {
+			s.printf("failed saving peer %s as the preferred peer of %q: %v", state.Name, slug, err)
+		}
+
+		return nil
+	}
+
+	return fmt.Errorf("no peer of %s in %d regions completed a handshake", slug, len(tried))
+}
+
+// swapTunnel replaces the tunnel to the org with the fallback one, unless the
+// tunnel was replaced or closed in the meantime.
+func (s *server) swapTunnel(slug string, old, fallback *wg.Tunnel) bool {
+	s.mu.Lock()
+	if s.tunnels[slug] != old {
+		s.mu.Unlock()
+
+		return false
+	}
+
+	s.tunnels[slug] = fallback
+	if stats := s.stats[slug]; stats != nil {
+		stats.establishedAt = time.Now()
+		stats.fallback = true
+	}
+	s.mu.Unlock()
+
+	s.countFailover(slug)
+	s.printf("failed %q over to peer %s in %s", slug, fallback.State.Name, fallback.State.Region)
+
+	if err := old.Close(); err != nil {
+		s.printf("failed closing tunnel: %v", err)
+	}
+
+	return true
+}
+
+func (s *server) countFailover(slug string) {
+	if stats := s.statsFor(slug); stats != nil {
+		atomic.AddUint64(&stats.failovers, 1)
+	}
+}
@@ -32,6 +32,14 @@ type Options struct {
 	Client     *api.Client
 	Background bool
 	ConfigFile string
+
+	// MetricsAddr is the address to serve metrics on in the Prometheus text
+	// format. No metrics are served when it's empty.
+	MetricsAddr string
+
+	// ForwardsFile is where the agent keeps the forwards it restores when it
+	// restarts.
+	ForwardsFile string
 }
 
 func Run(ctx context.Context, opt Options) (err error) {
@@ -57,6 +65,9 @@ func Run(ctx context.Context, opt Options) (err error) {
 		listener:      l,
 		currentChange: latestChangeAt,
 		tunnels:       make(map[string]*wg.Tunnel),
+		stats:         make(map[string]*tunnelStats),
+		forwards:      make(map[string]*forward),
+		startedAt:     time.Now(),
 	}).serve(ctx, l)
 
 	return
@@ -111,6 +122,12 @@ type server struct {
 	mu            sync.Mutex
 	currentChange time.Time
 	tunnels       map[string]*wg.Tunnel
+	stats         map[string]*tunnelStats
+	forwards      map[string]*forward
+
+	startedAt     time.Time
+	sessions      int64
+	totalSessions uint64
 }
 
 type terminateError struct{ error }
@@ -120,6 +137,9 @@ func (te terminateError) Unwrap() error { return te.error }
 var errShutdown = errors.New("shutdown")
 
 func (s *server) serve(parent context.Context, l net.Listener) (err error) {
+	s.restoreForwards()
+	defer s.stopForwards()
+
 	eg, ctx := errgroup.WithContext(parent)
 
 	eg.Go(func() error {
@@ -138,17 +158,34 @@ func (s *server) serve(parent context.Context, l net.Listener) (err error) {
 		return nil
 	})
 
+	eg.Go(func() error {
+		s.watchTunnels(ctx)
+
+		return nil
+	})
+
+	if s.MetricsAddr != "" {
+		eg.Go(func() error {
+			if err := s.serveMetrics(ctx, s.MetricsAddr); err != nil {
+				s.printf("failed serving metrics: %v", err)
+			}
+
+			return nil
+		})
+	}
+
 	eg.Go(func() (err error) {
 		s.printf("OK %d", os.Getpid())
 		defer s.print("QUIT")
 
-		var sID uint64
-
 		for {
 			var conn net.Conn
 			if conn, err = s.listener.Accept(); err == nil {
 				eg.Go(func() error {
-					runSession(ctx, s, conn, id(atomic.AddUint64(&sID, 1)))
+					atomic.AddInt64(&s.sessions, 1)
+					defer atomic.AddInt64(&s.sessions, -1)
+
+					runSession(ctx, s, conn, id(atomic.AddUint64(&s.totalSessions, 1)))
 
 					return nil
 				})
@@ -223,22 +260,33 @@ func (s *server) buildTunnel(org *api.Organization, recycle bool) (tunnel *wg.Tu
 		return
 	}
 
-	// WIP: can't stay this way, need something more clever than this
-	if env.IsCI() || os.Getenv("WSWG") != "" || viper.GetBool(flyctl.ConfigWireGuardWebsockets) {
-		if tunnel, err = wg.ConnectWS(context.Background(), state); err != nil {
-			return
-		}
-	} else {
-		if tunnel, err = wg.Connect(context.Background(), state); err != nil {
-			return
+	if tunnel, err = connectTunnel(state); err != nil {
+		return
+	}
+
+	if old := s.tunnels[org.Slug]; old != nil {
+		if err := old.Close(); err != nil {
+			s.printf("failed closing tunnel: %v", err)
 		}
 	}
 
 	s.tunnels[org.Slug] = tunnel
+	s.stats[org.Slug] = &tunnelStats{
+		establishedAt: time.Now(),
+	}
 
 	return
 }
 
+func connectTunnel(state *wg.WireGuardState) (*wg.Tunnel, error) {
+	// WIP: can't stay this way, need something more clever than this
+	if env.IsCI() || os.Getenv("WSWG") != "" || viper.GetBool(flyctl.ConfigWireGuardWebsockets) {
+		return wg.ConnectWS(context.Background(), state)
+	}
+
+	return wg.Connect(context.Background(), state)
+}
+
 func (s *server) fetchInstances(ctx context.Context, tunnel *wg.Tunnel, app string) (*agent.Instances, error) {
 	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
 	defer cancel()
@@ -332,6 +380,7 @@ func (s *server) validateTunnelsUnlocked() error {
 	for slug, tunnel := range s.tunnels {
 		if peers[slug] == nil {
 			delete(s.tunnels, slug)
+			delete(s.stats, slug)
 
 			s.printf("no peer for %s in config - closing tunnel ...", slug)
 
@@ -12,9 +12,11 @@ import (
 	"net"
 	"os"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"golang.org/x/sync/errgroup"
@@ -38,6 +40,10 @@ type session struct {
 	conn   net.Conn
 	logger *log.Logger
 	id     id
+
+	// req is the request being served over the structured protocol, or nil
+	// for legacy verbs.
+	req *proto.Request
 }
 
 var errUnsupportedCommand = errors.New("unsupported command")
@@ -94,6 +100,12 @@ func runSession(ctx context.Context, srv *server, conn net.Conn, id id) {
 		return
 	}
 
+	if proto.IsStructured(buf) {
+		s.serveStructured(ctx, buf)
+
+		return
+	}
+
 	args := strings.Split(string(buf), " ")
 
 	fn := handlers[args[0]]
@@ -106,6 +118,38 @@ func runSession(ctx context.Context, srv *server, conn net.Conn, id id) {
 	fn(s, ctx, args[1:]...)
 }
 
+var errUnsupportedVersion = &agent.Error{
+	Code:    agent.ErrCodeUnsupportedVersion,
+	Message: fmt.Sprintf("unsupported protocol version; supported versions are %d to %d", proto.MinVersion, proto.Version),
+}
+
+func (s *session) serveStructured(ctx context.Context, buf []byte) {
+	s.req = &proto.Request{}
+	if err := json.Unmarshal(buf, s.req); err != nil {
+		s.error(&agent.Error{
+			Code:    agent.ErrCodeMalformedRequest,
+			Message: fmt.Sprintf("malformed request: %v", err),
+		})
+
+		return
+	}
+
+	if s.req.Version < proto.MinVersion || s.req.Version > proto.Version {
+		s.error(errUnsupportedVersion)
+
+		return
+	}
+
+	fn := handlers[s.req.Method]
+	if fn == nil {
+		s.error(errUnsupportedCommand)
+
+		return
+	}
+
+	fn(s, ctx, s.req.Args...)
+}
+
 type handlerFunc func(*session, context.Context, ...string)
 
 var handlers = map[string]handlerFunc{
@@ -114,13 +158,49 @@ var handlers = map[string]handlerFunc{
 	"establish":   (*session).establish,
 	"reestablish": (*session).reestablish,
 	"connect":     (*session).connect,
+	"connectudp":  (*session).connectUDP,
 	"probe":       (*session).probe,
 	"instances":   (*session).instances,
 	"resolve":     (*session).resolve,
 	"ping6":       (*session).ping6,
+	"status":      (*session).status,
+	"forward":     (*session).forward,
+	"forwards":    (*session).forwards,
+	"unforward":   (*session).unforward,
 }
 
-var errMalformedKill = errors.New("malformed kill command")
+func init() {
+	// hello lists the handlers, so it can't be part of their initializer.
+	handlers["hello"] = (*session).hello
+}
+
+// capabilities lists the methods the agent answers.
+func capabilities() []string {
+	methods := make([]string, 0, len(handlers))
+	for method := range handlers {
+		methods = append(methods, method)
+	}
+	sort.Strings(methods)
+
+	return methods
+}
+
+var errMalformedHello = malformedError("hello")
+
+func (s *session) hello(_ context.Context, args ...string) {
+	if !s.noArgs(args, errMalformedHello) {
+		return
+	}
+
+	_ = s.marshal(agent.HelloResponse{
+		ProtocolVersion:    proto.Version,
+		MinProtocolVersion: proto.MinVersion,
+		Version:            buildinfo.Version(),
+		Capabilities:       capabilities(),
+	})
+}
+
+var errMalformedKill = malformedError("kill")
 
 func (s *session) kill(_ context.Context, args ...string) {
 	if !s.noArgs(args, errMalformedKill) {
@@ -132,7 +212,7 @@ func (s *session) kill(_ context.Context, args ...string) {
 	s.srv.shutdown()
 }
 
-var errMalformedPing = errors.New("malformed ping command")
+var errMalformedPing = malformedError("ping")
 
 func (s *session) ping(_ context.Context, args ...string) {
 	if !s.noArgs(args, errMalformedPing) {
@@ -146,14 +226,93 @@ func (s *session) ping(_ context.Context, args ...string) {
 	})
 }
 
-var errMalformedEstablish = errors.New("malformed establish command")
+var errMalformedStatus = malformedError("status")
+
+func (s *session) status(_ context.Context, args ...string) {
+	if !s.noArgs(args, errMalformedStatus) {
+		return
+	}
+
+	_ = s.marshal(s.srv.status())
+}
+
+var errMalformedForward = malformedError("forward")
+
+func (s *session) forward(_ context.Context, args ...string) {
+	if !s.exactArgs(4, args, errMalformedForward) {
+		return
+	}
+
+	if _, _, err := net.SplitHostPort(args[3]); err != nil {
+		s.error(fmt.Errorf("invalid remote address: %w", err))
+
+		return
+	}
+
+	f := &forward{
+		Forward: agent.Forward{
+			Org:       args[0],
+			App:       args[1],
+			Local:     args[2],
+			Remote:    args[3],
+			CreatedAt: time.Now(),
+		},
+	}
+
+	if err := s.srv.startForward(f); err != nil {
+		if !errors.Is(err, errForwardExists) {
+			_ = s.srv.stopForward(f.Local)
+		}
+		s.error(err)
+
+		return
+	}
+
+	if err := s.srv.saveForwards(); err != nil {
+		s.logger.Printf("failed saving forwards: %v", err)
+	}
+
+	_ = s.marshal(f.status())
+}
+
+var errMalformedForwards = malformedError("forwards")
+
+func (s *session) forwards(_ context.Context, args ...string) {
+	if !s.noArgs(args, errMalformedForwards) {
+		return
+	}
+
+	_ = s.marshal(s.srv.listForwards())
+}
+
+var errMalformedUnforward = malformedError("unforward")
+
+func (s *session) unforward(_ context.Context, args ...string) {
+	if !s.exactArgs(1, args, errMalformedUnforward) {
+		return
+	}
+
+	if err := s.srv.stopForward(args[0]); err != nil {
+		s.error(err)
+
+		return
+	}
+
+	if err := s.srv.saveForwards(); err != nil {
+		s.logger.Printf("failed saving forwards: %v", err)
+	}
+
+	_ = s.ok()
+}
+
+var errMalformedEstablish = malformedError("establish")
 
 func (s *session) doEstablish(ctx context.Context, recycle bool, args ...string) {
 	if !s.exactArgs(1, args, errMalformedEstablish) {
 		return
 	}
 
-	org, err := s.fetchOrg(ctx, args[0])
+	org, err := s.srv.fetchOrg(ctx, args[0])
 	if err != nil {
 		s.error(err)
 
@@ -183,8 +342,8 @@ func (s *session) reestablish(ctx context.Context, args ...string) {
 
 var errNoSuchOrg = errors.New("no such organization")
 
-func (s *session) fetchOrg(ctx context.Context, slug string) (*api.Organization, error) {
-	orgs, err := s.srv.Client.GetOrganizations(ctx)
+func (s *server) fetchOrg(ctx context.Context, slug string) (*api.Organization, error) {
+	orgs, err := s.Client.GetOrganizations(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -199,7 +358,7 @@ func (s *session) fetchOrg(ctx context.Context, slug string) (*api.Organization,
 	return nil, errNoSuchOrg
 }
 
-var errMalformedProbe = errors.New("malformed probe command")
+var errMalformedProbe = malformedError("probe")
 
 func (s *session) probe(ctx context.Context, args ...string) {
 	if !s.exactArgs(1, args, errMalformedProbe) {
@@ -215,7 +374,7 @@ func (s *session) probe(ctx context.Context, args ...string) {
 	_ = s.ok()
 }
 
-var errMalformedInstances = errors.New("malformed instances command")
+var errMalformedInstances = malformedError("instances")
 
 func (s *session) instances(ctx context.Context, args ...string) {
 	if !s.exactArgs(2, args, errMalformedInstances) {
@@ -249,7 +408,7 @@ func (s *session) instances(ctx context.Context, args ...string) {
 	_ = s.marshal(ret)
 }
 
-var errMalformedResolve = errors.New("malformed resolve command")
+var errMalformedResolve = malformedError("resolve")
 
 func (s *session) resolve(ctx context.Context, args ...string) {
 	if !s.exactArgs(2, args, errMalformedResolve) {
@@ -309,12 +468,23 @@ func resolve(ctx context.Context, tunnel *wg.Tunnel, addr string) (string, error
 }
 
 var (
-	errMalformedConnect = errors.New("malformed connect command")
-	errDone             = errors.New("done")
+	errMalformedConnect    = malformedError("connect")
+	errMalformedConnectUDP = malformedError("connectudp")
+	errDone                = errors.New("done")
 )
 
 func (s *session) connect(ctx context.Context, args ...string) {
-	if !s.exactArgs(3, args, errMalformedConnect) {
+	s.doConnect(ctx, "tcp", errMalformedConnect, args...)
+}
+
+// connectUDP proxies UDP like connect does TCP, framing the datagrams over the
+// agent connection.
+func (s *session) connectUDP(ctx context.Context, args ...string) {
+	s.doConnect(ctx, "udp", errMalformedConnectUDP, args...)
+}
+
+func (s *session) doConnect(ctx context.Context, network string, errMalformed error, args ...string) {
+	if !s.exactArgs(3, args, errMalformed) {
 		return
 	}
 
@@ -341,7 +511,7 @@ func (s *session) connect(ctx context.Context, args ...string) {
 	}
 	defer cancel()
 
-	outconn, err := tunnel.DialContext(dialContext, "tcp", args[1])
+	outconn, err := tunnel.DialContext(dialContext, network, args[1])
 	if err != nil {
 		s.error(err)
 
@@ -357,6 +527,14 @@ func (s *session) connect(ctx context.Context, args ...string) {
 		return
 	}
 
+	stats, done := s.srv.countConnection(args[0])
+	defer done()
+
+	down, up := io.Copy, io.Copy
+	if network == "udp" {
+		down, up = proto.FrameDatagrams, proto.UnframeDatagrams
+	}
+
 	var eg *errgroup.Group
 	eg, ctx = errgroup.WithContext(ctx)
 
@@ -369,7 +547,10 @@ func (s *session) connect(ctx context.Context, args ...string) {
 	})
 
 	eg.Go(func() (err error) {
-		if _, err = io.Copy(s.conn, outconn); err == nil {
+		var n int64
+		n, err = down(s.conn, outconn)
+		atomic.AddUint64(&stats.bytesReceived, uint64(n))
+		if err == nil {
 			err = io.EOF
 		}
 
@@ -377,7 +558,10 @@ func (s *session) connect(ctx context.Context, args ...string) {
 	})
 
 	eg.Go(func() (err error) {
-		if _, err = io.Copy(outconn, s.conn); err == nil {
+		var n int64
+		n, err = up(outconn, s.conn)
+		atomic.AddUint64(&stats.bytesSent, uint64(n))
+		if err == nil {
 			err = io.EOF
 		}
 
@@ -499,22 +683,111 @@ func (s *session) ping6(ctx context.Context, args ...string) {
 	}
 }
 
+// malformedError is returned for requests with the wrong arguments.
+type malformedError string
+
+func (e malformedError) Error() string {
+	return fmt.Sprintf("malformed %s command", string(e))
+}
+
+// errorCode returns the code the structured protocol reports err with.
+func errorCode(err error) string {
+	var (
+		agentErr  *agent.Error
+		malformed malformedError
+	)
+
+	switch {
+	case errors.As(err, &agentErr):
+		return agentErr.Code
+	case errors.As(err, &malformed):
+		return agent.ErrCodeMalformedRequest
+	case errors.Is(err, errUnsupportedCommand):
+		return agent.ErrCodeUnsupportedMethod
+	case errors.Is(err, agent.ErrTunnelUnavailable):
+		return agent.ErrCodeTunnelUnavailable
+	case errors.Is(err, agent.ErrNoSuchHost):
+		return agent.ErrCodeNoSuchHost
+	case errors.Is(err, errNoSuchOrg):
+		return agent.ErrCodeNoSuchOrg
+	case errors.Is(err, agent.ErrNoSuchForward):
+		return agent.ErrCodeNoSuchForward
+	case errors.Is(err, context.DeadlineExceeded):
+		return agent.ErrCodeTimeout
+	default:
+		return agent.ErrCodeInternal
+	}
+}
+
 func (s *session) error(err error) bool {
+	if s.req != nil {
+		return s.respond(&proto.Response{
+			Error: &proto.Error{
+				Code:    errorCode(err),
+				Message: err.Error(),
+			},
+		})
+	}
+
 	return s.reply("err", err.Error())
 }
 
 func (s *session) ok(args ...string) bool {
+	if s.req != nil {
+		var result interface{}
+		switch len(args) {
+		case 0:
+			break
+		case 1:
+			result = args[0]
+		default:
+			result = args
+		}
+
+		return s.result(result)
+	}
+
 	return s.reply("ok", args...)
 }
 
+// result answers the structured request being served with v.
+func (s *session) result(v interface{}) bool {
+	res := &proto.Response{}
+
+	if v != nil {
+		data, err := json.Marshal(v)
+		if err != nil {
+			return s.error(fmt.Errorf("failed marshaling response: %w", err))
+		}
+		res.Result = data
+	}
+
+	return s.respond(res)
+}
+
+func (s *session) respond(res *proto.Response) bool {
+	res.ID = s.req.ID
+	res.Version = proto.Version
+
+	return s.write(func(w io.Writer) error {
+		return proto.WriteJSON(w, res)
+	})
+}
+
 func (s *session) reply(verb string, args ...string) bool {
+	return s.write(func(w io.Writer) error {
+		return proto.Write(w, verb, args...)
+	})
+}
+
+func (s *session) write(fn func(io.Writer) error) bool {
 	var b bytes.Buffer
 	out := io.MultiWriter(
 		&b,
 		s.conn,
 	)
 
-	err := proto.Write(out, verb, args...)
+	err := fn(out)
 	if l := b.Len(); l > 0 {
 		s.logger.Printf("-> (% 5d) %q", l, redact(b.Bytes()))
 	}
@@ -551,6 +824,10 @@ func (s *session) exactArgs(count int, args []string, err error) bool {
 }
 
 func (s *session) marshal(v interface{}) (ok bool) {
+	if s.req != nil {
+		return s.result(v)
+	}
+
 	var sb strings.Builder
 
 	enc := json.NewEncoder(&sb)
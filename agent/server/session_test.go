@@ -0,0 +1,165 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/superfly/flyctl/agent"
+	"github.com/superfly/flyctl/agent/internal/proto"
+	"github.com/superfly/flyctl/wg"
+)
+
+// newTestServer returns a server without tunnels that doesn't look at the
+// WireGuard state.
+func newTestServer(t *testing.T) *server {
+	t.Helper()
+
+	dir := t.TempDir()
+	configFile := filepath.Join(dir, "config.yml")
+	require.NoError(t, os.WriteFile(configFile, nil, 0o600))
+
+	return &server{
+		Options: Options{
+			Logger:       log.New(io.Discard, "", 0),
+			ConfigFile:   configFile,
+			ForwardsFile: filepath.Join(dir, "forwards.json"),
+		},
+		// later than the config file changed, so that it isn't validated
+		currentChange: time.Now().Add(time.Hour),
+		tunnels:       map[string]*wg.Tunnel{},
+		stats:         map[string]*tunnelStats{},
+		forwards:      map[string]*forward{},
+		startedAt:     time.Now(),
+	}
+}
+
+// roundTrip serves a session on srv for the payload and returns the agent's
+// answer.
+func roundTrip(t *testing.T, srv *server, payload []byte) []byte {
+	t.Helper()
+
+	client, conn := net.Pipe()
+	defer client.Close()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		runSession(context.Background(), srv, conn, 1)
+	}()
+
+	require.NoError(t, proto.WriteFrame(client, payload))
+
+	res, err := proto.Read(client)
+	require.NoError(t, err)
+	<-done
+
+	return res
+}
+
+func structuredRoundTrip(t *testing.T, srv *server, req proto.Request) proto.Response {
+	t.Helper()
+
+	data, err := json.Marshal(req)
+	require.NoError(t, err)
+
+	payload := roundTrip(t, srv, data)
+	require.True(t, proto.IsStructured(payload), string(payload))
+
+	var res proto.Response
+	require.NoError(t, json.Unmarshal(payload, &res))
+
+	return res
+}
+
+func TestLegacySession(t *testing.T) {
+	srv := newTestServer(t)
+
+	res := roundTrip(t, srv, []byte("ping"))
+	require.True(t, strings.HasPrefix(string(res), "ok "), string(res))
+
+	var ping agent.PingResponse
+	require.NoError(t, json.Unmarshal(res[3:], &ping))
+	assert.Equal(t, os.Getpid(), ping.PID)
+
+	assert.Equal(t, "err malformed ping command", string(roundTrip(t, srv, []byte("ping extra"))))
+	assert.Equal(t, "err unsupported command", string(roundTrip(t, srv, []byte("bogus"))))
+}
+
+func TestStructuredSession(t *testing.T) {
+	srv := newTestServer(t)
+
+	res := structuredRoundTrip(t, srv, proto.Request{ID: "1", Version: proto.Version, Method: "hello"})
+	assert.Equal(t, "1", res.ID)
+	assert.Equal(t, proto.Version, res.Version)
+	require.Nil(t, res.Error)
+
+	var hello agent.HelloResponse
+	require.NoError(t, json.Unmarshal(res.Result, &hello))
+	assert.Equal(t, proto.Version, hello.ProtocolVersion)
+	assert.Equal(t, proto.MinVersion, hello.MinProtocolVersion)
+	assert.Contains(t, hello.Capabilities, "hello")
+	assert.Contains(t, hello.Capabilities, "ping")
+	assert.IsIncreasing(t, hello.Capabilities)
+
+	res = structuredRoundTrip(t, srv, proto.Request{ID: "2", Version: proto.Version, Method: "ping"})
+	assert.Equal(t, "2", res.ID)
+	require.Nil(t, res.Error)
+
+	var ping agent.PingResponse
+	require.NoError(t, json.Unmarshal(res.Result, &ping))
+	assert.Equal(t, os.Getpid(), ping.PID)
+
+	for _, c := range []struct {
+		req  proto.Request
+		code string
+	}{
+		{proto.Request{ID: "3", Version: proto.Version, Method: "bogus"}, agent.ErrCodeUnsupportedMethod},
+		{proto.Request{ID: "4", Version: proto.Version + 1, Method: "ping"}, agent.ErrCodeUnsupportedVersion},
+		{proto.Request{ID: "5", Version: proto.Version, Method: "ping", Args: []string{"extra"}}, agent.ErrCodeMalformedRequest},
+		{proto.Request{ID: "6", Version: proto.Version, Method: "unforward", Args: []string{"127.0.0.1:1"}}, agent.ErrCodeNoSuchForward},
+	} {
+		res := structuredRoundTrip(t, srv, c.req)
+		assert.Equal(t, c.req.ID, res.ID)
+		assert.Empty(t, res.Result)
+		if assert.NotNil(t, res.Error, c.req.Method) {
+			assert.Equal(t, c.code, res.Error.Code, c.req.Method)
+			assert.NotEmpty(t, res.Error.Message)
+		}
+	}
+
+	payload := roundTrip(t, srv, []byte(`{"id":`))
+	var res2 proto.Response
+	require.NoError(t, json.Unmarshal(payload, &res2))
+	require.NotNil(t, res2.Error)
+	assert.Equal(t, agent.ErrCodeMalformedRequest, res2.Error.Code)
+}
+
+func TestErrorCode(t *testing.T) {
+	for err, code := range map[error]string{
+		fmt.Errorf("x: %w", agent.ErrTunnelUnavailable):                     agent.ErrCodeTunnelUnavailable,
+		fmt.Errorf("x: %w", agent.ErrNoSuchHost):                            agent.ErrCodeNoSuchHost,
+		fmt.Errorf("x: %w", agent.ErrNoSuchForward):                         agent.ErrCodeNoSuchForward,
+		fmt.Errorf("x: %w", errNoSuchOrg):                                   agent.ErrCodeNoSuchOrg,
+		fmt.Errorf("x: %w", context.DeadlineExceeded):                       agent.ErrCodeTimeout,
+		errUnsupportedCommand:                                               agent.ErrCodeUnsupportedMethod,
+		malformedError("resolve"):                                           agent.ErrCodeMalformedRequest,
+		errUnsupportedVersion:                                               agent.ErrCodeUnsupportedVersion,
+		&agent.Error{Code: "custom", Message: "custom"}:                     "custom",
+		fmt.Errorf("wrapped: %w", &agent.Error{Code: agent.ErrCodeTimeout}): agent.ErrCodeTimeout,
+		io.ErrUnexpectedEOF:                                                 agent.ErrCodeInternal,
+	} {
+		assert.Equal(t, code, errorCode(err), err.Error())
+	}
+}
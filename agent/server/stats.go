@@ -0,0 +1,224 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/superfly/flyctl/agent"
+	"github.com/superfly/flyctl/internal/buildinfo"
+)
+
+// handshakeTimeout is how long WireGuard keeps using a session after its
+// handshake. A peer that hasn't completed a handshake within that long isn't
+// passing traffic anymore.
+const handshakeTimeout = 3 * time.Minute
+
+// tunnelStats are the counters the agent keeps for the tunnel to an org.
+type tunnelStats struct {
+	establishedAt time.Time
+	fallback      bool // whether the agent failed over to a fallback peer
+
+	handshakeLatency int64 // nanoseconds
+	failovers        uint64
+
+	connections      int64
+	totalConnections uint64
+	bytesSent        uint64
+	bytesReceived    uint64
+}
+
+// statsFor returns the counters of the tunnel to the org, if there is one.
+func (s *server) statsFor(slug string) *tunnelStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.stats[slug]
+}
+
+// countConnection accounts for a connection proxied through the tunnel to
+// the org, returning the function to call once it's closed.
+func (s *server) countConnection(slug string) (stats *tunnelStats, done func()) {
+	if stats = s.statsFor(slug); stats == nil {
+		stats = &tunnelStats{} // the tunnel went away; count to nowhere
+	}
+
+	atomic.AddInt64(&stats.connections, 1)
+	atomic.AddUint64(&stats.totalConnections, 1)
+
+	return stats, func() {
+		atomic.AddInt64(&stats.connections, -1)
+	}
+}
+
+func (s *server) status() *agent.StatusResponse {
+	res := &agent.StatusResponse{
+		PID:           os.Getpid(),
+		Version:       buildinfo.Version(),
+		Background:    s.Options.Background,
+		StartedAt:     s.startedAt,
+		Sessions:      atomic.LoadInt64(&s.sessions),
+		TotalSessions: atomic.LoadUint64(&s.totalSessions),
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for slug, tunnel := range s.tunnels {
+		ts := agent.TunnelStatus{
+			Org: slug,
+		}
+
+		if state := tunnel.State; state != nil {
+			ts.Peer = state.Name
+			ts.Region = state.Region
+		}
+
+		if stats := s.stats[slug]; stats != nil {
+			ts.EstablishedAt = stats.establishedAt
+			ts.Fallback = stats.fallback
+			ts.HandshakeLatency = time.Duration(atomic.LoadInt64(&stats.handshakeLatency))
+			ts.Failovers = atomic.LoadUint64(&stats.failovers)
+			ts.Connections = atomic.LoadInt64(&stats.connections)
+			ts.TotalConnections = atomic.LoadUint64(&stats.totalConnections)
+			ts.BytesSent = atomic.LoadUint64(&stats.bytesSent)
+			ts.BytesReceived = atomic.LoadUint64(&stats.bytesReceived)
+		}
+
+		switch peer, err := tunnel.Stats(); {
+		case err != nil:
+			s.printf("failed reading stats of %q: %v", slug, err)
+		default:
+			ts.Endpoint = peer.Endpoint
+			ts.LastHandshake = peer.LastHandshake
+			ts.RxBytes = peer.RxBytes
+			ts.TxBytes = peer.TxBytes
+		}
+
+		switch {
+		case ts.LastHandshake.IsZero():
+			ts.State = agent.TunnelConnecting
+		case time.Since(ts.LastHandshake) > handshakeTimeout:
+			ts.State = agent.TunnelStale
+		default:
+			ts.State = agent.TunnelUp
+		}
+
+		res.Tunnels = append(res.Tunnels, ts)
+	}
+
+	sort.Slice(res.Tunnels, func(i, j int) bool {
+		return res.Tunnels[i].Org < res.Tunnels[j].Org
+	})
+
+	return res
+}
+
+// serveMetrics serves the agent's status in the Prometheus text format on
+// addr until ctx is done.
+func (s *server) serveMetrics(ctx context.Context, addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed binding metrics listener: %w", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		writeMetrics(w, s.status())
+	})
+
+	srv := &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+		_ = srv.Close()
+	}()
+
+	s.printf("serving metrics on http://%s/metrics", l.Addr())
+
+	if err := srv.Serve(l); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	return nil
+}
+
+func writeMetrics(w io.Writer, status *agent.StatusResponse) {
+	metric := func(name, kind, help string) {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+	}
+
+	metric("fly_agent_info", "gauge", "Information about the agent.")
+	fmt.Fprintf(w, "fly_agent_info{version=%q} 1\n", status.Version.String())
+
+	metric("fly_agent_start_time_seconds", "gauge", "When the agent started, in seconds since the epoch.")
+	fmt.Fprintf(w, "fly_agent_start_time_seconds %d\n", status.StartedAt.Unix())
+
+	metric("fly_agent_sessions", "gauge", "Open connections to the agent.")
+	fmt.Fprintf(w, "fly_agent_sessions %d\n", status.Sessions)
+
+	metric("fly_agent_sessions_total", "counter", "Connections to the agent.")
+	fmt.Fprintf(w, "fly_agent_sessions_total %d\n", status.TotalSessions)
+
+	perTunnel := []struct {
+		name, kind, help string
+		value            func(agent.TunnelStatus) float64
+	}{
+		{"fly_agent_tunnel_up", "gauge", "Whether the tunnel completed a WireGuard handshake recently.", func(t agent.TunnelStatus) float64 {
+			if t.State == agent.TunnelUp {
+				return 1
+			}
+			return 0
+		}},
+		{"fly_agent_tunnel_connections", "gauge", "Connections currently proxied through the tunnel.", func(t agent.TunnelStatus) float64 {
+			return float64(t.Connections)
+		}},
+		{"fly_agent_tunnel_connections_total", "counter", "Connections proxied through the tunnel.", func(t agent.TunnelStatus) float64 {
+			return float64(t.TotalConnections)
+		}},
+		{"fly_agent_tunnel_sent_bytes_total", "counter", "Bytes proxied to the organization's network.", func(t agent.TunnelStatus) float64 {
+			return float64(t.BytesSent)
+		}},
+		{"fly_agent_tunnel_received_bytes_total", "counter", "Bytes proxied from the organization's network.", func(t agent.TunnelStatus) float64 {
+			return float64(t.BytesReceived)
+		}},
+		{"fly_agent_wireguard_rx_bytes_total", "counter", "Bytes received from the WireGuard peer.", func(t agent.TunnelStatus) float64 {
+			return float64(t.RxBytes)
+		}},
+		{"fly_agent_wireguard_tx_bytes_total", "counter", "Bytes sent to the WireGuard peer.", func(t agent.TunnelStatus) float64 {
+			return float64(t.TxBytes)
+		}},
+		{"fly_agent_tunnel_handshake_latency_seconds", "gauge", "How long the last WireGuard handshake the agent measured took.", func(t agent.TunnelStatus) float64 {
+			return t.HandshakeLatency.Seconds()
+		}},
+		{"fly_agent_tunnel_failovers_total", "counter", "Failovers to another endpoint or peer.", func(t agent.TunnelStatus) float64 {
+			return float64(t.Failovers)
+		}},
+		{"fly_agent_wireguard_last_handshake_seconds", "gauge", "When the last WireGuard handshake completed, in seconds since the epoch.", func(t agent.TunnelStatus) float64 {
+			if t.LastHandshake.IsZero() {
+				return 0
+			}
+			return float64(t.LastHandshake.Unix())
+		}},
+	}
+
+	for _, m := range perTunnel {
+		metric(m.name, m.kind, m.help)
+
+		for _, t := range status.Tunnels {
+			fmt.Fprintf(w, "%s{org=%q} %s\n", m.name, t.Org, strconv.FormatFloat(m.value(t), 'f', -1, 64))
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/blang/semver"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/superfly/flyctl/agent"
+	"github.com/superfly/flyctl/agent/internal/proto"
+	"github.com/superfly/flyctl/wg"
+)
+
+func TestStatus(t *testing.T) {
+	srv := newTestServer(t)
+	established := time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	// tunnels without a device report no WireGuard stats, so they're
+	// connecting
+	srv.tunnels["acme"] = &wg.Tunnel{State: &wg.WireGuardState{Name: "peer-acme", Region: "ams"}}
+	srv.tunnels["personal"] = &wg.Tunnel{}
+	srv.stats["acme"] = &tunnelStats{
+		establishedAt:    established,
+		fallback:         true,
+		handshakeLatency: int64(40 * time.Millisecond),
+		failovers:        2,
+	}
+
+	srv.sessions, srv.totalSessions = 1, 5
+
+	stats, done := srv.countConnection("acme")
+	stats.bytesSent, stats.bytesReceived = 100, 2000
+	srv.countConnection("acme")
+	done()
+
+	res := structuredRoundTrip(t, srv, proto.Request{ID: "1", Version: proto.Version, Method: "status"})
+	require.Nil(t, res.Error)
+
+	var status agent.StatusResponse
+	require.NoError(t, json.Unmarshal(res.Result, &status))
+	assert.Equal(t, os.Getpid(), status.PID)
+	assert.EqualValues(t, 1, status.Sessions)
+	assert.EqualValues(t, 5, status.TotalSessions)
+
+	require.Len(t, status.Tunnels, 2)
+	assert.Equal(t, agent.TunnelStatus{
+		Org:              "acme",
+		Peer:             "peer-acme",
+		Region:           "ams",
+		State:            agent.TunnelConnecting,
+		EstablishedAt:    established,
+		Fallback:         true,
+		HandshakeLatency: 40 * time.Millisecond,
+		Failovers:        2,
+		Connections:      1,
+		TotalConnections: 2,
+		BytesSent:        100,
+		BytesReceived:    2000,
+	}, status.Tunnels[0])
+	assert.Equal(t, agent.TunnelStatus{Org: "personal", State: agent.TunnelConnecting}, status.Tunnels[1])
+}
+
+func TestWriteMetrics(t *testing.T) {
+	handshake := time.Unix(1685620800, 0)
+
+	var buf bytes.Buffer
+	writeMetrics(&buf, &agent.StatusResponse{
+		Version:       semver.MustParse("0.1.2"),
+		StartedAt:     time.Unix(1685617200, 0),
+		Sessions:      2,
+		TotalSessions: 17,
+		Tunnels: []agent.TunnelStatus{
+			{
+				Org:              "acme",
+				State:            agent.TunnelUp,
+				LastHandshake:    handshake,
+				HandshakeLatency: 1500 * time.Millisecond,
+				Connections:      3,
+				TotalConnections: 12,
+				BytesSent:        1024,
+				BytesReceived:    4096,
+				RxBytes:          5000,
+				TxBytes:          2000,
+				Failovers:        1,
+			},
+			{Org: "personal", State: agent.TunnelStale},
+		},
+	})
+	out := buf.String()
+
+	for _, line := range []string{
+		"# HELP fly_agent_info Information about the agent.",
+		"# TYPE fly_agent_info gauge",
+		`fly_agent_info{version="0.1.2"} 1`,
+		"fly_agent_start_time_seconds 1685617200",
+		"fly_agent_sessions 2",
+		"# TYPE fly_agent_sessions_total counter",
+		"fly_agent_sessions_total 17",
+		`fly_agent_tunnel_up{org="acme"} 1`,
+		`fly_agent_tunnel_up{org="personal"} 0`,
+		`fly_agent_tunnel_connections{org="acme"} 3`,
+		`fly_agent_tunnel_connections_total{org="acme"} 12`,
+		`fly_agent_tunnel_sent_bytes_total{org="acme"} 1024`,
+		`fly_agent_tunnel_received_bytes_total{org="acme"} 4096`,
+		`fly_agent_wireguard_rx_bytes_total{org="acme"} 5000`,
+		`fly_agent_wireguard_tx_bytes_total{org="acme"} 2000`,
+		`fly_agent_tunnel_handshake_latency_seconds{org="acme"} 1.5`,
+		`fly_agent_tunnel_failovers_total{org="acme"} 1`,
+		`fly_agent_wireguard_last_handshake_seconds{org="acme"} 1685620800`,
+		`fly_agent_wireguard_last_handshake_seconds{org="personal"} 0`,
+	} {
+		assert.Contains(t, strings.Split(out, "\n"), line)
+	}
+
+	// every sample follows the HELP and TYPE lines of its metric
+	var metric string
+	for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+		switch {
+		case strings.HasPrefix(line, "# HELP "):
+			metric = strings.Fields(line)[2]
+		case strings.HasPrefix(line, "# TYPE "):
+			assert.Equal(t, metric, strings.Fields(line)[2])
+		default:
+			name, _, _ := strings.Cut(line, " ")
+			name, _, _ = strings.Cut(name, "{")
+			assert.Equal(t, metric, name, line)
+		}
+	}
+}
@@ -18,6 +18,7 @@ const (
 	MachineProcessGroupApp                     = "app"
 	MachineProcessGroupFlyAppReleaseCommand    = "fly_app_release_command"
 	MachineProcessGroupFlyAppConsole           = "fly_app_console"
+	MachineProcessGroupFlyAppTask              = "fly_app_task"
 	MachineStateDestroyed                      = "destroyed"
 	MachineStateDestroying                     = "destroying"
 	MachineStateStarted                        = "started"
@@ -86,6 +87,10 @@ func (m *Machine) IsFlyAppsConsole() bool {
 	return m.IsFlyAppsPlatform() && m.HasProcessGroup(MachineProcessGroupFlyAppConsole)
 }
 
+func (m *Machine) IsFlyAppsTask() bool {
+	return m.IsFlyAppsPlatform() && m.HasProcessGroup(MachineProcessGroupFlyAppTask)
+}
+
 func (m *Machine) IsActive() bool {
 	return m.State != MachineStateDestroyed && m.State != MachineStateDestroying
 }
@@ -173,6 +178,11 @@ type MachineEvent struct {
 	Timestamp int64           `json:"timestamp,omitempty"`
 }
 
+// Time returns the time at which the event was recorded.
+func (e *MachineEvent) Time() time.Time {
+	return time.UnixMilli(e.Timestamp)
+}
+
 type MachineRequest struct {
 	ExitEvent    *MachineExitEvent    `json:"exit_event,omitempty"`
 	MonitorEvent *MachineMonitorEvent `json:"MonitorEvent,omitempty"`
@@ -191,6 +201,14 @@ func (mr *MachineRequest) GetExitCode() (int, error) {
 	}
 }
 
+// returns the ExitEvent from MonitorEvent if it exists, otherwise ExitEvent
+func (mr *MachineRequest) GetExitEvent() *MachineExitEvent {
+	if mr.MonitorEvent != nil && mr.MonitorEvent.ExitEvent != nil {
+		return mr.MonitorEvent.ExitEvent
+	}
+	return mr.ExitEvent
+}
+
 type MachineMonitorEvent struct {
 	ExitEvent *MachineExitEvent `json:"exit_event,omitempty"`
 }
@@ -206,6 +224,30 @@ type MachineExitEvent struct {
 	ExitedAt      time.Time `json:"exited_at,omitempty"`
 }
 
+// Reason returns a human readable explanation of why the machine exited.
+func (e *MachineExitEvent) Reason() string {
+	var reason string
+	switch {
+	case e.OOMKilled:
+		reason = fmt.Sprintf("killed after running out of memory (exit code %d)", e.ExitCode)
+	case e.RequestedStop:
+		reason = fmt.Sprintf("stopped on request (exit code %d)", e.ExitCode)
+	case e.GuestSignal != 0:
+		reason = fmt.Sprintf("killed by signal %d", e.GuestSignal)
+	case e.Signal != 0:
+		reason = fmt.Sprintf("killed by signal %d", e.Signal)
+	case e.ExitCode == 0:
+		reason = "exited successfully"
+	default:
+		reason = fmt.Sprintf("exited with code %d", e.ExitCode)
+	}
+
+	if e.Restarting {
+		reason += ", restarting"
+	}
+	return reason
+}
+
 type StopMachineInput struct {
 	ID      string   `json:"id,omitempty"`
 	Signal  string   `json:"signal,omitempty"`
@@ -157,3 +157,40 @@ func TestMachineGuest_ToSize(t *testing.T) {
 		t.Errorf("want 'unknown', got '%s'", got)
 	}
 }
+
+func TestMachineExitEvent_Reason(t *testing.T) {
+	cases := []struct {
+		event MachineExitEvent
+		want  string
+	}{
+		{MachineExitEvent{}, "exited successfully"},
+		{MachineExitEvent{ExitCode: 2}, "exited with code 2"},
+		{MachineExitEvent{ExitCode: 137, OOMKilled: true}, "killed after running out of memory (exit code 137)"},
+		{MachineExitEvent{ExitCode: 143, RequestedStop: true}, "stopped on request (exit code 143)"},
+		{MachineExitEvent{ExitCode: 1, Signal: 9, Restarting: true}, "killed by signal 9, restarting"},
+	}
+
+	for _, tc := range cases {
+		if got := tc.event.Reason(); got != tc.want {
+			t.Errorf("want '%s', got '%s'", tc.want, got)
+		}
+	}
+}
+
+func TestMachineRequest_GetExitEvent(t *testing.T) {
+	exit := &MachineExitEvent{ExitCode: 1}
+	monitorExit := &MachineExitEvent{ExitCode: 2}
+
+	if got := (&MachineRequest{}).GetExitEvent(); got != nil {
+		t.Errorf("want nil, got %v", got)
+	}
+
+	if got := (&MachineRequest{ExitEvent: exit}).GetExitEvent(); got != exit {
+		t.Errorf("want %v, got %v", exit, got)
+	}
+
+	req := &MachineRequest{ExitEvent: exit, MonitorEvent: &MachineMonitorEvent{ExitEvent: monitorExit}}
+	if got := req.GetExitEvent(); got != monitorExit {
+		t.Errorf("want %v, got %v", monitorExit, got)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"net/http"
 	"net/url"
+	"time"
 )
 
 type getLogsResponse struct {
@@ -19,8 +20,19 @@ type getLogsResponse struct {
 }
 
 func (c *Client) GetAppLogs(ctx context.Context, appName, token, region, instanceID string) (entries []LogEntry, nextToken string, err error) {
+	return c.GetAppLogsSince(ctx, appName, time.Time{}, token, region, instanceID)
+}
+
+// GetAppLogsSince works like GetAppLogs, but asks for the logs from the given
+// time on instead of the most recent ones when token is empty. Callers should
+// check the timestamps of the entries, since the time is only a hint the API
+// may not honor.
+func (c *Client) GetAppLogsSince(ctx context.Context, appName string, since time.Time, token, region, instanceID string) (entries []LogEntry, nextToken string, err error) {
 	data := url.Values{}
 	data.Set("next_token", token)
+	if token == "" && !since.IsZero() {
+		data.Set("start_time", since.UTC().Format(time.RFC3339Nano))
+	}
 	if instanceID != "" {
 		data.Set("instance", instanceID)
 	}
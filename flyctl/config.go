@@ -17,6 +17,9 @@ const (
 
 	ConfigWireGuardState      = "wire_guard_state"
 	ConfigWireGuardWebsockets = "wire_guard_websockets"
+	ConfigWireGuardRegions    = "wire_guard_regions"
+
+	ConfigSSHRecordings = "ssh_recordings"
 
 	ConfigRegistryHost = "registry_host"
 )
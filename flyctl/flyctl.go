@@ -113,7 +113,7 @@ func loadConfig() error {
 	return err
 }
 
-var writeableConfigKeys = []string{ConfigAPIToken, ConfigInstaller, ConfigWireGuardState, ConfigWireGuardWebsockets, BuildKitNodeID}
+var writeableConfigKeys = []string{ConfigAPIToken, ConfigInstaller, ConfigWireGuardState, ConfigWireGuardWebsockets, ConfigWireGuardRegions, ConfigSSHRecordings, BuildKitNodeID}
 
 func SaveConfig() error {
 	out := map[string]interface{}{}
@@ -88,6 +88,28 @@ func (c *Config) ToConsoleMachineConfig() (*api.MachineConfig, error) {
 	return mConfig, nil
 }
 
+func (c *Config) ToTaskMachineConfig(cmd []string) (*api.MachineConfig, error) {
+	mConfig, err := c.ToConsoleMachineConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	mConfig.Init = api.MachineInit{
+		Cmd: cmd,
+	}
+	if c.Experimental != nil {
+		mConfig.Init.Entrypoint = c.Experimental.Entrypoint
+	}
+
+	mConfig.Metadata[api.MachineConfigMetadataKeyFlyProcessGroup] = api.MachineProcessGroupFlyAppTask
+	mConfig.Env["FLY_PROCESS_GROUP"] = api.MachineProcessGroupFlyAppTask
+
+	// StopConfig
+	c.tomachineSetStopConfig(mConfig)
+
+	return mConfig, nil
+}
+
 // updateMachineConfig applies configuration options from the optional MachineConfig passed in, then the base config, into a new MachineConfig
 func (c *Config) updateMachineConfig(src *api.MachineConfig) (*api.MachineConfig, error) {
 	// For flattened app configs there is only one proces name and it is the group it was flattened for
@@ -157,6 +157,28 @@ func TestToReleaseMachineConfig(t *testing.T) {
 	assert.Equal(t, want, got)
 }
 
+func TestToTaskMachineConfig(t *testing.T) {
+	cfg, err := LoadConfig("./testdata/tomachine.toml")
+	require.NoError(t, err)
+
+	want := &api.MachineConfig{
+		Init:        api.MachineInit{Cmd: []string{"rake", "db:seed"}},
+		Env:         map[string]string{"FOO": "BAR", "PRIMARY_REGION": "mia", "FLY_PROCESS_GROUP": "fly_app_task"},
+		Metadata:    map[string]string{"fly_platform_version": "v2", "fly_process_group": "fly_app_task"},
+		AutoDestroy: true,
+		Restart:     api.MachineRestart{Policy: api.MachineRestartPolicyNo},
+		DNS:         &api.DNSConfig{SkipRegistration: true},
+		StopConfig: &api.StopConfig{
+			Timeout: api.MustParseDuration("10s"),
+			Signal:  api.Pointer("SIGTERM"),
+		},
+	}
+
+	got, err := cfg.ToTaskMachineConfig([]string{"rake", "db:seed"})
+	assert.NoError(t, err)
+	assert.Equal(t, want, got)
+}
+
 func TestToMachineConfig_multiProcessGroups(t *testing.T) {
 	cfg, err := LoadConfig("./testdata/tomachine-processgroups.toml")
 	require.NoError(t, err)
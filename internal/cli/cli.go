@@ -66,6 +66,10 @@ func Run(ctx context.Context, io *iostreams.IOStreams, args ...string) int {
 			fmt.Println()
 		}
 
+		if exitCode, ok := flyerr.GetErrorExitCode(err); ok {
+			return exitCode
+		}
+
 		return 1
 	}
 }
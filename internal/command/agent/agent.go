@@ -32,6 +32,7 @@ func New() (cmd *cobra.Command) {
 		newStart(),
 		newStop(),
 		newRestart(),
+		newStatus(),
 	)
 
 	if env.IsTruthy("DEV") {
@@ -31,6 +31,13 @@ func newRun() (cmd *cobra.Command) {
 	cmd.Args = cobra.MaximumNArgs(1)
 	cmd.Aliases = []string{"daemon-start"}
 
+	flag.Add(cmd,
+		flag.String{
+			Name:        "metrics-addr",
+			Description: "Serve metrics in the Prometheus format on this address, e.g. 127.0.0.1:9090. Defaults to $FLY_AGENT_METRICS_ADDR",
+		},
+	)
+
 	return
 }
 
@@ -58,12 +65,20 @@ func run(ctx context.Context) error {
 	}
 	defer unlock()
 
+	metricsAddr := flag.GetString(ctx, "metrics-addr")
+	if metricsAddr == "" {
+		metricsAddr = os.Getenv("FLY_AGENT_METRICS_ADDR")
+	}
+
 	opt := server.Options{
 		Socket:     socketPath(ctx),
 		Logger:     logger,
 		Client:     apiClient.API(),
 		Background: logPath != "",
 		ConfigFile: state.ConfigFile(ctx),
+
+		MetricsAddr:  metricsAddr,
+		ForwardsFile: filepath.Join(state.ConfigDirectory(ctx), "agent-forwards.json"),
 	}
 
 	return server.Run(ctx, opt)
@@ -0,0 +1,118 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/samber/lo"
+	"github.com/spf13/cobra"
+
+	"github.com/superfly/flyctl/agent"
+	"github.com/superfly/flyctl/iostreams"
+
+	"github.com/superfly/flyctl/internal/command"
+	"github.com/superfly/flyctl/internal/config"
+	"github.com/superfly/flyctl/internal/flag"
+	"github.com/superfly/flyctl/internal/format"
+	"github.com/superfly/flyctl/internal/render"
+)
+
+func newStatus() (cmd *cobra.Command) {
+	const (
+		short = "Show the status of the Fly agent"
+		long  = `Show what the Fly agent is doing: its version and uptime, the connections
+made to it, and for each organization it keeps a wireguard tunnel to, the
+state of the tunnel, the connections proxied through it and the statistics of
+its wireguard peer.
+`
+	)
+
+	cmd = command.New("status", short, long, runStatus)
+
+	cmd.Args = cobra.NoArgs
+
+	flag.Add(cmd, flag.JSONOutput())
+	return
+}
+
+func runStatus(ctx context.Context) (err error) {
+	var client *agent.Client
+	if client, err = dial(ctx); err != nil {
+		return
+	}
+
+	var caps []string
+	if caps, err = client.Capabilities(ctx); err != nil {
+		return
+	}
+	if !lo.Contains(caps, "status") {
+		return fmt.Errorf("the running agent doesn't report its status; restart it with 'fly agent restart'")
+	}
+
+	var status agent.StatusResponse
+	if status, err = client.Status(ctx); err != nil {
+		err = fmt.Errorf("failed fetching agent status: %w", err)
+
+		return
+	}
+
+	out := iostreams.FromContext(ctx).Out
+	if config.FromContext(ctx).JSONOutput {
+		return render.JSON(out, status)
+	}
+
+	var buf bytes.Buffer
+
+	fmt.Fprintf(&buf, "%-10s: %d\n", "PID", status.PID)
+	fmt.Fprintf(&buf, "%-10s: %s\n", "Version", status.Version)
+	fmt.Fprintf(&buf, "%-10s: %t\n", "Background", status.Background)
+	fmt.Fprintf(&buf, "%-10s: %s\n", "Uptime", time.Since(status.StartedAt).Round(time.Second))
+	fmt.Fprintf(&buf, "%-10s: %d open, %d total\n", "Sessions", status.Sessions, status.TotalSessions)
+
+	if _, err = buf.WriteTo(out); err != nil {
+		return
+	}
+
+	if len(status.Tunnels) == 0 {
+		fmt.Fprintln(out, "\nNo tunnels established.")
+
+		return
+	}
+
+	rows := make([][]string, 0, len(status.Tunnels))
+	for _, t := range status.Tunnels {
+		handshake := "never"
+		if !t.LastHandshake.IsZero() {
+			handshake = format.RelativeTime(t.LastHandshake)
+		}
+
+		if t.HandshakeLatency > 0 {
+			handshake = fmt.Sprintf("%s (took %v)", handshake, t.HandshakeLatency.Round(time.Millisecond))
+		}
+
+		peer := t.Peer
+		if t.Fallback {
+			peer += " (fallback)"
+		}
+
+		rows = append(rows, []string{
+			t.Org,
+			t.State,
+			peer,
+			t.Region,
+			t.Endpoint,
+			handshake,
+			fmt.Sprintf("%d (%d total)", t.Connections, t.TotalConnections),
+			fmt.Sprintf("%s / %s", humanize.Bytes(t.BytesSent), humanize.Bytes(t.BytesReceived)),
+			fmt.Sprintf("%s / %s", humanize.Bytes(t.TxBytes), humanize.Bytes(t.RxBytes)),
+		})
+	}
+
+	fmt.Fprintln(out)
+
+	return render.Table(out, "Tunnels", rows,
+		"Org", "State", "Peer", "Region", "Endpoint", "Last Handshake", "Connections", "Proxied (out/in)", "WireGuard (tx/rx)")
+}
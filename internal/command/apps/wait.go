@@ -0,0 +1,149 @@
+package apps
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/samber/lo"
+	"github.com/spf13/cobra"
+
+	"github.com/superfly/flyctl/api"
+	"github.com/superfly/flyctl/flaps"
+	"github.com/superfly/flyctl/internal/appconfig"
+	"github.com/superfly/flyctl/internal/command"
+	"github.com/superfly/flyctl/internal/config"
+	"github.com/superfly/flyctl/internal/flag"
+	"github.com/superfly/flyctl/internal/machine"
+	"github.com/superfly/flyctl/internal/render"
+	"github.com/superfly/flyctl/iostreams"
+)
+
+func newWait() *cobra.Command {
+	const (
+		long = `The APPS WAIT command blocks until the machines of an app meet a condition,
+then prints their final state. With --healthy, it waits for the health checks of
+every started machine to pass. With --state, it waits for every machine to reach
+the given state. It fails if the timeout is reached first.
+`
+		short = "Wait for the machines of an app to meet a condition"
+		usage = "wait"
+	)
+
+	cmd := command.New(usage, short, long, runWait,
+		command.RequireSession,
+		command.RequireAppName,
+	)
+	cmd.Args = cobra.NoArgs
+
+	flag.Add(cmd,
+		flag.App(),
+		flag.AppConfig(),
+		flag.JSONOutput(),
+		flag.Bool{
+			Name:        "healthy",
+			Description: "Wait for the health checks of all started machines to pass",
+		},
+		flag.String{
+			Name:        "state",
+			Description: "Wait for all machines to reach this state (started or stopped)",
+		},
+		flag.String{
+			Name:        "process-group",
+			Description: "Only wait for machines in this process group",
+		},
+		flag.Duration{
+			Name:        "timeout",
+			Description: "How long to wait for the condition to be met",
+			Default:     5 * time.Minute,
+		},
+	)
+
+	return cmd
+}
+
+func runWait(ctx context.Context) error {
+	var (
+		io      = iostreams.FromContext(ctx)
+		json    = config.FromContext(ctx).JSONOutput
+		appName = appconfig.NameFromContext(ctx)
+		healthy = flag.GetBool(ctx, "healthy")
+		state   = flag.GetString(ctx, "state")
+		group   = flag.GetString(ctx, "process-group")
+	)
+
+	switch {
+	case !healthy && state == "":
+		return errors.New("a condition must be given with --healthy or --state")
+	case state != "" && state != api.MachineStateStarted && state != api.MachineStateStopped:
+		return fmt.Errorf("invalid state '%s', must be started or stopped", state)
+	}
+
+	flapsClient, err := flaps.NewFromAppName(ctx, appName)
+	if err != nil {
+		return fmt.Errorf("could not create flaps client: %w", err)
+	}
+	ctx = flaps.NewContext(ctx, flapsClient)
+
+	machines, err := flapsClient.ListActive(ctx)
+	if err != nil {
+		return fmt.Errorf("could not get a list of machines: %w", err)
+	}
+	if group != "" {
+		machines = lo.Filter(machines, func(m *api.Machine, _ int) bool {
+			return m.ProcessGroup() == group
+		})
+	}
+	if len(machines) == 0 {
+		return fmt.Errorf("the app %s has no machines to wait for", appName)
+	}
+
+	deadline := time.Now().Add(flag.GetDuration(ctx, "timeout"))
+	ctx, cancel := context.WithDeadline(ctx, deadline)
+	defer cancel()
+
+	for i, m := range machines {
+		if state != "" {
+			if machines[i], err = machine.WaitForState(ctx, m.ID, state); err != nil {
+				return timeoutOr(ctx, err, "machine %s to be %s", m.ID, state)
+			}
+		}
+
+		if healthy && machines[i].State == api.MachineStateStarted {
+			lm := machine.NewLeasableMachine(flapsClient, io, machines[i])
+			if err := lm.WaitForHealthchecksToPass(ctx, time.Until(deadline), ""); err != nil {
+				return timeoutOr(ctx, err, "health checks of machine %s to pass", m.ID)
+			}
+		}
+	}
+
+	// Report the state the machines ended up in, including their checks.
+	ids := lo.Map(machines, func(m *api.Machine, _ int) string { return m.ID })
+	if machines, err = flapsClient.GetMany(ctx, ids); err != nil {
+		return fmt.Errorf("could not get machines: %w", err)
+	}
+
+	if json {
+		return render.JSON(io.Out, machines)
+	}
+
+	rows := [][]string{}
+	for _, m := range machines {
+		rows = append(rows, []string{
+			m.ID,
+			m.ProcessGroup(),
+			m.Region,
+			m.State,
+			render.MachineHealthChecksSummary(m),
+		})
+	}
+	return render.Table(io.Out, "", rows, "ID", "Process Group", "Region", "State", "Checks")
+}
+
+func timeoutOr(ctx context.Context, err error, format string, a ...interface{}) error {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("timeout reached waiting for %s: %w", fmt.Sprintf(format, a...), ctx.Err())
+	}
+	return err
+}
@@ -347,6 +347,11 @@ func loadConfig(ctx context.Context) (context.Context, error) {
 		return nil, err
 	}
 
+	// Apply credentials kept out of the config file, if so configured
+	if err := cfg.ApplyCredentials(path); err != nil {
+		logger.Warnf("failed loading credentials: %v", err)
+	}
+
 	// Apply config from the environment, overriding anything from the file
 	cfg.ApplyEnv()
 
@@ -18,6 +18,7 @@ import (
 	"github.com/superfly/flyctl/internal/command"
 	"github.com/superfly/flyctl/internal/command/ssh"
 	"github.com/superfly/flyctl/internal/flag"
+	"github.com/superfly/flyctl/internal/machine"
 	"github.com/superfly/flyctl/internal/prompt"
 	"github.com/superfly/flyctl/internal/spinner"
 	"github.com/superfly/flyctl/iostreams"
@@ -31,7 +32,9 @@ func New() *cobra.Command {
 		long  = "Run a console in a new or existing machine. The console command is\n" +
 			"specified by the `console_command` configuration field. By default, a\n" +
 			"new machine is created by default using the app's most recently deployed\n" +
-			"image. An existing machine can be used instead with --machine."
+			"image. An existing machine can be used instead with --machine, or the\n" +
+			"started machine that --process-group and --select-meta select; a selection\n" +
+			"that matches more than one machine is an error."
 	)
 	cmd := command.New(usage, short, long, runConsole, command.RequireSession, command.RequireAppName)
 
@@ -45,10 +48,6 @@ func New() *cobra.Command {
 			Description: "How many CPUs to give the new machine",
 			Aliases:     []string{"cpus"},
 		},
-		flag.String{
-			Name:        "machine",
-			Description: "Run the console in the existing machine with the specified ID",
-		},
 		flag.Int{
 			Name:        "vm-memory",
 			Description: "How much memory (in MB) to give the new machine",
@@ -70,6 +69,7 @@ func New() *cobra.Command {
 			Description: "Unix username to connect as",
 			Default:     ssh.DefaultSshUsername,
 		},
+		machine.SelectFlags,
 	)
 
 	return cmd
@@ -165,10 +165,18 @@ func runConsole(ctx context.Context) error {
 }
 
 func selectMachine(ctx context.Context, app *api.AppCompact, appConfig *appconfig.Config) (*api.Machine, bool, error) {
+	selector, err := machine.SelectorFromFlags(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+
 	if flag.GetBool(ctx, "select") {
+		if selector != nil {
+			return nil, false, errors.New("--machine, --process-group and --select-meta can't be used with -s/--select")
+		}
 		return promptForMachine(ctx, app, appConfig)
-	} else if flag.IsSpecified(ctx, "machine") {
-		return getMachineByID(ctx)
+	} else if selector != nil {
+		return getSelectedMachine(ctx, selector)
 	} else {
 		guest, err := determineEphemeralConsoleMachineGuest(ctx)
 		if err != nil {
@@ -179,10 +187,6 @@ func selectMachine(ctx context.Context, app *api.AppCompact, appConfig *appconfi
 }
 
 func promptForMachine(ctx context.Context, app *api.AppCompact, appConfig *appconfig.Config) (*api.Machine, bool, error) {
-	if flag.IsSpecified(ctx, "machine") {
-		return nil, false, errors.New("--machine can't be used with -s/--select")
-	}
-
 	flapsClient := flaps.FromContext(ctx)
 	machines, err := flapsClient.ListActive(ctx)
 	if err != nil {
@@ -215,28 +219,23 @@ func promptForMachine(ctx context.Context, app *api.AppCompact, appConfig *appco
 	}
 }
 
-func getMachineByID(ctx context.Context) (*api.Machine, bool, error) {
+func getSelectedMachine(ctx context.Context, selector *machine.Selector) (*api.Machine, bool, error) {
 	if flag.IsSpecified(ctx, "vm-cpus") {
-		return nil, false, errors.New("--vm-cpus can't be used with --machine")
+		return nil, false, errors.New("--vm-cpus can't be used with --machine, --process-group or --select-meta")
 	}
 	if flag.IsSpecified(ctx, "vm-memory") {
-		return nil, false, errors.New("--vm-memory can't be used with --machine")
+		return nil, false, errors.New("--vm-memory can't be used with --machine, --process-group or --select-meta")
 	}
 
-	flapsClient := flaps.FromContext(ctx)
-	machineID := flag.GetString(ctx, "machine")
-	machine, err := flapsClient.Get(ctx, machineID)
+	m, err := selector.SelectOne(ctx, flaps.FromContext(ctx))
 	if err != nil {
 		return nil, false, err
 	}
-	if machine.State != api.MachineStateStarted {
-		return nil, false, fmt.Errorf("machine %s is not started", machineID)
-	}
-	if machine.IsFlyAppsReleaseCommand() {
-		return nil, false, fmt.Errorf("machine %s is a release command machine", machineID)
+	if m.IsFlyAppsReleaseCommand() {
+		return nil, false, fmt.Errorf("machine %s is a release command machine", m.ID)
 	}
 
-	return machine, false, nil
+	return m, false, nil
 }
 
 func makeEphemeralConsoleMachine(ctx context.Context, app *api.AppCompact, appConfig *appconfig.Config, guest *api.MachineGuest) (*api.Machine, bool, error) {
@@ -69,6 +69,10 @@ var CommonFlags = flag.Set{
 		Description: "Seconds to lease individual machines while running deployment. All machines are leased at the beginning and released at the end. The lease is refreshed periodically for this same time, which is why it is short. flyctl releases leases in most cases.",
 		Default:     int(DefaultLeaseTtl.Seconds()),
 	},
+	flag.Bool{
+		Name:        "steal-stale-leases",
+		Description: "Release leases you hold on the app's machines that are no longer being refreshed, such as those left behind by an interrupted deployment. Leases are taken to have been acquired with this deployment's --lease-timeout, so those of a deployment of yours running with a shorter one can look stale and be released",
+	},
 	flag.Bool{
 		Name:        "force-nomad",
 		Description: "(Deprecated) Use the Apps v1 platform built with Nomad",
@@ -247,6 +251,7 @@ func deployToMachines(ctx context.Context, appConfig *appconfig.Config, appCompa
 		SkipHealthChecks:      flag.GetDetach(ctx),
 		WaitTimeout:           time.Duration(flag.GetInt(ctx, "wait-timeout")) * time.Second,
 		LeaseTimeout:          time.Duration(flag.GetInt(ctx, "lease-timeout")) * time.Second,
+		StealStaleLeases:      flag.GetBool(ctx, "steal-stale-leases"),
 		ReleaseCmdTimeout:     releaseCmdTimeout,
 		VMSize:                flag.GetString(ctx, "vm-size"),
 		VMCPUs:                flag.GetInt(ctx, "vm-cpus"),
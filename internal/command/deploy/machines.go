@@ -43,6 +43,7 @@ type MachineDeploymentArgs struct {
 	RestartOnly           bool
 	WaitTimeout           time.Duration
 	LeaseTimeout          time.Duration
+	StealStaleLeases      bool
 	ReleaseCmdTimeout     time.Duration
 	VMSize                string
 	VMCPUs                int
@@ -73,6 +74,7 @@ type machineDeployment struct {
 	waitTimeout           time.Duration
 	leaseTimeout          time.Duration
 	leaseDelayBetween     time.Duration
+	stealStaleLeases      bool
 	releaseCmdTimeout     time.Duration
 	isFirstDeploy         bool
 	machineGuest          *api.MachineGuest
@@ -142,6 +144,7 @@ func NewMachineDeployment(ctx context.Context, args MachineDeploymentArgs) (Mach
 		waitTimeout:           waitTimeout,
 		leaseTimeout:          leaseTimeout,
 		leaseDelayBetween:     leaseDelayBetween,
+		stealStaleLeases:      args.StealStaleLeases,
 		releaseCmdTimeout:     args.ReleaseCmdTimeout,
 		increasedAvailability: args.IncreasedAvailability,
 		listenAddressChecked:  make(map[string]struct{}),
@@ -232,6 +235,49 @@ func (md *machineDeployment) setMachinesForDeployment(ctx context.Context) error
 	return nil
 }
 
+// releaseStaleLeases releases the leases held by the current user on the
+// machines about to be deployed that aren't being refreshed anymore, typically
+// left behind by a deployment that was interrupted. Leases held by anyone else
+// are only reported, since they may belong to a deployment still in progress.
+func (md *machineDeployment) releaseStaleLeases(ctx context.Context) error {
+	if !md.stealStaleLeases || md.machineSet.IsEmpty() {
+		return nil
+	}
+
+	user, err := md.apiClient.GetCurrentUser(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get current user: %w", err)
+	}
+
+	machineIDs := lo.Map(md.machineSet.GetMachines(), func(lm machine.LeasableMachine, _ int) string {
+		return lm.Machine().ID
+	})
+
+	// A running deployment refreshes its leases every leaseDelayBetween, so one
+	// that missed two refreshes in a row is taken to be gone.
+	olderThan := 2 * md.leaseDelayBetween
+
+	leases, err := machine.FindStaleLeases(ctx, machineIDs, olderThan, md.leaseTimeout)
+	if err != nil {
+		return fmt.Errorf("failed to look for stale leases: %w", err)
+	}
+
+	for machineID, lease := range leases {
+		if lease.Data.Owner != user.Email {
+			terminal.Warnf("Not releasing the stale lease on machine %s as it is held by %s\n", machineID, lease.Data.Owner)
+			continue
+		}
+
+		fmt.Fprintf(md.io.ErrOut, "  Releasing stale lease on machine %s, expiring at %s\n",
+			md.colorize.Bold(machineID), time.Unix(lease.Data.ExpiresAt, 0).Format(time.RFC3339))
+		if err := md.flapsClient.ReleaseLease(ctx, machineID, lease.Data.Nonce); err != nil {
+			return fmt.Errorf("failed to release stale lease on machine %s: %w", machineID, err)
+		}
+	}
+
+	return nil
+}
+
 func (md *machineDeployment) setVolumes(ctx context.Context) error {
 	if len(md.appConfig.Mounts) == 0 {
 		return nil
@@ -66,6 +66,9 @@ func (md *machineDeployment) DeployMachinesApp(ctx context.Context) error {
 
 // restartMachinesApp only restarts existing machines but updates their release metadata
 func (md *machineDeployment) restartMachinesApp(ctx context.Context) error {
+	if err := md.releaseStaleLeases(ctx); err != nil {
+		return err
+	}
 	if err := md.machineSet.AcquireLeases(ctx, md.leaseTimeout); err != nil {
 		return err
 	}
@@ -109,6 +112,9 @@ func (md *machineDeployment) deployMachinesApp(ctx context.Context) error {
 		return fmt.Errorf("release command failed - aborting deployment. %w", err)
 	}
 
+	if err := md.releaseStaleLeases(ctx); err != nil {
+		return err
+	}
 	if err := md.machineSet.AcquireLeases(ctx, md.leaseTimeout); err != nil {
 		return err
 	}
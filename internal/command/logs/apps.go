@@ -0,0 +1,98 @@
+package logs
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/samber/lo"
+
+	"github.com/superfly/flyctl/client"
+	"github.com/superfly/flyctl/internal/appconfig"
+	"github.com/superfly/flyctl/internal/command"
+	"github.com/superfly/flyctl/internal/flag"
+)
+
+// sourceFlags select the apps and instances whose logs are shown.
+var sourceFlags = flag.Set{
+	flag.StringArray{
+		Name:        flag.AppName,
+		Shorthand:   "a",
+		Description: "Application name. Can be repeated to show the logs of several apps",
+	},
+	flag.String{
+		Name:        flag.OrgName,
+		Description: "Show the logs of the apps of this organization, optionally narrowed down with --app, which accepts globs",
+	},
+	flag.AppConfig(),
+	flag.Region(),
+	flag.String{
+		Name:        "instance",
+		Shorthand:   "i",
+		Description: "Filter by instance ID",
+	},
+}
+
+// appNames returns the apps whose logs should be shown. Without --org, those
+// are the apps given with --app, or the app the current directory belongs to.
+// With --org, they're the apps of the organization matching the names given
+// with --app, which can be globs.
+func appNames(ctx context.Context) ([]string, error) {
+	var (
+		patterns = flag.GetStringArray(ctx, flag.AppName)
+		orgSlug  = flag.GetString(ctx, flag.OrgName)
+	)
+
+	if orgSlug == "" {
+		for _, p := range patterns {
+			if strings.ContainsAny(p, "*?[") {
+				return nil, fmt.Errorf("app name globs such as %q can only be used with --org", p)
+			}
+		}
+		if len(patterns) > 0 {
+			return lo.Uniq(patterns), nil
+		}
+		if name := appconfig.NameFromContext(ctx); name != "" {
+			return []string{name}, nil
+		}
+		return nil, command.ErrRequireAppName
+	}
+
+	if len(patterns) == 0 {
+		patterns = []string{"*"}
+	}
+	for _, p := range patterns {
+		if _, err := path.Match(p, ""); err != nil {
+			return nil, fmt.Errorf("invalid app name glob %q: %w", p, err)
+		}
+	}
+
+	apiClient := client.FromContext(ctx).API()
+	org, err := apiClient.GetOrganizationBySlug(ctx, orgSlug)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get organization %s: %w", orgSlug, err)
+	}
+
+	apps, err := apiClient.GetAppsForOrganization(ctx, org.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list the apps of organization %s: %w", orgSlug, err)
+	}
+
+	var names []string
+	for _, app := range apps {
+		for _, p := range patterns {
+			if ok, _ := path.Match(p, app.Name); ok {
+				names = append(names, app.Name)
+				break
+			}
+		}
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("no app of organization %s matches %s", orgSlug, strings.Join(patterns, ", "))
+	}
+
+	sort.Strings(names)
+	return names, nil
+}
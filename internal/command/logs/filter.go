@@ -0,0 +1,122 @@
+package logs
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+
+	"github.com/samber/lo"
+
+	"github.com/superfly/flyctl/api"
+	"github.com/superfly/flyctl/flaps"
+	"github.com/superfly/flyctl/internal/flag"
+	"github.com/superfly/flyctl/logs"
+)
+
+var filterFlags = flag.Set{
+	flag.StringSlice{
+		Name:        "level",
+		Description: "Only show logs with these levels (e.g. error,warn)",
+	},
+	flag.String{
+		Name:        "process-group",
+		Description: "Only show logs of the machines in this process group",
+	},
+	flag.String{
+		Name:        "grep",
+		Description: "Only show logs whose message matches this regular expression",
+	},
+	flag.String{
+		Name:        "exclude",
+		Description: "Hide logs whose message matches this regular expression",
+	},
+	flag.StringSlice{
+		Name:        "status",
+		Description: "Only show HTTP request logs with these response statuses (e.g. 404, 5xx or 500-503)",
+	},
+	flag.StringArray{
+		Name:        "where",
+		Description: "Only show JSON logs with a matching field (e.g. msg.user_id=42 or msg.method!=GET). Can be repeated",
+	},
+}
+
+// newFilter builds the log filter described by the filter flags. It returns
+// nil when none of them are set.
+func newFilter(ctx context.Context, appNames []string) (*logs.Filter, error) {
+	var (
+		filter = &logs.Filter{Levels: flag.GetStringSlice(ctx, "level")}
+		empty  = true
+		err    error
+	)
+
+	if len(filter.Levels) > 0 {
+		empty = false
+	}
+
+	if group := flag.GetString(ctx, "process-group"); group != "" {
+		for _, appName := range appNames {
+			ids, err := processGroupMachineIDs(ctx, appName, group)
+			if err != nil {
+				return nil, err
+			}
+			filter.Instances = append(filter.Instances, ids...)
+		}
+		if len(filter.Instances) == 0 {
+			return nil, fmt.Errorf("no machines found in process group %s", group)
+		}
+		empty = false
+	}
+
+	if expr := flag.GetString(ctx, "grep"); expr != "" {
+		if filter.Grep, err = regexp.Compile(expr); err != nil {
+			return nil, fmt.Errorf("invalid --grep expression: %w", err)
+		}
+		empty = false
+	}
+
+	if expr := flag.GetString(ctx, "exclude"); expr != "" {
+		if filter.Exclude, err = regexp.Compile(expr); err != nil {
+			return nil, fmt.Errorf("invalid --exclude expression: %w", err)
+		}
+		empty = false
+	}
+
+	for _, s := range flag.GetStringSlice(ctx, "status") {
+		status, err := logs.ParseStatusRange(s)
+		if err != nil {
+			return nil, err
+		}
+		filter.Statuses = append(filter.Statuses, status)
+		empty = false
+	}
+
+	for _, s := range flag.GetStringArray(ctx, "where") {
+		field, err := logs.ParseFieldFilter(s)
+		if err != nil {
+			return nil, err
+		}
+		filter.Fields = append(filter.Fields, field)
+		empty = false
+	}
+
+	if empty {
+		return nil, nil
+	}
+	return filter, nil
+}
+
+func processGroupMachineIDs(ctx context.Context, appName, group string) ([]string, error) {
+	flapsClient, err := flaps.NewFromAppName(ctx, appName)
+	if err != nil {
+		return nil, fmt.Errorf("could not create flaps client: %w", err)
+	}
+
+	machines, err := flapsClient.List(ctx, "")
+	if err != nil {
+		return nil, fmt.Errorf("could not get a list of machines: %w", err)
+	}
+
+	return lo.FilterMap(machines, func(m *api.Machine, _ int) (string, bool) {
+		return m.ID, m.ProcessGroup() == group
+	}), nil
+}
@@ -3,8 +3,12 @@ package logs
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
+	"os"
+	"sync"
 	"time"
 
 	"github.com/azazeal/pause"
@@ -16,12 +20,12 @@ import (
 	"github.com/superfly/flyctl/logs"
 
 	"github.com/superfly/flyctl/client"
-	"github.com/superfly/flyctl/internal/appconfig"
 	"github.com/superfly/flyctl/internal/command"
 	"github.com/superfly/flyctl/internal/config"
 	"github.com/superfly/flyctl/internal/flag"
 	"github.com/superfly/flyctl/internal/logger"
 	"github.com/superfly/flyctl/internal/render"
+	"github.com/superfly/flyctl/terminal"
 )
 
 func New() (cmd *cobra.Command) {
@@ -29,55 +33,303 @@ func New() (cmd *cobra.Command) {
 		long = `View application logs as generated by the application running on
 the Fly platform.
 
+The logs of several apps can be shown together by repeating --app/-a, or with
+--org to show the logs of the apps of an organization whose names match the
+globs given with --app (e.g. --org acme -a 'shop-*'). Each line is then
+prefixed with the name of its app.
+
 Logs can be filtered to a specific instance using the --instance/-i flag or
 to all instances running in a specific region using the --region/-r flag.
+
+Logs can be further narrowed down by level, process group, message contents
+(--grep and --exclude), HTTP response status, or fields of JSON formatted
+messages (--where msg.user_id=42).
+
+Past logs can be fetched with --since and --until, which accept either a
+duration relative to now (e.g. 2h) or an RFC 3339 timestamp. With --no-tail,
+or when --until is given, flyctl exits once the window has been printed
+instead of following new logs. flyctl warns when the logs it gets don't go back
+to the start of the window. --output writes the logs to a file as
+newline-delimited JSON.
+
+--sink sends the logs to other destinations as well, so that flyctl can act as
+a log shipper:
+
+  file:<path>                     newline-delimited JSON, rotated once the file
+                                  reaches max-size (default 100MB), keeping
+                                  max-files rotated files (default 5), e.g.
+                                  file:app.log?max-size=10MB&max-files=3
+  syslog+tcp://<host>:<port>      RFC 5424 syslog, over TCP or UDP
+  syslog+udp://<host>:<port>
+  http(s)://<url>                 batches of entries POSTed as a JSON array
+  loki+http(s)://<host>:<port>    Loki's push API
+
+Entries are sent in batches, retried a few times when the destination is
+unavailable. Batches that still fail, or that the destination rejects, are
+dropped and reported.
+
+--format changes the layout of the log lines. Besides the default one, "short"
+only shows the time, level and message, and "logfmt" prints key=value pairs.
+Any other value is used as a Go template, which can refer to the fields of the
+log entry (.Timestamp, .App, .Region, .Instance, .Level, .Message and .Meta),
+.Time, the timestamp as a time.Time, and the json, upper, lower and pad
+functions, e.g. '{{.Time.Format "15:04:05"}} {{pad 5 .Level}} {{.Message}}'.
 `
 		short = "View app logs"
 	)
 
 	cmd = command.New("logs", short, long, run,
 		command.RequireSession,
-		command.RequireAppName,
+		command.LoadAppNameIfPresent,
 	)
 
 	cmd.Args = cobra.NoArgs
 
 	flag.Add(cmd,
-		flag.App(),
-		flag.AppConfig(),
-		flag.Region(),
+		sourceFlags,
 		flag.JSONOutput(),
+		filterFlags,
+		flag.String{
+			Name:        "since",
+			Description: "Show logs emitted since this time",
+		},
+		flag.String{
+			Name:        "until",
+			Description: "Show logs emitted until this time, then exit",
+		},
+		flag.Bool{
+			Name:        "no-tail",
+			Description: "Exit once past logs have been printed instead of following new ones",
+		},
 		flag.String{
-			Name:        "instance",
-			Shorthand:   "i",
-			Description: "Filter by instance ID",
+			Name:        "output",
+			Shorthand:   "o",
+			Description: "Write the logs to this file as newline-delimited JSON",
+		},
+		flag.String{
+			Name:        "format",
+			Description: "Format of the log lines: default, short, logfmt or a Go template such as '{{.Timestamp}} {{.Region}} {{.Message}}'",
+		},
+		flag.Bool{
+			Name:        "local-time",
+			Description: "Show timestamps in the local timezone instead of UTC",
+		},
+		flag.Bool{
+			Name:        "pretty",
+			Description: "Indent messages that are JSON objects and highlight their keys",
+		},
+		flag.StringArray{
+			Name:        "sink",
+			Description: "Also send the logs to this destination (file:<path>, syslog+tcp://<host>:<port>, syslog+udp://<host>:<port>, http(s)://<url> or loki+http(s)://<host>:<port>). Can be repeated",
 		},
 	)
-	cmd.AddCommand(newShip(), newUnship(), newDashboard())
+	cmd.AddCommand(newShip(), newUnship(), newDashboard(), newWatch())
 	return
 }
 
 func run(ctx context.Context) error {
 	client := client.FromContext(ctx).API()
 
-	opts := &logs.LogOptions{
-		AppName:    appconfig.NameFromContext(ctx),
-		RegionCode: config.FromContext(ctx).Region,
-		VMID:       flag.GetString(ctx, "instance"),
+	opts, err := logOptions(ctx)
+	if err != nil {
+		return err
+	}
+
+	var (
+		now    = time.Now()
+		since  time.Time
+		until  time.Time
+		noTail = flag.GetBool(ctx, "no-tail")
+	)
+	if s := flag.GetString(ctx, "since"); s != "" {
+		if since, err = parseLogTime(s, now); err != nil {
+			return fmt.Errorf("invalid --since: %w", err)
+		}
+	}
+	if s := flag.GetString(ctx, "until"); s != "" {
+		if until, err = parseLogTime(s, now); err != nil {
+			return fmt.Errorf("invalid --until: %w", err)
+		}
+		noTail = true
+	}
+	if !since.IsZero() && !until.IsZero() && until.Before(since) {
+		return errors.New("--until must be after --since")
+	}
+
+	p := &printer{
+		w:    iostreams.FromContext(ctx).Out,
+		json: config.FromContext(ctx).JSONOutput,
+	}
+
+	if format := flag.GetString(ctx, "format"); format != "" && p.json {
+		return errors.New("--format can't be used with --json")
+	}
+	if p.format, err = render.LogFormat(flag.GetString(ctx, "format")); err != nil {
+		return err
+	}
+	p.renderOpts = []render.LogOption{
+		render.HideAllocID(),
+		render.RemoveNewlines(),
+		render.HideRegion(),
+	}
+	if len(opts) > 1 {
+		p.renderOpts = append(p.renderOpts, render.ShowApp())
+	}
+	if flag.GetBool(ctx, "local-time") {
+		p.renderOpts = append(p.renderOpts, render.LocalTime())
+	}
+	if flag.GetBool(ctx, "pretty") {
+		p.renderOpts = append(p.renderOpts, render.PrettyJSON())
+	}
+	if path := flag.GetString(ctx, "output"); path != "" {
+		f, err := os.Create(path)
+		if err != nil {
+			return fmt.Errorf("failed to create log file: %w", err)
+		}
+		defer f.Close() // skipcq: GO-S2307
+
+		p.w = f
+		p.ndjson = true
+	}
+
+	for _, spec := range flag.GetStringArray(ctx, "sink") {
+		sink, err := logs.NewSink(spec, opts[0].AppName, iostreams.FromContext(ctx).ErrOut)
+		if err != nil {
+			return err
+		}
+		p.sinks = append(p.sinks, sink)
+	}
+	defer p.closeSinks()
+
+	if noTail || !since.IsZero() {
+		last, err := printHistory(ctx, p, client, opts, since, until)
+		if err != nil || noTail {
+			return err
+		}
+
+		// Don't print again what we've fetched once we start following.
+		for _, o := range opts {
+			if t, ok := last[o.AppName]; ok {
+				tailFilter := logs.Filter{}
+				if o.Filter != nil {
+					tailFilter = *o.Filter
+				}
+				tailFilter.After = t
+				o.Filter = &tailFilter
+			}
+		}
 	}
 
 	var eg *errgroup.Group
 	eg, ctx = errgroup.WithContext(ctx)
 
+	streams := follow(ctx, eg, client, opts)
+	eg.Go(func() error {
+		return p.printStreams(ctx, streams...)
+	})
+
+	return eg.Wait()
+}
+
+// follow streams the logs of the apps as they're emitted, over NATS or by
+// polling the API as a fallback. The logs of several apps are merged into a
+// single stream ordered by timestamp.
+func follow(ctx context.Context, eg *errgroup.Group, client *api.Client, opts []*logs.LogOptions) []<-chan logs.LogEntry {
 	pollingCtx, cancelPolling := context.WithCancel(ctx)
-	pollEntries := poll(pollingCtx, eg, client, opts)
-	liveEntries := nats(ctx, eg, client, opts, cancelPolling)
+
+	var streams []<-chan logs.LogEntry
+	for _, o := range opts {
+		streams = append(streams, poll(pollingCtx, eg, client, o))
+	}
+	streams = append(streams, nats(ctx, eg, client, opts, cancelPolling))
+
+	if len(opts) > 1 {
+		streams = []<-chan logs.LogEntry{mergeLive(ctx, time.Second, streams...)}
+	}
+	return streams
+}
+
+// logOptions returns the options to stream the logs of each of the apps
+// selected by the flags.
+func logOptions(ctx context.Context) ([]*logs.LogOptions, error) {
+	apps, err := appNames(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	filter, err := newFilter(ctx, apps)
+	if err != nil {
+		return nil, err
+	}
+
+	var opts []*logs.LogOptions
+	for _, app := range apps {
+		opts = append(opts, &logs.LogOptions{
+			AppName:    app,
+			RegionCode: config.FromContext(ctx).Region,
+			VMID:       flag.GetString(ctx, "instance"),
+			Filter:     filter,
+		})
+	}
+	return opts, nil
+}
+
+// parseLogTime parses either a duration relative to now or an RFC 3339
+// timestamp.
+func parseLogTime(value string, now time.Time) (time.Time, error) {
+	if d, err := time.ParseDuration(value); err == nil {
+		return now.Add(-d), nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%q is neither a duration nor an RFC 3339 timestamp", value)
+	}
+	return t, nil
+}
+
+// printHistory prints the logs emitted between since and until and returns
+// the time of the last one printed for each app. It warns when logs at the
+// start of the window may be missing.
+func printHistory(ctx context.Context, p *printer, client *api.Client, opts []*logs.LogOptions, since, until time.Time) (map[string]time.Time, error) {
+	var (
+		streams []<-chan logs.LogEntry
+		last    = map[string]time.Time{}
+		errOut  = iostreams.FromContext(ctx).ErrOut
+	)
+
+	eg, ctx := errgroup.WithContext(ctx)
+	for _, o := range opts {
+		o := o
+		c := make(chan logs.LogEntry)
+		streams = append(streams, c)
+
+		eg.Go(func() error {
+			defer close(c)
+
+			var gap *logs.HistoryGapError
+
+			err := logs.Fetch(ctx, c, client, o, since, until)
+			if errors.As(err, &gap) {
+				fmt.Fprintf(errOut, "Warning: %v\n", gap)
+				return nil
+			}
+			return err
+		})
+	}
 
 	eg.Go(func() error {
-		return printStreams(ctx, pollEntries, liveEntries)
+		for entry := range mergeSorted(ctx, streams...) {
+			if t := entryTime(entry); !t.IsZero() {
+				last[entry.App] = t
+			}
+			if err := p.print(ctx, entry); err != nil {
+				return err
+			}
+		}
+		return nil
 	})
 
-	return eg.Wait()
+	return last, eg.Wait()
 }
 
 func poll(ctx context.Context, eg *errgroup.Group, client *api.Client, opts *logs.LogOptions) <-chan logs.LogEntry {
@@ -98,20 +350,40 @@ func poll(ctx context.Context, eg *errgroup.Group, client *api.Client, opts *log
 	return c
 }
 
-func nats(ctx context.Context, eg *errgroup.Group, client *api.Client, opts *logs.LogOptions, cancelPolling context.CancelFunc) <-chan logs.LogEntry {
+// nats streams the logs of the apps over NATS, sharing a connection between
+// the apps of each organization. Once connected, it stops the polling streams.
+func nats(ctx context.Context, eg *errgroup.Group, client *api.Client, opts []*logs.LogOptions, cancelPolling context.CancelFunc) <-chan logs.LogEntry {
 	c := make(chan logs.LogEntry)
 
 	eg.Go(func() error {
 		defer close(c)
 
-		stream, err := logs.NewNatsStream(ctx, client, opts)
-		if err != nil {
-			logger := logger.FromContext(ctx)
+		var (
+			logger     = logger.FromContext(ctx)
+			orgStreams = map[string]logs.LogStream{}
+			appStreams = make([]logs.LogStream, len(opts))
+		)
+		for i, o := range opts {
+			app, err := client.GetAppBasic(ctx, o.AppName)
+			if err != nil {
+				logger.Debugf("could not fetch app %s: %v\n", o.AppName, err)
+				logger.Debug("falling back to log polling...")
 
-			logger.Debugf("could not connect to wireguard tunnel: %v\n", err)
-			logger.Debug("falling back to log polling...")
+				return nil
+			}
 
-			return nil
+			orgSlug := app.Organization.Slug
+			if orgStreams[orgSlug] == nil {
+				stream, err := logs.NewOrgNatsStream(ctx, client, orgSlug)
+				if err != nil {
+					logger.Debugf("could not connect to wireguard tunnel: %v\n", err)
+					logger.Debug("falling back to log polling...")
+
+					return nil
+				}
+				orgStreams[orgSlug] = stream
+			}
+			appStreams[i] = orgStreams[orgSlug]
 		}
 
 		// we wait for 2 seconds before canceling the polling context so that
@@ -119,9 +391,22 @@ func nats(ctx context.Context, eg *errgroup.Group, client *api.Client, opts *log
 		pause.For(ctx, 2*time.Second)
 		cancelPolling()
 
-		for entry := range stream.Stream(ctx, opts) {
-			c <- entry
+		var wg sync.WaitGroup
+		for i, stream := range appStreams {
+			wg.Add(1)
+			go func(stream logs.LogStream, opts *logs.LogOptions) {
+				defer wg.Done()
+
+				for entry := range stream.Stream(ctx, opts) {
+					select {
+					case c <- entry:
+					case <-ctx.Done():
+						return
+					}
+				}
+			}(stream, opts[i])
 		}
+		wg.Wait()
 
 		return nil
 	})
@@ -129,25 +414,31 @@ func nats(ctx context.Context, eg *errgroup.Group, client *api.Client, opts *log
 	return c
 }
 
-func printStreams(ctx context.Context, streams ...<-chan logs.LogEntry) error {
+type printer struct {
+	w          io.Writer
+	json       bool
+	ndjson     bool
+	format     render.LogFormatter
+	renderOpts []render.LogOption
+	sinks      []logs.LogSink
+}
+
+func (p *printer) printStreams(ctx context.Context, streams ...<-chan logs.LogEntry) error {
 	var eg *errgroup.Group
 	eg, ctx = errgroup.WithContext(ctx)
 
-	out := iostreams.FromContext(ctx).Out
-	json := config.FromContext(ctx).JSONOutput
-
 	for _, stream := range streams {
 		stream := stream
 
 		eg.Go(func() error {
-			return printStream(ctx, out, stream, json)
+			return p.printStream(ctx, stream)
 		})
 	}
 
 	return eg.Wait()
 }
 
-func printStream(ctx context.Context, w io.Writer, stream <-chan logs.LogEntry, json bool) error {
+func (p *printer) printStream(ctx context.Context, stream <-chan logs.LogEntry) error {
 	for {
 		select {
 		case <-ctx.Done():
@@ -157,20 +448,38 @@ func printStream(ctx context.Context, w io.Writer, stream <-chan logs.LogEntry,
 				return nil
 			}
 
-			var err error
-			if json {
-				err = render.JSON(w, entry)
-			} else {
-				err = render.LogEntry(w, entry,
-					render.HideAllocID(),
-					render.RemoveNewlines(),
-					render.HideRegion(),
-				)
-			}
-
-			if err != nil {
+			if err := p.print(ctx, entry); err != nil {
 				return err
 			}
 		}
 	}
 }
+
+func (p *printer) print(ctx context.Context, entry logs.LogEntry) error {
+	for _, sink := range p.sinks {
+		if err := sink.Write(ctx, entry); err != nil {
+			return err
+		}
+	}
+
+	switch {
+	case p.ndjson:
+		return json.NewEncoder(p.w).Encode(entry)
+	case p.json:
+		return render.JSON(p.w, entry)
+	}
+	return p.format(p.w, entry, p.renderOpts...)
+}
+
+// closeSinks flushes what's left in the sinks, giving up after a while if a
+// destination is unreachable.
+func (p *printer) closeSinks() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	for _, sink := range p.sinks {
+		if err := sink.Close(ctx); err != nil {
+			terminal.Warnf("failed to close log sink: %v\n", err)
+		}
+	}
+}
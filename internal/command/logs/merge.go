@@ -0,0 +1,150 @@
+package logs
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/superfly/flyctl/logs"
+)
+
+func entryTime(entry logs.LogEntry) time.Time {
+	t, _ := time.Parse(time.RFC3339Nano, entry.Timestamp)
+	return t
+}
+
+// mergeSorted merges streams that are each sorted by timestamp into a single
+// sorted stream. It's meant for finite streams, since it waits for an entry
+// from every open stream before emitting the oldest.
+func mergeSorted(ctx context.Context, streams ...<-chan logs.LogEntry) <-chan logs.LogEntry {
+	out := make(chan logs.LogEntry)
+
+	go func() {
+		defer close(out)
+
+		type head struct {
+			entry  logs.LogEntry
+			stream <-chan logs.LogEntry
+		}
+
+		heads := make([]head, 0, len(streams))
+		for _, stream := range streams {
+			if entry, ok := <-stream; ok {
+				heads = append(heads, head{entry, stream})
+			}
+		}
+
+		for len(heads) > 0 {
+			oldest := 0
+			for i := range heads {
+				if entryTime(heads[i].entry).Before(entryTime(heads[oldest].entry)) {
+					oldest = i
+				}
+			}
+
+			select {
+			case out <- heads[oldest].entry:
+			case <-ctx.Done():
+				return
+			}
+
+			if entry, ok := <-heads[oldest].stream; ok {
+				heads[oldest].entry = entry
+			} else {
+				heads = append(heads[:oldest], heads[oldest+1:]...)
+			}
+		}
+	}()
+
+	return out
+}
+
+// mergeLive merges live streams into a single stream ordered by timestamp.
+// Entries from different streams don't arrive in order, so each entry is held
+// back for delay before being emitted along with any older entry received in
+// the meantime.
+func mergeLive(ctx context.Context, delay time.Duration, streams ...<-chan logs.LogEntry) <-chan logs.LogEntry {
+	type received struct {
+		entry logs.LogEntry
+		at    time.Time
+	}
+
+	var (
+		in  = make(chan received)
+		out = make(chan logs.LogEntry)
+		wg  sync.WaitGroup
+	)
+
+	for _, stream := range streams {
+		wg.Add(1)
+		go func(stream <-chan logs.LogEntry) {
+			defer wg.Done()
+			for entry := range stream {
+				select {
+				case in <- received{entry, time.Now()}:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}(stream)
+	}
+	go func() {
+		wg.Wait()
+		close(in)
+	}()
+
+	go func() {
+		defer close(out)
+
+		var (
+			pending []received
+			ticker  = time.NewTicker(delay / 4)
+		)
+		defer ticker.Stop()
+
+		// flush emits the pending entries that have been held long enough,
+		// along with the entries older than them.
+		flush := func(all bool) bool {
+			sort.SliceStable(pending, func(i, j int) bool {
+				return entryTime(pending[i].entry).Before(entryTime(pending[j].entry))
+			})
+
+			ready := 0
+			for i, r := range pending {
+				if all || time.Since(r.at) >= delay {
+					ready = i + 1
+				}
+			}
+
+			for _, r := range pending[:ready] {
+				select {
+				case out <- r.entry:
+				case <-ctx.Done():
+					return false
+				}
+			}
+			pending = pending[ready:]
+			return true
+		}
+
+		for {
+			select {
+			case r, ok := <-in:
+				if !ok {
+					flush(true)
+					return
+				}
+				pending = append(pending, r)
+			case <-ticker.C:
+				if !flush(false) {
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return out
+}
@@ -0,0 +1,50 @@
+package logs
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/superfly/flyctl/logs"
+)
+
+func entriesAt(app string, timestamps ...string) <-chan logs.LogEntry {
+	c := make(chan logs.LogEntry, len(timestamps))
+	for _, ts := range timestamps {
+		c <- logs.LogEntry{App: app, Timestamp: ts}
+	}
+	close(c)
+	return c
+}
+
+func collect(c <-chan logs.LogEntry) (apps []string) {
+	for entry := range c {
+		apps = append(apps, entry.App+"@"+entry.Timestamp[17:19])
+	}
+	return
+}
+
+func TestMergeSorted(t *testing.T) {
+	ctx := context.Background()
+
+	merged := mergeSorted(ctx,
+		entriesAt("api", "2023-06-01T12:00:01Z", "2023-06-01T12:00:04Z"),
+		entriesAt("web", "2023-06-01T12:00:02Z", "2023-06-01T12:00:03Z", "2023-06-01T12:00:05Z"),
+		entriesAt("worker"),
+	)
+
+	assert.Equal(t, []string{"api@01", "web@02", "web@03", "api@04", "web@05"}, collect(merged))
+}
+
+func TestMergeLive(t *testing.T) {
+	ctx := context.Background()
+
+	merged := mergeLive(ctx, 100*time.Millisecond,
+		entriesAt("api", "2023-06-01T12:00:03Z"),
+		entriesAt("web", "2023-06-01T12:00:01Z", "2023-06-01T12:00:02Z"),
+	)
+
+	assert.Equal(t, []string{"web@01", "web@02", "api@03"}, collect(merged))
+}
@@ -0,0 +1,292 @@
+package logs
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/superfly/flyctl/logs"
+)
+
+const (
+	defaultRuleWindow      = time.Minute
+	defaultRuleCooldown    = 5 * time.Minute
+	defaultRuleMinRequests = 10
+)
+
+// ruleSet is the format of the rules file given to logs watch.
+type ruleSet struct {
+	Rules []*rule `yaml:"rules"`
+}
+
+// rule fires its actions when log entries meet a condition. A rule either
+// matches entries, firing once at least Count of them match within Window, or
+// watches the ratio of HTTP requests answered with a 5xx status over Window.
+type rule struct {
+	Name  string `yaml:"name"`
+	Match string `yaml:"match"`
+	Level string `yaml:"level"`
+	Count int    `yaml:"count"`
+
+	HTTP5xxRatio float64 `yaml:"http_5xx_ratio"`
+	MinRequests  int     `yaml:"min_requests"`
+
+	Window   time.Duration `yaml:"window"`
+	Cooldown time.Duration `yaml:"cooldown"`
+
+	// PerMessage fires the rule separately for each distinct message rather
+	// than once for all of them, so that different errors aren't hidden by
+	// the cooldown of the first one.
+	PerMessage bool `yaml:"per_message"`
+
+	Actions []action `yaml:"actions"`
+
+	re    *regexp.Regexp
+	state map[string]*ruleState
+}
+
+// action is what happens when a rule fires. Exactly one of its fields is set.
+type action struct {
+	Command string `yaml:"command"`
+	Webhook string `yaml:"webhook"`
+	Exit    *int   `yaml:"exit"`
+}
+
+type ruleState struct {
+	hits       []time.Time
+	requests   []request
+	firedAt    time.Time
+	suppressed int
+}
+
+type request struct {
+	at     time.Time
+	failed bool
+}
+
+// alert is a rule firing.
+type alert struct {
+	Rule       string        `json:"rule"`
+	Message    string        `json:"message"`
+	App        string        `json:"app"`
+	Time       time.Time     `json:"time"`
+	Suppressed int           `json:"suppressed"`
+	Entry      logs.LogEntry `json:"entry"`
+
+	actions []action
+}
+
+func loadRules(path string) ([]*rule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rules file: %w", err)
+	}
+	return parseRules(data)
+}
+
+func parseRules(data []byte) ([]*rule, error) {
+	var set ruleSet
+	if err := yaml.UnmarshalStrict(data, &set); err != nil {
+		return nil, fmt.Errorf("failed to parse rules: %w", err)
+	}
+	if len(set.Rules) == 0 {
+		return nil, errors.New("no rules defined")
+	}
+
+	names := map[string]bool{}
+	for i, r := range set.Rules {
+		if r.Name == "" {
+			r.Name = fmt.Sprintf("rule-%d", i+1)
+		}
+		if names[r.Name] {
+			return nil, fmt.Errorf("rule %s is defined more than once", r.Name)
+		}
+		names[r.Name] = true
+
+		if err := r.init(); err != nil {
+			return nil, fmt.Errorf("invalid rule %s: %w", r.Name, err)
+		}
+	}
+
+	return set.Rules, nil
+}
+
+func (r *rule) init() error {
+	switch {
+	case r.Match == "" && r.HTTP5xxRatio == 0 && r.Level == "":
+		return errors.New("one of match, level or http_5xx_ratio must be set")
+	case r.HTTP5xxRatio != 0 && (r.Match != "" || r.Level != "" || r.Count != 0):
+		return errors.New("http_5xx_ratio can't be combined with match, level or count")
+	case r.HTTP5xxRatio < 0 || r.HTTP5xxRatio > 1:
+		return errors.New("http_5xx_ratio must be between 0 and 1")
+	case len(r.Actions) == 0:
+		return errors.New("no actions defined")
+	}
+
+	for _, a := range r.Actions {
+		n := 0
+		for _, set := range []bool{a.Command != "", a.Webhook != "", a.Exit != nil} {
+			if set {
+				n++
+			}
+		}
+		if n != 1 {
+			return errors.New("each action must set exactly one of command, webhook or exit")
+		}
+	}
+
+	if r.Match != "" {
+		re, err := regexp.Compile(r.Match)
+		if err != nil {
+			return fmt.Errorf("invalid match expression: %w", err)
+		}
+		r.re = re
+	}
+
+	if r.Count == 0 {
+		r.Count = 1
+	}
+	if r.MinRequests == 0 {
+		r.MinRequests = defaultRuleMinRequests
+	}
+	if r.Window == 0 {
+		r.Window = defaultRuleWindow
+	}
+	if r.Cooldown == 0 {
+		r.Cooldown = defaultRuleCooldown
+	}
+	r.state = map[string]*ruleState{}
+
+	return nil
+}
+
+// evaluate records the entry, received at now, and returns an alert if it
+// makes the rule fire.
+func (r *rule) evaluate(entry logs.LogEntry, now time.Time) *alert {
+	if r.HTTP5xxRatio > 0 {
+		return r.evaluateHTTP(entry, now)
+	}
+
+	if r.Level != "" && !strings.EqualFold(r.Level, entry.Level) {
+		return nil
+	}
+	if r.re != nil && !r.re.MatchString(entry.Message) {
+		return nil
+	}
+
+	key := entry.App
+	if r.PerMessage {
+		key += "\x00" + entry.Message
+		r.prune(now)
+	}
+	state := r.stateFor(key)
+
+	state.hits = append(trimTimes(state.hits, now.Add(-r.Window)), now)
+	if len(state.hits) < r.Count {
+		return nil
+	}
+
+	message := entry.Message
+	if r.Count > 1 {
+		message = fmt.Sprintf("%d matching entries within %s, last: %s", len(state.hits), r.Window, entry.Message)
+	}
+	return r.fire(state, entry, message, now)
+}
+
+func (r *rule) evaluateHTTP(entry logs.LogEntry, now time.Time) *alert {
+	status := entry.Meta.HTTP.Response.StatusCode
+	if status == 0 {
+		return nil
+	}
+
+	state := r.stateFor(entry.App)
+
+	cutoff := now.Add(-r.Window)
+	i := 0
+	for i < len(state.requests) && state.requests[i].at.Before(cutoff) {
+		i++
+	}
+	state.requests = append(state.requests[i:], request{at: now, failed: status >= 500 && status <= 599})
+
+	if len(state.requests) < r.MinRequests {
+		return nil
+	}
+
+	failed := 0
+	for _, req := range state.requests {
+		if req.failed {
+			failed++
+		}
+	}
+	ratio := float64(failed) / float64(len(state.requests))
+	if ratio < r.HTTP5xxRatio {
+		return nil
+	}
+
+	message := fmt.Sprintf("%.1f%% of %d requests failed with a 5xx status within %s", ratio*100, len(state.requests), r.Window)
+	return r.fire(state, entry, message, now)
+}
+
+// fire returns an alert unless the rule is cooling down, in which case it
+// counts the alert as suppressed.
+func (r *rule) fire(state *ruleState, entry logs.LogEntry, message string, now time.Time) *alert {
+	if !state.firedAt.IsZero() && now.Sub(state.firedAt) < r.Cooldown {
+		state.suppressed++
+		return nil
+	}
+
+	a := &alert{
+		Rule:       r.Name,
+		Message:    message,
+		App:        entry.App,
+		Time:       now,
+		Suppressed: state.suppressed,
+		Entry:      entry,
+		actions:    r.Actions,
+	}
+
+	state.firedAt = now
+	state.suppressed = 0
+	state.hits = nil
+	state.requests = nil
+
+	return a
+}
+
+func (r *rule) stateFor(key string) *ruleState {
+	state, ok := r.state[key]
+	if !ok {
+		state = &ruleState{}
+		r.state[key] = state
+	}
+	return state
+}
+
+// prune forgets the messages that neither fired recently nor matched within
+// the window, so that rules firing per message don't grow unbounded.
+func (r *rule) prune(now time.Time) {
+	const maxStates = 1000
+
+	if len(r.state) < maxStates {
+		return
+	}
+	for key, state := range r.state {
+		state.hits = trimTimes(state.hits, now.Add(-r.Window))
+		if len(state.hits) == 0 && now.Sub(state.firedAt) >= r.Cooldown {
+			delete(r.state, key)
+		}
+	}
+}
+
+func trimTimes(times []time.Time, cutoff time.Time) []time.Time {
+	i := 0
+	for i < len(times) && times[i].Before(cutoff) {
+		i++
+	}
+	return times[i:]
+}
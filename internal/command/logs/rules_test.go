@@ -0,0 +1,137 @@
+package logs
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/superfly/flyctl/logs"
+)
+
+func TestParseRules(t *testing.T) {
+	rules, err := parseRules([]byte(`
+rules:
+  - name: panics
+    match: "panic"
+    actions:
+      - command: echo panic
+  - http_5xx_ratio: 0.5
+    window: 5m
+    actions:
+      - exit: 2
+`))
+	require.NoError(t, err)
+	require.Len(t, rules, 2)
+
+	assert.Equal(t, 1, rules[0].Count)
+	assert.Equal(t, defaultRuleWindow, rules[0].Window)
+	assert.Equal(t, defaultRuleCooldown, rules[0].Cooldown)
+	assert.Equal(t, "rule-2", rules[1].Name)
+	assert.Equal(t, 5*time.Minute, rules[1].Window)
+	assert.Equal(t, 2, *rules[1].Actions[0].Exit)
+
+	for _, invalid := range []string{
+		`rules: []`,
+		`rules: [{match: "x"}]`,
+		`rules: [{actions: [{exit: 1}]}]`,
+		`rules: [{match: "(", actions: [{exit: 1}]}]`,
+		`rules: [{match: "x", actions: [{exit: 1, command: "true"}]}]`,
+		`rules: [{http_5xx_ratio: 0.1, match: "x", actions: [{exit: 1}]}]`,
+		`rules: [{name: a, match: x, actions: [{exit: 1}]}, {name: a, match: y, actions: [{exit: 1}]}]`,
+		`rules: [{match: "x", unknown: 1, actions: [{exit: 1}]}]`,
+	} {
+		_, err := parseRules([]byte(invalid))
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestRuleCountAndCooldown(t *testing.T) {
+	rules, err := parseRules([]byte(`
+rules:
+  - name: errors
+    match: "ERROR"
+    count: 3
+    window: 1m
+    cooldown: 10m
+    actions:
+      - exit: 1
+`))
+	require.NoError(t, err)
+	r := rules[0]
+
+	var (
+		now   = time.Now()
+		entry = logs.LogEntry{Message: "ERROR boom"}
+	)
+
+	assert.Nil(t, r.evaluate(entry, now))
+	assert.Nil(t, r.evaluate(logs.LogEntry{Message: "all good"}, now))
+	assert.Nil(t, r.evaluate(entry, now.Add(time.Second)))
+	// The first match falls out of the window.
+	assert.Nil(t, r.evaluate(entry, now.Add(61*time.Second)))
+	assert.Nil(t, r.evaluate(entry, now.Add(62*time.Second)))
+
+	a := r.evaluate(entry, now.Add(63*time.Second))
+	require.NotNil(t, a)
+	assert.Equal(t, "errors", a.Rule)
+	assert.Contains(t, a.Message, "3 matching entries")
+
+	// Cooling down.
+	for i := 0; i < 3; i++ {
+		assert.Nil(t, r.evaluate(entry, now.Add(2*time.Minute)))
+	}
+
+	for i := 0; i < 2; i++ {
+		assert.Nil(t, r.evaluate(entry, now.Add(20*time.Minute)))
+	}
+	a = r.evaluate(entry, now.Add(20*time.Minute))
+	require.NotNil(t, a)
+	assert.Equal(t, 1, a.Suppressed)
+}
+
+func TestRulePerMessage(t *testing.T) {
+	rules, err := parseRules([]byte(`
+rules:
+  - match: "panic"
+    per_message: true
+    actions:
+      - exit: 1
+`))
+	require.NoError(t, err)
+	r := rules[0]
+	now := time.Now()
+
+	assert.NotNil(t, r.evaluate(logs.LogEntry{Message: "panic: a"}, now))
+	assert.Nil(t, r.evaluate(logs.LogEntry{Message: "panic: a"}, now))
+	assert.NotNil(t, r.evaluate(logs.LogEntry{Message: "panic: b"}, now))
+}
+
+func TestRuleHTTP5xxRatio(t *testing.T) {
+	rules, err := parseRules([]byte(`
+rules:
+  - http_5xx_ratio: 0.5
+    min_requests: 4
+    actions:
+      - exit: 1
+`))
+	require.NoError(t, err)
+	r := rules[0]
+	now := time.Now()
+
+	request := func(status int) logs.LogEntry {
+		var entry logs.LogEntry
+		entry.Meta.HTTP.Response.StatusCode = status
+		return entry
+	}
+
+	assert.Nil(t, r.evaluate(logs.LogEntry{Message: "not a request"}, now))
+	assert.Nil(t, r.evaluate(request(200), now))
+	assert.Nil(t, r.evaluate(request(502), now))
+	assert.Nil(t, r.evaluate(request(200), now))
+
+	a := r.evaluate(request(503), now)
+	require.NotNil(t, a)
+	assert.Contains(t, a.Message, "50.0% of 4 requests")
+}
@@ -0,0 +1,231 @@
+package logs
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"runtime"
+	"time"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/sync/errgroup"
+
+	"github.com/superfly/flyctl/client"
+	"github.com/superfly/flyctl/internal/command"
+	"github.com/superfly/flyctl/internal/config"
+	"github.com/superfly/flyctl/internal/flag"
+	"github.com/superfly/flyctl/internal/render"
+	"github.com/superfly/flyctl/iostreams"
+	"github.com/superfly/flyctl/terminal"
+)
+
+func newWatch() (cmd *cobra.Command) {
+	const (
+		long = `Follow app logs and fire alerts when they meet the conditions described
+in a rules file, without running a separate log pipeline.
+
+The rules file is YAML:
+
+  rules:
+    - name: panics
+      match: "panic|fatal error"   # regular expression matched on messages
+      level: error                 # optional, only match entries of this level
+      count: 1                     # fire once this many entries match...
+      window: 1m                   # ...within this window
+      per_message: true            # fire separately for each distinct message
+      cooldown: 10m                # don't fire again for this long
+      actions:
+        - command: notify-send "$FLY_ALERT_RULE" "$FLY_ALERT_MESSAGE"
+    - name: errors
+      http_5xx_ratio: 0.05         # fire once 5% of HTTP requests fail...
+      min_requests: 20             # ...out of at least this many...
+      window: 5m                   # ...within this window
+      actions:
+        - webhook: https://hooks.example.com/alerts
+        - exit: 2
+
+Commands are run by the shell with the FLY_ALERT_RULE, FLY_ALERT_MESSAGE and
+FLY_ALERT_APP environment variables set. Webhooks receive the alert as JSON.
+The exit action stops watching and exits with the given code.
+
+Alerts fired while a rule is cooling down are suppressed, and counted in the
+next alert.
+`
+		short = "Fire alerts based on app logs"
+	)
+
+	cmd = command.New("watch", short, long, runWatch,
+		command.RequireSession,
+		command.LoadAppNameIfPresent,
+	)
+
+	cmd.Args = cobra.NoArgs
+
+	flag.Add(cmd,
+		sourceFlags,
+		flag.JSONOutput(),
+		filterFlags,
+		flag.String{
+			Name:        "rule",
+			Description: "Path to the rules file",
+		},
+	)
+	_ = cmd.MarkFlagRequired("rule")
+
+	return
+}
+
+// alertExitError stops logs watch when a rule fires an exit action.
+type alertExitError struct {
+	code  int
+	alert *alert
+}
+
+func (e *alertExitError) Error() string {
+	return fmt.Sprintf("rule %s fired: %s", e.alert.Rule, e.alert.Message)
+}
+
+func (e *alertExitError) ExitCode() int {
+	return e.code
+}
+
+func runWatch(ctx context.Context) error {
+	var (
+		client = client.FromContext(ctx).API()
+		io     = iostreams.FromContext(ctx)
+		json   = config.FromContext(ctx).JSONOutput
+	)
+
+	rules, err := loadRules(flag.GetString(ctx, "rule"))
+	if err != nil {
+		return err
+	}
+
+	opts, err := logOptions(ctx)
+	if err != nil {
+		return err
+	}
+
+	var eg *errgroup.Group
+	eg, ctx = errgroup.WithContext(ctx)
+
+	// Rules aren't safe for concurrent use, so evaluate a single stream.
+	entries := mergeLive(ctx, time.Second/4, follow(ctx, eg, client, opts)...)
+
+	eg.Go(func() error {
+		for entry := range entries {
+			now := time.Now()
+
+			for _, r := range rules {
+				a := r.evaluate(entry, now)
+				if a == nil {
+					continue
+				}
+
+				if json {
+					_ = render.JSON(io.Out, a)
+				} else {
+					printAlert(io, a)
+				}
+
+				if err := runActions(ctx, a); err != nil {
+					return err
+				}
+			}
+		}
+		return ctx.Err()
+	})
+
+	return eg.Wait()
+}
+
+func printAlert(io *iostreams.IOStreams, a *alert) {
+	colorize := io.ColorScheme()
+
+	fmt.Fprintf(io.Out, "%s %s %s", colorize.Gray(a.Time.Format(time.RFC3339)), colorize.Red("ALERT "+a.Rule), a.Message)
+	if a.App != "" {
+		fmt.Fprintf(io.Out, " (%s)", a.App)
+	}
+	if a.Suppressed > 0 {
+		fmt.Fprintf(io.Out, " [%d suppressed during cooldown]", a.Suppressed)
+	}
+	fmt.Fprintln(io.Out)
+}
+
+// runActions runs the actions of the alert in order. Failing commands and
+// webhooks are reported without stopping the watch.
+func runActions(ctx context.Context, a *alert) error {
+	const actionTimeout = 30 * time.Second
+
+	for _, action := range a.actions {
+		actionCtx, cancel := context.WithTimeout(ctx, actionTimeout)
+
+		var err error
+		switch {
+		case action.Command != "":
+			err = runAlertCommand(actionCtx, action.Command, a)
+		case action.Webhook != "":
+			err = postAlert(actionCtx, action.Webhook, a)
+		case action.Exit != nil:
+			cancel()
+			return &alertExitError{code: *action.Exit, alert: a}
+		}
+		cancel()
+
+		if err != nil {
+			terminal.Warnf("rule %s: %v\n", a.Rule, err)
+		}
+	}
+
+	return nil
+}
+
+func runAlertCommand(ctx context.Context, command string, a *alert) error {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", command)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", command)
+	}
+
+	cmd.Env = append(os.Environ(),
+		"FLY_ALERT_RULE="+a.Rule,
+		"FLY_ALERT_MESSAGE="+a.Message,
+		"FLY_ALERT_APP="+a.App,
+	)
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("command failed: %w", err)
+	}
+	return nil
+}
+
+func postAlert(ctx context.Context, url string, a *alert) error {
+	body, err := json.Marshal(a)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("webhook failed: %w", err)
+	}
+	defer res.Body.Close() // skipcq: GO-S2307
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return fmt.Errorf("webhook failed: %s", res.Status)
+	}
+	return nil
+}
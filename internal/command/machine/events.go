@@ -0,0 +1,313 @@
+package machine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/azazeal/pause"
+	"github.com/samber/lo"
+	"github.com/spf13/cobra"
+
+	"github.com/superfly/flyctl/api"
+	"github.com/superfly/flyctl/flaps"
+	"github.com/superfly/flyctl/internal/appconfig"
+	"github.com/superfly/flyctl/internal/command"
+	"github.com/superfly/flyctl/internal/config"
+	"github.com/superfly/flyctl/internal/flag"
+	"github.com/superfly/flyctl/internal/render"
+	"github.com/superfly/flyctl/iostreams"
+)
+
+func newEvents() *cobra.Command {
+	const (
+		short = "Show the event history of machines"
+		long  = short + `
+
+Shows the events recorded for a machine, oldest first, including why it
+exited. With --all, the events of every machine of the app are merged into a
+single timeline.
+
+--since and --until accept either a duration relative to now (e.g. 2h) or an
+RFC 3339 timestamp.
+`
+		usage = "events [<id>]"
+	)
+
+	cmd := command.New(usage, short, long, runMachineEvents,
+		command.RequireSession,
+		command.LoadAppNameIfPresent,
+	)
+
+	cmd.Args = cobra.RangeArgs(0, 1)
+
+	flag.Add(
+		cmd,
+		flag.App(),
+		flag.AppConfig(),
+		flag.JSONOutput(),
+		selectFlag,
+		flag.Bool{
+			Name:        "all",
+			Description: "Show the events of all machines of the app",
+		},
+		flag.StringSlice{
+			Name:        "type",
+			Description: "Only show events of these types (e.g. exit,start)",
+		},
+		flag.String{
+			Name:        "since",
+			Description: "Only show events after this time",
+		},
+		flag.String{
+			Name:        "until",
+			Description: "Only show events before this time",
+		},
+		flag.Bool{
+			Name:        "follow",
+			Shorthand:   "f",
+			Description: "Keep polling for new events",
+		},
+	)
+
+	return cmd
+}
+
+// machineEvent is a machine event tagged with the machine it belongs to.
+type machineEvent struct {
+	MachineID string `json:"machine_id"`
+	*api.MachineEvent
+}
+
+type eventFilter struct {
+	types []string
+	since time.Time
+	until time.Time
+}
+
+func (f *eventFilter) matches(event *api.MachineEvent) bool {
+	if len(f.types) > 0 && !lo.Contains(f.types, event.Type) {
+		return false
+	}
+	if !f.since.IsZero() && event.Time().Before(f.since) {
+		return false
+	}
+	if !f.until.IsZero() && event.Time().After(f.until) {
+		return false
+	}
+	return true
+}
+
+func runMachineEvents(ctx context.Context) error {
+	var (
+		io   = iostreams.FromContext(ctx)
+		json = config.FromContext(ctx).JSONOutput
+		all  = flag.GetBool(ctx, "all")
+	)
+
+	filter, err := eventFilterFromFlags(ctx)
+	if err != nil {
+		return err
+	}
+
+	var machineID string
+	if all {
+		if len(flag.Args(ctx)) > 0 || flag.GetBool(ctx, "select") {
+			return errors.New("machine IDs and --select can't be used with --all")
+		}
+		if appconfig.NameFromContext(ctx) == "" {
+			return errors.New("an app name must be specified to use --all")
+		}
+		if ctx, err = buildContextFromAppNameOrMachineID(ctx); err != nil {
+			return err
+		}
+	} else {
+		var machine *api.Machine
+		machine, ctx, err = selectOneMachine(ctx, nil, flag.FirstArg(ctx), len(flag.Args(ctx)) > 0)
+		if err != nil {
+			return err
+		}
+		machineID = machine.ID
+	}
+
+	fetch := func() ([]machineEvent, error) {
+		return fetchMachineEvents(ctx, machineID, filter)
+	}
+
+	events, err := fetch()
+	if err != nil {
+		return err
+	}
+
+	if !flag.GetBool(ctx, "follow") {
+		if json {
+			return render.JSON(io.Out, events)
+		}
+		return renderMachineEvents(io, events, all, true)
+	}
+
+	seen := map[string]bool{}
+	printNew := func(events []machineEvent, header bool) error {
+		events = lo.Filter(events, func(e machineEvent, _ int) bool {
+			return !seen[e.key()]
+		})
+		for _, e := range events {
+			seen[e.key()] = true
+		}
+
+		if json {
+			for _, e := range events {
+				if err := render.JSON(io.Out, e); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		return renderMachineEvents(io, events, all, header)
+	}
+
+	if err := printNew(events, true); err != nil {
+		return err
+	}
+
+	const pollInterval = 5 * time.Second
+	for {
+		if pause.For(ctx, pollInterval); ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		events, err := fetch()
+		if err != nil {
+			return err
+		}
+		if err := printNew(events, false); err != nil {
+			return err
+		}
+	}
+}
+
+func eventFilterFromFlags(ctx context.Context) (*eventFilter, error) {
+	var (
+		filter = &eventFilter{types: flag.GetStringSlice(ctx, "type")}
+		now    = time.Now()
+		err    error
+	)
+
+	if since := flag.GetString(ctx, "since"); since != "" {
+		if filter.since, err = parseEventTime(since, now); err != nil {
+			return nil, fmt.Errorf("invalid --since: %w", err)
+		}
+	}
+	if until := flag.GetString(ctx, "until"); until != "" {
+		if filter.until, err = parseEventTime(until, now); err != nil {
+			return nil, fmt.Errorf("invalid --until: %w", err)
+		}
+	}
+	if !filter.since.IsZero() && !filter.until.IsZero() && filter.until.Before(filter.since) {
+		return nil, errors.New("--until must be after --since")
+	}
+
+	return filter, nil
+}
+
+// parseEventTime parses either a duration relative to now or an RFC 3339
+// timestamp.
+func parseEventTime(value string, now time.Time) (time.Time, error) {
+	if d, err := time.ParseDuration(value); err == nil {
+		return now.Add(-d), nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%q is neither a duration nor an RFC 3339 timestamp", value)
+	}
+	return t, nil
+}
+
+// fetchMachineEvents returns the events of the given machine, or of all the
+// app's machines when machineID is empty, sorted oldest first.
+func fetchMachineEvents(ctx context.Context, machineID string, filter *eventFilter) ([]machineEvent, error) {
+	flapsClient := flaps.FromContext(ctx)
+
+	var machines []*api.Machine
+	if machineID == "" {
+		var err error
+		if machines, err = flapsClient.List(ctx, ""); err != nil {
+			return nil, fmt.Errorf("could not get a list of machines: %w", err)
+		}
+	} else {
+		machine, err := flapsClient.Get(ctx, machineID)
+		if err != nil {
+			return nil, fmt.Errorf("could not get machine %s: %w", machineID, err)
+		}
+		machines = []*api.Machine{machine}
+	}
+
+	var events []machineEvent
+	for _, machine := range machines {
+		for _, event := range machine.Events {
+			if filter.matches(event) {
+				events = append(events, machineEvent{MachineID: machine.ID, MachineEvent: event})
+			}
+		}
+	}
+
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].Timestamp < events[j].Timestamp
+	})
+	return events, nil
+}
+
+func (e machineEvent) key() string {
+	return fmt.Sprintf("%s/%d/%s/%s", e.MachineID, e.Timestamp, e.Type, e.Status)
+}
+
+func (e machineEvent) info() string {
+	if e.Request == nil {
+		return ""
+	}
+
+	var info []string
+	if exitEvent := e.Request.GetExitEvent(); exitEvent != nil {
+		info = append(info, exitEvent.Reason())
+	}
+	if e.Request.RestartCount > 0 {
+		info = append(info, fmt.Sprintf("restart count %d", e.Request.RestartCount))
+	}
+	return strings.Join(info, ", ")
+}
+
+func renderMachineEvents(io *iostreams.IOStreams, events []machineEvent, withMachineID, header bool) error {
+	rows := make([][]string, 0, len(events))
+	for _, e := range events {
+		row := []string{
+			e.Time().Format(time.RFC3339Nano),
+			e.Type,
+			e.Status,
+			e.Source,
+			e.info(),
+		}
+		if withMachineID {
+			row = append([]string{e.MachineID}, row...)
+		}
+		rows = append(rows, row)
+	}
+
+	if len(rows) == 0 {
+		if header {
+			fmt.Fprintln(io.ErrOut, "No events found")
+		}
+		return nil
+	}
+
+	cols := []string{"Timestamp", "Type", "Status", "Source", "Info"}
+	if withMachineID {
+		cols = append([]string{"Machine"}, cols...)
+	}
+	if !header {
+		cols = nil
+	}
+	return render.Table(io.Out, "", rows, cols...)
+}
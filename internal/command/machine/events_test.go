@@ -0,0 +1,96 @@
+package machine
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/superfly/flyctl/api"
+	"github.com/superfly/flyctl/iostreams"
+)
+
+func TestMachineEventInfo(t *testing.T) {
+	cases := []struct {
+		request *api.MachineRequest
+		info    string
+	}{
+		{
+			request: nil,
+			info:    "",
+		},
+		{
+			request: &api.MachineRequest{ExitEvent: &api.MachineExitEvent{ExitCode: 2}},
+			info:    "exited with code 2",
+		},
+		{
+			// the monitor's exit event is preferred
+			request: &api.MachineRequest{
+				ExitEvent:    &api.MachineExitEvent{ExitCode: 1},
+				MonitorEvent: &api.MachineMonitorEvent{ExitEvent: &api.MachineExitEvent{ExitCode: 137, OOMKilled: true, Restarting: true}},
+				RestartCount: 3,
+			},
+			info: "killed after running out of memory (exit code 137), restarting, restart count 3",
+		},
+		{
+			request: &api.MachineRequest{RestartCount: 1},
+			info:    "restart count 1",
+		},
+	}
+
+	for _, c := range cases {
+		e := machineEvent{MachineID: "m1", MachineEvent: &api.MachineEvent{Type: "exit", Request: c.request}}
+		assert.Equal(t, c.info, e.info())
+	}
+}
+
+func TestParseEventTime(t *testing.T) {
+	now := time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	got, err := parseEventTime("2h", now)
+	require.NoError(t, err)
+	assert.Equal(t, now.Add(-2*time.Hour), got)
+
+	got, err = parseEventTime("2023-05-31T08:30:00Z", now)
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2023, 5, 31, 8, 30, 0, 0, time.UTC), got)
+
+	_, err = parseEventTime("yesterday", now)
+	assert.Error(t, err)
+}
+
+func TestEventFilterMatches(t *testing.T) {
+	at := time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC)
+	event := &api.MachineEvent{Type: "exit", Timestamp: at.UnixMilli()}
+
+	assert.True(t, (&eventFilter{}).matches(event))
+	assert.True(t, (&eventFilter{types: []string{"start", "exit"}}).matches(event))
+	assert.False(t, (&eventFilter{types: []string{"start"}}).matches(event))
+	assert.True(t, (&eventFilter{since: at, until: at}).matches(event))
+	assert.False(t, (&eventFilter{since: at.Add(time.Second)}).matches(event))
+	assert.False(t, (&eventFilter{until: at.Add(-time.Second)}).matches(event))
+}
+
+func TestRenderMachineEvents(t *testing.T) {
+	at := time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC)
+	events := []machineEvent{
+		{MachineID: "m1", MachineEvent: &api.MachineEvent{
+			Type:      "exit",
+			Status:    "stopped",
+			Source:    "flyd",
+			Timestamp: at.UnixMilli(),
+			Request:   &api.MachineRequest{ExitEvent: &api.MachineExitEvent{ExitCode: 0}},
+		}},
+	}
+
+	io, _, out, _ := iostreams.Test()
+	require.NoError(t, renderMachineEvents(io, events, true, true))
+	assert.Contains(t, out.String(), "m1")
+	assert.Contains(t, out.String(), "exited successfully")
+
+	io, _, out, errOut := iostreams.Test()
+	require.NoError(t, renderMachineEvents(io, nil, false, true))
+	assert.Empty(t, out.String())
+	assert.Equal(t, "No events found\n", errOut.String())
+}
@@ -2,16 +2,19 @@ package machine
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"strings"
 	"time"
 
+	"github.com/samber/lo"
 	"github.com/spf13/cobra"
 	"github.com/superfly/flyctl/api"
 	"github.com/superfly/flyctl/flaps"
+	"github.com/superfly/flyctl/internal/appconfig"
 	"github.com/superfly/flyctl/internal/command"
 	"github.com/superfly/flyctl/internal/config"
 	"github.com/superfly/flyctl/internal/flag"
+	mach "github.com/superfly/flyctl/internal/machine"
 	"github.com/superfly/flyctl/internal/render"
 	"github.com/superfly/flyctl/iostreams"
 )
@@ -65,8 +68,17 @@ func newLeaseView() *cobra.Command {
 func newLeaseClear() *cobra.Command {
 	const (
 		short = "Clear machine leases"
-		long  = short + "\n"
-		usage = "clear <machine-id>"
+		long  = short + `
+
+Releases the leases held on the given machines, or on every machine of the app
+with --all. With --older-than, only leases that were not refreshed for that
+long are released, leaving leases held by running deployments alone. A lease
+is taken to have been last refreshed --lease-ttl before it expires, so set it
+to the --lease-timeout the holder deployed with when that wasn't the default:
+with a longer --lease-ttl, leases that are still being refreshed look stale
+and are released.
+`
+		usage = "clear [<machine-id>...]"
 	)
 
 	cmd := command.New(usage, short, long, runLeaseClear,
@@ -81,6 +93,19 @@ func newLeaseClear() *cobra.Command {
 		flag.App(),
 		flag.AppConfig(),
 		selectFlag,
+		flag.Bool{
+			Name:        "all",
+			Description: "Clear the leases of all machines of the app",
+		},
+		flag.Duration{
+			Name:        "older-than",
+			Description: "Only clear leases that were not refreshed for this long",
+		},
+		flag.Duration{
+			Name:        "lease-ttl",
+			Description: "The lease time the leases were acquired with, used with --older-than",
+			Default:     13 * time.Second,
+		},
 	)
 
 	return cmd
@@ -97,23 +122,10 @@ func runLeaseView(ctx context.Context) (err error) {
 	if err != nil {
 		return err
 	}
-	flapsClient := flaps.FromContext(ctx)
-
-	var leases = make(map[string]*api.MachineLease)
-
-	for _, machine := range machines {
-		lease, err := flapsClient.FindLease(ctx, machine.ID)
-		if err != nil {
-			if strings.Contains(err.Error(), " lease not found") {
-				continue
-			}
-			return err
-		}
-		if lease == nil {
-			continue
-		}
-
-		leases[machine.ID] = lease
+	machineIDs := lo.Map(machines, func(m *api.Machine, _ int) string { return m.ID })
+	leases, err := mach.FindLeases(ctx, machineIDs)
+	if err != nil {
+		return err
 	}
 
 	if cfg.JSONOutput {
@@ -139,32 +151,59 @@ func runLeaseView(ctx context.Context) (err error) {
 		})
 	}
 
-	_ = render.Table(io.Out, "", rows, "Machine", "Nonce", "Status", "Owner", "Expires")
+	_ = render.Table(io.Out, "", rows, "Machine", "Nonce", "Owner", "Status", "Expires")
 
 	return
 }
 
 func runLeaseClear(ctx context.Context) (err error) {
 	var (
-		io   = iostreams.FromContext(ctx)
-		args = flag.Args(ctx)
+		io        = iostreams.FromContext(ctx)
+		args      = flag.Args(ctx)
+		olderThan = flag.GetDuration(ctx, "older-than")
 	)
 
-	machineIDs, ctx, err := selectManyMachineIDs(ctx, args)
+	var machineIDs []string
+	if flag.GetBool(ctx, "all") {
+		if len(args) > 0 || flag.GetBool(ctx, "select") {
+			return errors.New("machine IDs and --select can't be used with --all")
+		}
+		if appconfig.NameFromContext(ctx) == "" {
+			return errors.New("an app name must be specified to use --all")
+		}
+		if ctx, err = buildContextFromAppNameOrMachineID(ctx); err != nil {
+			return err
+		}
+		machines, err := flaps.FromContext(ctx).List(ctx, "")
+		if err != nil {
+			return fmt.Errorf("could not get a list of machines: %w", err)
+		}
+		machineIDs = lo.Map(machines, func(m *api.Machine, _ int) string { return m.ID })
+	} else {
+		if machineIDs, ctx, err = selectManyMachineIDs(ctx, args); err != nil {
+			return err
+		}
+	}
+	flapsClient := flaps.FromContext(ctx)
+
+	var leases map[string]*api.MachineLease
+	if olderThan > 0 {
+		fmt.Fprintf(io.ErrOut, "Looking for leases not refreshed within %s\n", olderThan)
+		leases, err = mach.FindStaleLeases(ctx, machineIDs, olderThan, flag.GetDuration(ctx, "lease-ttl"))
+	} else {
+		leases, err = mach.FindLeases(ctx, machineIDs)
+	}
 	if err != nil {
 		return err
 	}
-	flapsClient := flaps.FromContext(ctx)
 
-	for _, machineID := range machineIDs {
-		lease, err := flapsClient.FindLease(ctx, machineID)
-		if err != nil {
-			if strings.Contains(err.Error(), " lease not found") {
-				continue
-			}
-			return err
-		}
-		fmt.Fprintf(io.Out, "clearing lease for machine %s\n", machineID)
+	if len(leases) == 0 {
+		fmt.Fprintln(io.Out, "No leases to clear")
+		return nil
+	}
+
+	for machineID, lease := range leases {
+		fmt.Fprintf(io.Out, "clearing lease for machine %s (owner %s)\n", machineID, lease.Data.Owner)
 
 		if err := flapsClient.ReleaseLease(ctx, machineID, lease.Data.Nonce); err != nil {
 			return err
@@ -26,6 +26,9 @@ func New() *cobra.Command {
 		newStart(),
 		newStop(),
 		newStatus(),
+		newEvents(),
+		newTop(),
+		newWait(),
 		newProxy(),
 		newClone(),
 		newUpdate(),
@@ -0,0 +1,525 @@
+package machine
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+	"github.com/spf13/cobra"
+	"golang.org/x/sync/errgroup"
+
+	"github.com/superfly/flyctl/api"
+	"github.com/superfly/flyctl/client"
+	"github.com/superfly/flyctl/flaps"
+	"github.com/superfly/flyctl/internal/appconfig"
+	"github.com/superfly/flyctl/internal/command"
+	"github.com/superfly/flyctl/internal/command/ssh"
+	"github.com/superfly/flyctl/internal/flag"
+	"github.com/superfly/flyctl/internal/render"
+	"github.com/superfly/flyctl/iostreams"
+	"github.com/superfly/flyctl/logs"
+)
+
+func newTop() *cobra.Command {
+	const (
+		short = "Interactively monitor and manage the machines of an app"
+		long  = short + `
+
+Shows a live view of every machine of the app with its state, region, process
+group, image version, health checks and resource usage. Use the arrow keys to
+select a machine and the following keys to act on it:
+
+  s  start the machine
+  t  stop the machine
+  r  restart the machine
+  l  tail the machine's logs (press again to hide them)
+  c  open an SSH console on the machine
+  q  quit
+
+CPU usage is the CPU time the processes of a machine used between two
+refreshes, as a percentage of one CPU, taking the CPU time the machine's init
+reports to be in clock ticks of 1/100s.
+`
+		usage = "top"
+	)
+
+	cmd := command.New(usage, short, long, runMachineTop,
+		command.RequireSession,
+		command.RequireAppName,
+	)
+
+	cmd.Args = cobra.NoArgs
+
+	flag.Add(
+		cmd,
+		flag.App(),
+		flag.AppConfig(),
+		flag.Duration{
+			Name:        "interval",
+			Description: "How often to refresh the machine list",
+			Default:     2 * time.Second,
+		},
+		flag.String{
+			Name:        "user",
+			Shorthand:   "u",
+			Description: "Unix username to connect as when opening a console",
+			Default:     ssh.DefaultSshUsername,
+		},
+	)
+
+	return cmd
+}
+
+// machineUsage is the resource usage of a machine as reported by its init.
+// CPU usage is a percentage of one CPU over the last refresh; it's unknown,
+// and hasCPU false, until the machine has been sampled twice.
+type machineUsage struct {
+	cpu    float64
+	hasCPU bool
+	rss    uint64
+}
+
+// clockTicksPerSecond is the unit of the CPU time the init reports for each
+// process. The machines API doesn't document it; the init is taken to report
+// utime+stime of /proc/<pid>/stat, which Linux gives in USER_HZ, the
+// sysconf(_SC_CLK_TCK) that's fixed at 100 on x86-64 and arm64, whatever the
+// kernel's HZ. Should the init report another unit, CPU usage is off by the
+// ratio of the two, so this is the one place to change.
+const clockTicksPerSecond = 100
+
+// cpuSample holds the cumulative CPU time of the processes of a machine, by
+// PID, at the time it was taken.
+type cpuSample struct {
+	at  time.Time
+	cpu map[int32]uint64
+}
+
+func newCPUSample(processes api.MachinePsResponse, at time.Time) cpuSample {
+	sample := cpuSample{at: at, cpu: make(map[int32]uint64, len(processes))}
+	for _, p := range processes {
+		sample.cpu[p.Pid] = p.Cpu
+	}
+	return sample
+}
+
+// cpuPercent returns the CPU usage between two samples as a percentage of one
+// CPU. Processes that weren't running at the time of prev, or whose PID has
+// been reused since, count all their CPU time.
+func cpuPercent(prev, cur cpuSample) (float64, bool) {
+	if prev.cpu == nil || !cur.at.After(prev.at) {
+		return 0, false
+	}
+
+	var ticks uint64
+	for pid, cpu := range cur.cpu {
+		if before, ok := prev.cpu[pid]; ok && before <= cpu {
+			cpu -= before
+		}
+		ticks += cpu
+	}
+
+	seconds := float64(ticks) / clockTicksPerSecond
+	return 100 * seconds / cur.at.Sub(prev.at).Seconds(), true
+}
+
+func formatCPU(u machineUsage) string {
+	if !u.hasCPU {
+		return "-"
+	}
+	return fmt.Sprintf("%.1f%%", u.cpu)
+}
+
+type machineTop struct {
+	ctx         context.Context
+	app         *api.AppCompact
+	apiClient   *api.Client
+	flapsClient *flaps.Client
+
+	tui    *tview.Application
+	table  *tview.Table
+	logs   *tview.TextView
+	status *tview.TextView
+	layout *tview.Flex
+
+	mu         sync.Mutex
+	machines   []*api.Machine
+	usage      map[string]machineUsage
+	samples    map[string]cpuSample
+	stopLogs   context.CancelFunc
+	logsTarget string
+}
+
+func runMachineTop(ctx context.Context) error {
+	var (
+		appName   = appconfig.NameFromContext(ctx)
+		apiClient = client.FromContext(ctx).API()
+		io        = iostreams.FromContext(ctx)
+	)
+
+	if !io.IsInteractive() {
+		return fmt.Errorf("machine top requires an interactive terminal")
+	}
+
+	app, err := apiClient.GetAppCompact(ctx, appName)
+	if err != nil {
+		return fmt.Errorf("failed to get app: %w", err)
+	}
+
+	flapsClient, err := flaps.New(ctx, app)
+	if err != nil {
+		return fmt.Errorf("could not create flaps client: %w", err)
+	}
+	ctx = flaps.NewContext(ctx, flapsClient)
+
+	top := &machineTop{
+		ctx:         ctx,
+		app:         app,
+		apiClient:   apiClient,
+		flapsClient: flapsClient,
+		usage:       map[string]machineUsage{},
+		samples:     map[string]cpuSample{},
+	}
+	top.layoutUI()
+
+	// The first refresh happens before the UI starts so that API errors, such
+	// as a missing app, are reported in the terminal instead of the status bar.
+	if err := top.fetch(); err != nil {
+		return err
+	}
+	top.render()
+
+	go top.refreshUntilDone(flag.GetDuration(ctx, "interval"))
+	defer func() {
+		if top.stopLogs != nil {
+			top.stopLogs()
+		}
+	}()
+
+	return top.tui.Run()
+}
+
+func (top *machineTop) layoutUI() {
+	top.table = tview.NewTable().
+		SetSelectable(true, false).
+		SetFixed(1, 0)
+	top.table.SetBorder(true).
+		SetTitle(fmt.Sprintf(" %s machines ", top.app.Name))
+
+	top.logs = tview.NewTextView().
+		SetDynamicColors(true).
+		SetMaxLines(1000).
+		SetChangedFunc(func() { top.tui.Draw() })
+	top.logs.SetBorder(true)
+
+	top.status = tview.NewTextView().
+		SetDynamicColors(true).
+		SetText("[::b]s[::-] start  [::b]t[::-] stop  [::b]r[::-] restart  [::b]l[::-] logs  [::b]c[::-] console  [::b]q[::-] quit")
+
+	top.layout = tview.NewFlex().
+		SetDirection(tview.FlexRow).
+		AddItem(top.table, 0, 1, true).
+		AddItem(top.status, 1, 0, false)
+
+	top.tui = tview.NewApplication().
+		SetRoot(top.layout, true).
+		SetInputCapture(top.handleKey)
+}
+
+func (top *machineTop) handleKey(event *tcell.EventKey) *tcell.EventKey {
+	if event.Key() == tcell.KeyEscape {
+		top.tui.Stop()
+		return nil
+	}
+	if event.Key() != tcell.KeyRune {
+		return event
+	}
+
+	switch event.Rune() {
+	case 'q':
+		top.tui.Stop()
+	case 's':
+		top.act("Starting", func(ctx context.Context, m *api.Machine) error {
+			_, err := top.flapsClient.Start(ctx, m.ID, "")
+			return err
+		})
+	case 't':
+		top.act("Stopping", func(ctx context.Context, m *api.Machine) error {
+			return top.flapsClient.Stop(ctx, api.StopMachineInput{ID: m.ID}, "")
+		})
+	case 'r':
+		top.act("Restarting", func(ctx context.Context, m *api.Machine) error {
+			return top.flapsClient.Restart(ctx, api.RestartMachineInput{ID: m.ID}, "")
+		})
+	case 'l':
+		top.toggleLogs()
+	case 'c':
+		top.console()
+	default:
+		return event
+	}
+	return nil
+}
+
+// selected returns the machine of the selected table row, if any.
+func (top *machineTop) selected() *api.Machine {
+	top.mu.Lock()
+	defer top.mu.Unlock()
+
+	row, _ := top.table.GetSelection()
+	if row < 1 || row > len(top.machines) {
+		return nil
+	}
+	return top.machines[row-1]
+}
+
+func (top *machineTop) setStatus(format string, a ...interface{}) {
+	top.status.SetText(fmt.Sprintf(format, a...))
+}
+
+// act runs the given action against the selected machine in the background
+// and reports its outcome in the status bar.
+func (top *machineTop) act(verb string, action func(context.Context, *api.Machine) error) {
+	m := top.selected()
+	if m == nil {
+		return
+	}
+	top.setStatus("%s machine %s ...", verb, m.ID)
+
+	go func() {
+		err := action(top.ctx, m)
+		top.tui.QueueUpdateDraw(func() {
+			if err != nil {
+				top.setStatus("[red]%s machine %s failed: %s", verb, m.ID, tview.Escape(err.Error()))
+				return
+			}
+			top.setStatus("%s machine %s ... [green]done", verb, m.ID)
+		})
+	}()
+}
+
+// toggleLogs tails the logs of the selected machine, or hides them when they
+// are already shown for it.
+func (top *machineTop) toggleLogs() {
+	top.mu.Lock()
+	stopLogs, target := top.stopLogs, top.logsTarget
+	top.stopLogs, top.logsTarget = nil, ""
+	top.mu.Unlock()
+
+	if stopLogs != nil {
+		stopLogs()
+		top.layout.RemoveItem(top.logs)
+	}
+
+	m := top.selected()
+	if m == nil || m.ID == target {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(top.ctx)
+	top.mu.Lock()
+	top.stopLogs, top.logsTarget = cancel, m.ID
+	top.mu.Unlock()
+
+	top.logs.Clear()
+	top.logs.SetTitle(fmt.Sprintf(" logs of %s ", m.ID))
+	top.layout.RemoveItem(top.status)
+	top.layout.AddItem(top.logs, 0, 1, false)
+	top.layout.AddItem(top.status, 1, 0, false)
+
+	go func() {
+		opts := &logs.LogOptions{
+			AppName: top.app.Name,
+			VMID:    m.ID,
+		}
+		w := tview.ANSIWriter(top.logs)
+
+		stream := logs.NewStream(ctx, top.apiClient, opts)
+		for entry := range stream.Stream(ctx, opts) {
+			_ = render.LogEntry(w, entry,
+				render.HideAllocID(),
+				render.RemoveNewlines(),
+				render.HideRegion(),
+			)
+		}
+	}()
+}
+
+// console suspends the UI and opens an SSH console on the selected machine.
+func (top *machineTop) console() {
+	m := top.selected()
+	if m == nil {
+		return
+	}
+
+	var err error
+	top.tui.Suspend(func() {
+		_, dialer, agentErr := ssh.BringUpAgent(top.ctx, top.apiClient, top.app, false)
+		if agentErr != nil {
+			err = agentErr
+			return
+		}
+
+		params := &ssh.ConnectParams{
+			Ctx:      top.ctx,
+			Org:      top.app.Organization,
+			Dialer:   dialer,
+			Username: flag.GetString(top.ctx, "user"),
+		}
+		sshClient, connErr := ssh.Connect(params, m.PrivateIP)
+		if connErr != nil {
+			err = connErr
+			return
+		}
+		err = ssh.Console(top.ctx, sshClient, "", true)
+	})
+
+	if err != nil {
+		top.setStatus("[red]Console on machine %s failed: %s", m.ID, tview.Escape(err.Error()))
+	}
+}
+
+func (top *machineTop) refreshUntilDone(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-top.ctx.Done():
+			top.tui.Stop()
+			return
+		case <-ticker.C:
+		}
+
+		err := top.fetch()
+		top.tui.QueueUpdateDraw(func() {
+			if err != nil {
+				top.setStatus("[red]Refreshing machines failed: %s", tview.Escape(err.Error()))
+				return
+			}
+			top.render()
+		})
+	}
+}
+
+// fetch refreshes the machine list and the resource usage of started
+// machines.
+func (top *machineTop) fetch() error {
+	machines, err := top.flapsClient.List(top.ctx, "")
+	if err != nil {
+		return fmt.Errorf("could not get a list of machines: %w", err)
+	}
+	sort.Slice(machines, func(i, j int) bool {
+		if machines[i].ProcessGroup() != machines[j].ProcessGroup() {
+			return machines[i].ProcessGroup() < machines[j].ProcessGroup()
+		}
+		return machines[i].ID < machines[j].ID
+	})
+
+	top.mu.Lock()
+	prevSamples := top.samples
+	top.mu.Unlock()
+
+	var (
+		usageMu sync.Mutex
+		usage   = map[string]machineUsage{}
+		samples = map[string]cpuSample{}
+		eg      errgroup.Group
+	)
+	eg.SetLimit(8)
+	for _, m := range machines {
+		m := m
+		if m.State != api.MachineStateStarted {
+			continue
+		}
+		eg.Go(func() error {
+			processes, err := top.flapsClient.GetProcesses(top.ctx, m.ID)
+			if err != nil {
+				// Older inits don't report processes; leave the usage blank.
+				return nil
+			}
+
+			var u machineUsage
+			for _, p := range processes {
+				u.rss += p.Rss
+			}
+
+			// The init reports cumulative CPU time, so usage is the difference
+			// with the previous refresh over the time elapsed in between.
+			sample := newCPUSample(processes, time.Now())
+			u.cpu, u.hasCPU = cpuPercent(prevSamples[m.ID], sample)
+
+			usageMu.Lock()
+			usage[m.ID] = u
+			samples[m.ID] = sample
+			usageMu.Unlock()
+			return nil
+		})
+	}
+	_ = eg.Wait()
+
+	top.mu.Lock()
+	top.machines, top.usage, top.samples = machines, usage, samples
+	top.mu.Unlock()
+	return nil
+}
+
+func (top *machineTop) render() {
+	top.mu.Lock()
+	defer top.mu.Unlock()
+
+	headers := []string{"ID", "NAME", "STATE", "REGION", "PROCESS GROUP", "VERSION", "CHECKS", "CPU", "MEMORY"}
+	for col, header := range headers {
+		top.table.SetCell(0, col, tview.NewTableCell(header).
+			SetAttributes(tcell.AttrBold).
+			SetSelectable(false))
+	}
+
+	for i, m := range top.machines {
+		var cpu, mem string
+		if u, ok := top.usage[m.ID]; ok {
+			cpu = formatCPU(u)
+			mem = humanize.IBytes(u.rss)
+		}
+
+		row := []string{
+			m.ID,
+			m.Name,
+			m.State,
+			m.Region,
+			m.ProcessGroup(),
+			m.ImageVersion(),
+			render.MachineHealthChecksSummary(m),
+			cpu,
+			mem,
+		}
+		for col, text := range row {
+			cell := tview.NewTableCell(tview.Escape(text))
+			if col == 2 {
+				cell.SetTextColor(stateColor(m.State))
+			}
+			top.table.SetCell(i+1, col, cell)
+		}
+	}
+
+	for row := top.table.GetRowCount() - 1; row > len(top.machines); row-- {
+		top.table.RemoveRow(row)
+	}
+}
+
+func stateColor(state string) tcell.Color {
+	switch state {
+	case api.MachineStateStarted:
+		return tcell.ColorGreen
+	case api.MachineStateStopped, api.MachineStateCreated:
+		return tcell.ColorYellow
+	case api.MachineStateDestroyed, api.MachineStateDestroying:
+		return tcell.ColorRed
+	default:
+		return tcell.ColorDefault
+	}
+}
@@ -0,0 +1,56 @@
+package machine
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/superfly/flyctl/api"
+)
+
+func TestCPUPercent(t *testing.T) {
+	start := time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	first := newCPUSample(api.MachinePsResponse{
+		{Pid: 1, Cpu: 1000},
+		{Pid: 20, Cpu: 5000},
+		{Pid: 30, Cpu: 700},
+	}, start)
+
+	// The first sample has nothing to compare with.
+	_, ok := cpuPercent(cpuSample{}, first)
+	assert.False(t, ok)
+
+	// Over 2s: PID 1 uses 10 ticks, PID 20 100 ticks, PID 30 exits, PID 40
+	// starts and uses 40 ticks, and PID 30 is reused by a process that used
+	// 50 ticks. That's 200 ticks, or 1s of CPU time per second.
+	second := newCPUSample(api.MachinePsResponse{
+		{Pid: 1, Cpu: 1010},
+		{Pid: 20, Cpu: 5100},
+		{Pid: 40, Cpu: 40},
+		{Pid: 30, Cpu: 50},
+	}, start.Add(2*time.Second))
+
+	cpu, ok := cpuPercent(first, second)
+	assert.True(t, ok)
+	assert.InDelta(t, 100.0, cpu, 0.001)
+
+	// Idle machines use no CPU, however long they've been running.
+	third := newCPUSample(api.MachinePsResponse{
+		{Pid: 1, Cpu: 1010},
+		{Pid: 20, Cpu: 5100},
+	}, start.Add(4*time.Second))
+
+	cpu, ok = cpuPercent(second, third)
+	assert.True(t, ok)
+	assert.Zero(t, cpu)
+
+	_, ok = cpuPercent(third, third)
+	assert.False(t, ok)
+}
+
+func TestFormatCPU(t *testing.T) {
+	assert.Equal(t, "-", formatCPU(machineUsage{}))
+	assert.Equal(t, "12.5%", formatCPU(machineUsage{cpu: 12.5, hasCPU: true}))
+}
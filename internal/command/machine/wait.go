@@ -0,0 +1,104 @@
+package machine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/samber/lo"
+	"github.com/spf13/cobra"
+
+	"github.com/superfly/flyctl/api"
+	"github.com/superfly/flyctl/internal/command"
+	"github.com/superfly/flyctl/internal/config"
+	"github.com/superfly/flyctl/internal/flag"
+	mach "github.com/superfly/flyctl/internal/machine"
+	"github.com/superfly/flyctl/internal/render"
+	"github.com/superfly/flyctl/iostreams"
+)
+
+var waitStates = []string{api.MachineStateStarted, api.MachineStateStopped, api.MachineStateDestroyed}
+
+func newWait() *cobra.Command {
+	const (
+		short = "Wait for one or more machines to reach a state"
+		long  = short + `
+
+Blocks until every given machine is in the desired state, then prints the
+final state of the machines. Fails if the timeout is reached first.
+`
+		usage = "wait <id> [<id>...]"
+	)
+
+	cmd := command.New(usage, short, long, runMachineWait,
+		command.RequireSession,
+		command.LoadAppNameIfPresent,
+	)
+
+	cmd.Args = cobra.ArbitraryArgs
+
+	flag.Add(
+		cmd,
+		flag.App(),
+		flag.AppConfig(),
+		flag.JSONOutput(),
+		selectFlag,
+		flag.String{
+			Name:        "state",
+			Description: "The state to wait for (started, stopped or destroyed)",
+			Default:     api.MachineStateStarted,
+		},
+		flag.Duration{
+			Name:        "timeout",
+			Description: "How long to wait for the machines to reach the state",
+			Default:     5 * time.Minute,
+		},
+	)
+
+	return cmd
+}
+
+func runMachineWait(ctx context.Context) error {
+	var (
+		io    = iostreams.FromContext(ctx)
+		json  = config.FromContext(ctx).JSONOutput
+		state = flag.GetString(ctx, "state")
+	)
+
+	if !lo.Contains(waitStates, state) {
+		return fmt.Errorf("invalid state '%s', must be one of: %v", state, waitStates)
+	}
+
+	machineIDs, ctx, err := selectManyMachineIDs(ctx, flag.Args(ctx))
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, flag.GetDuration(ctx, "timeout"))
+	defer cancel()
+
+	var machines []*api.Machine
+	for _, machineID := range machineIDs {
+		machine, err := mach.WaitForState(ctx, machineID, state)
+		if err != nil {
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return fmt.Errorf("timeout reached waiting for machine %s to be %s: %w", machineID, state, ctx.Err())
+			}
+			if err := rewriteMachineNotFoundErrors(ctx, err, machineID); err != nil {
+				return err
+			}
+			return fmt.Errorf("failed waiting for machine %s to be %s: %w", machineID, state, err)
+		}
+		machines = append(machines, machine)
+
+		if !json {
+			fmt.Fprintf(io.Out, "%s is %s\n", machineID, machine.State)
+		}
+	}
+
+	if json {
+		return render.JSON(io.Out, machines)
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/spf13/cobra"
+
+	"github.com/superfly/flyctl/agent"
+	"github.com/superfly/flyctl/client"
+	"github.com/superfly/flyctl/internal/command"
+	"github.com/superfly/flyctl/internal/config"
+	"github.com/superfly/flyctl/internal/flag"
+	"github.com/superfly/flyctl/internal/format"
+	"github.com/superfly/flyctl/internal/render"
+	"github.com/superfly/flyctl/iostreams"
+)
+
+func newList() *cobra.Command {
+	const (
+		short = "List the proxies the Fly agent runs in the background"
+		long  = short + "\n"
+	)
+
+	cmd := command.New("list", short, long, runList,
+		command.RequireSession)
+
+	cmd.Args = cobra.NoArgs
+	cmd.Aliases = []string{"ls"}
+
+	flag.Add(cmd, flag.JSONOutput())
+
+	return cmd
+}
+
+func runList(ctx context.Context) error {
+	// establishing the agent starts it, restoring its proxies, if needed
+	agentclient, err := agent.Establish(ctx, client.FromContext(ctx).API())
+	if err != nil {
+		return err
+	}
+
+	forwards, err := agentclient.Forwards(ctx)
+	if err != nil {
+		return fmt.Errorf("failed listing background proxies: %w", err)
+	}
+
+	out := iostreams.FromContext(ctx).Out
+	if config.FromContext(ctx).JSONOutput {
+		return render.JSON(out, forwards)
+	}
+
+	rows := make([][]string, 0, len(forwards))
+	for _, f := range forwards {
+		rows = append(rows, []string{
+			f.Local,
+			f.Remote,
+			f.Org,
+			f.App,
+			format.RelativeTime(f.CreatedAt),
+			strconv.FormatUint(f.TotalConnections, 10),
+			f.Error,
+		})
+	}
+
+	return render.Table(out, "", rows, "Local", "Remote", "Org", "App", "Created", "Connections", "Error")
+}
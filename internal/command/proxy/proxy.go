@@ -9,16 +9,31 @@ import (
 	"github.com/spf13/cobra"
 	"github.com/superfly/flyctl/agent"
 	"github.com/superfly/flyctl/client"
+	"github.com/superfly/flyctl/flaps"
 	"github.com/superfly/flyctl/internal/appconfig"
 	"github.com/superfly/flyctl/internal/command"
 	"github.com/superfly/flyctl/internal/flag"
+	"github.com/superfly/flyctl/internal/machine"
 	"github.com/superfly/flyctl/internal/prompt"
+	"github.com/superfly/flyctl/iostreams"
 	"github.com/superfly/flyctl/proxy"
 )
 
 func New() *cobra.Command {
 	var (
-		long  = strings.Trim(`Proxies connections to a fly VM through a Wireguard tunnel The current application DNS is the default remote host`, "\n")
+		long = strings.Trim(`Proxies connections to a fly VM through a Wireguard tunnel The current application DNS is the default remote host
+
+With --udp, UDP datagrams are relayed rather than TCP connections, and every
+local source address gets a flow of its own, closed once idle for
+--udp-idle-timeout.
+
+With --machine, --process-group or --select-meta, connections go to the
+started machine of the application they select rather than to remote_host. A
+selection that matches more than one machine is an error.
+
+With --background, the Fly agent keeps proxying after flyctl exits, across
+tunnel reconnections and agent restarts, until the proxy is stopped with
+'fly proxy stop'. List background proxies with 'fly proxy list'.`, "\n")
 		short = `Proxies connections to a fly VM`
 	)
 
@@ -27,6 +42,11 @@ func New() *cobra.Command {
 
 	cmd.Args = cobra.RangeArgs(1, 2)
 
+	cmd.AddCommand(
+		newList(),
+		newStop(),
+	)
+
 	flag.Add(cmd,
 		flag.App(),
 		flag.AppConfig(),
@@ -42,6 +62,21 @@ func New() *cobra.Command {
 			Shorthand:   "q",
 			Description: "Don't print progress indicators for WireGuard",
 		},
+		flag.Bool{
+			Name:        "background",
+			Shorthand:   "b",
+			Description: "Have the Fly agent run the proxy in the background",
+		},
+		flag.Bool{
+			Name:        "udp",
+			Description: "Relay UDP datagrams rather than TCP connections",
+		},
+		flag.Duration{
+			Name:        "udp-idle-timeout",
+			Description: "Close UDP flows without traffic for this long",
+			Default:     proxy.DefaultUDPIdleTimeout,
+		},
+		machine.SelectFlags,
 	)
 
 	return cmd
@@ -53,11 +88,16 @@ func run(ctx context.Context) (err error) {
 	orgSlug := flag.GetString(ctx, "org")
 	args := flag.Args(ctx)
 	promptInstance := flag.GetBool(ctx, "select")
+	udp := flag.GetBool(ctx, "udp")
 
 	if promptInstance && appName == "" {
 		return errors.New("--app required when --select flag provided")
 	}
 
+	if udp && flag.GetBool(ctx, "background") {
+		return errors.New("--udp can't be combined with --background")
+	}
+
 	if orgSlug != "" {
 		_, err := client.GetOrganizationBySlug(ctx, orgSlug)
 		if err != nil {
@@ -106,13 +146,79 @@ func run(ctx context.Context) (err error) {
 		OrganizationSlug: orgSlug,
 		Dialer:           dialer,
 		PromptInstance:   promptInstance,
+		UDP:              udp,
+		UDPIdleTimeout:   flag.GetDuration(ctx, "udp-idle-timeout"),
 	}
 
-	if len(args) > 1 {
+	selector, err := machine.SelectorFromFlags(ctx)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case selector != nil:
+		if len(args) > 1 || promptInstance {
+			return errors.New("--machine, --process-group and --select-meta can't be used with remote_host or --select")
+		}
+
+		if params.RemoteHost, err = selectedMachineAddr(ctx, appName, selector); err != nil {
+			return err
+		}
+	case len(args) > 1:
 		params.RemoteHost = args[1]
-	} else {
+	default:
 		params.RemoteHost = fmt.Sprintf("%s.internal", appName)
 	}
 
+	if flag.GetBool(ctx, "background") {
+		return background(ctx, agentclient, params)
+	}
+
 	return proxy.Connect(ctx, params)
 }
+
+// selectedMachineAddr returns the address of the started machine of the app
+// the selector selects.
+func selectedMachineAddr(ctx context.Context, appName string, selector *machine.Selector) (string, error) {
+	if appName == "" {
+		return "", errors.New("--app required when selecting machines")
+	}
+
+	app, err := client.FromContext(ctx).API().GetAppCompact(ctx, appName)
+	if err != nil {
+		return "", err
+	}
+	if app.PlatformVersion != "machines" {
+		return "", errors.New("selecting machines is only supported for apps on machines")
+	}
+
+	flapsClient, err := flaps.New(ctx, app)
+	if err != nil {
+		return "", err
+	}
+
+	m, err := selector.SelectOne(ctx, flapsClient)
+	if err != nil {
+		return "", err
+	}
+
+	return m.PrivateIP, nil
+}
+
+func background(ctx context.Context, agentclient *agent.Client, params *proxy.ConnectParams) error {
+	remote, err := proxy.RemoteAddr(ctx, params)
+	if err != nil {
+		return err
+	}
+
+	fwd, err := agentclient.Forward(ctx, params.OrganizationSlug, params.AppName, params.Ports[0], remote)
+	if err != nil {
+		return fmt.Errorf("failed starting background proxy: %w", err)
+	}
+
+	io := iostreams.FromContext(ctx)
+	fmt.Fprintf(io.Out, "Proxying local port %s to remote %s in the background\n", fwd.Local, fwd.Remote)
+	fmt.Fprintf(io.Out, "Stop it with: fly proxy stop %s\n", fwd.Local)
+
+	return nil
+}
@@ -0,0 +1,53 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/superfly/flyctl/agent"
+	"github.com/superfly/flyctl/client"
+	"github.com/superfly/flyctl/internal/command"
+	"github.com/superfly/flyctl/internal/flag"
+	"github.com/superfly/flyctl/iostreams"
+)
+
+func newStop() *cobra.Command {
+	const (
+		short = "Stop proxies the Fly agent runs in the background"
+		long  = `Stop the proxies of the given local ports, or unix socket paths, that the
+Fly agent runs in the background.
+`
+	)
+
+	cmd := command.New("stop <local>...", short, long, runStop,
+		command.RequireSession)
+
+	cmd.Args = cobra.MinimumNArgs(1)
+
+	return cmd
+}
+
+func runStop(ctx context.Context) error {
+	// the agent forgets the proxies, so it's started if needed
+	agentclient, err := agent.Establish(ctx, client.FromContext(ctx).API())
+	if err != nil {
+		return err
+	}
+
+	io := iostreams.FromContext(ctx)
+	for _, local := range flag.Args(ctx) {
+		switch err := agentclient.Unforward(ctx, local); {
+		case errors.Is(err, agent.ErrNoSuchForward):
+			return fmt.Errorf("no background proxy on %s", local)
+		case err != nil:
+			return fmt.Errorf("failed stopping background proxy on %s: %w", local, err)
+		}
+
+		fmt.Fprintf(io.Out, "Stopped proxying local port %s\n", local)
+	}
+
+	return nil
+}
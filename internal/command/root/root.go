@@ -49,6 +49,7 @@ import (
 	"github.com/superfly/flyctl/internal/command/releases"
 	"github.com/superfly/flyctl/internal/command/restart"
 	"github.com/superfly/flyctl/internal/command/resume"
+	"github.com/superfly/flyctl/internal/command/runtask"
 	"github.com/superfly/flyctl/internal/command/scale"
 	"github.com/superfly/flyctl/internal/command/secrets"
 	"github.com/superfly/flyctl/internal/command/services"
@@ -157,6 +158,7 @@ To read more, use the docs command to view Fly's help on the web.
 		autoscale.New(),
 		domains.New(),
 		console.New(),
+		runtask.New(),
 		settings.New(),
 	)
 
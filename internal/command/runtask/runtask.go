@@ -0,0 +1,294 @@
+// Package runtask implements the run-task command.
+package runtask
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/azazeal/pause"
+	"github.com/google/shlex"
+	"github.com/spf13/cobra"
+
+	"github.com/superfly/flyctl/api"
+	"github.com/superfly/flyctl/client"
+	"github.com/superfly/flyctl/flaps"
+	"github.com/superfly/flyctl/helpers"
+	"github.com/superfly/flyctl/internal/appconfig"
+	"github.com/superfly/flyctl/internal/command"
+	"github.com/superfly/flyctl/internal/flag"
+	"github.com/superfly/flyctl/internal/machine"
+	"github.com/superfly/flyctl/internal/render"
+	"github.com/superfly/flyctl/iostreams"
+	"github.com/superfly/flyctl/logs"
+	"github.com/superfly/flyctl/terminal"
+)
+
+func New() *cobra.Command {
+	const (
+		usage = "run-task <command>"
+		short = "Run a one-off task in an ephemeral machine"
+		long  = "Run a one-off task, such as a migration, in an ephemeral machine created\n" +
+			"from the app's most recently deployed image. The machine gets the app's\n" +
+			"environment and secrets but no mounts or services. Its logs are streamed\n" +
+			"until the task exits, and flyctl exits with the task's exit code. The\n" +
+			"machine is always destroyed once the task is done.\n\n" +
+			"The command can be given as a single quoted string or after '--'."
+	)
+	cmd := command.New(usage, short, long, runTask, command.RequireSession, command.RequireAppName)
+
+	cmd.Args = cobra.MinimumNArgs(1)
+	flag.Add(
+		cmd,
+		flag.App(),
+		flag.AppConfig(),
+		flag.Region(),
+		flag.Detach(),
+		flag.String{
+			Name:        "vm-size",
+			Description: "Use a preset size for the task machine",
+			Default:     "shared-cpu-1x",
+		},
+		flag.Duration{
+			Name:        "timeout",
+			Description: "Destroy the task machine if it runs longer than this duration (0 means no timeout)",
+		},
+	)
+
+	return cmd
+}
+
+// exitCodeError reports a task that exited unsuccessfully and carries its exit
+// code so that flyctl can exit with it.
+type exitCodeError struct {
+	machineID string
+	exitEvent *api.MachineExitEvent
+}
+
+func (e *exitCodeError) Error() string {
+	if e.exitEvent.OOMKilled {
+		return fmt.Sprintf("task machine %s ran out of memory and exited with code %d", e.machineID, e.exitEvent.ExitCode)
+	}
+	return fmt.Sprintf("task machine %s exited with code %d", e.machineID, e.exitEvent.ExitCode)
+}
+
+func (e *exitCodeError) ExitCode() int {
+	return e.exitEvent.ExitCode
+}
+
+func runTask(ctx context.Context) error {
+	var (
+		io        = iostreams.FromContext(ctx)
+		colorize  = io.ColorScheme()
+		appName   = appconfig.NameFromContext(ctx)
+		apiClient = client.FromContext(ctx).API()
+	)
+
+	if flag.GetDetach(ctx) && flag.IsSpecified(ctx, "timeout") {
+		return errors.New("--timeout can't be used with --detach")
+	}
+
+	taskCmd, err := taskCommand(flag.Args(ctx))
+	if err != nil {
+		return err
+	}
+
+	app, err := apiClient.GetAppCompact(ctx, appName)
+	if err != nil {
+		return fmt.Errorf("failed to get app: %w", err)
+	}
+
+	if app.PlatformVersion != "machines" {
+		return errors.New("run-task is only supported for the machines platform")
+	}
+
+	flapsClient, err := flaps.New(ctx, app)
+	if err != nil {
+		return fmt.Errorf("failed to create flaps client: %w", err)
+	}
+	ctx = flaps.NewContext(ctx, flapsClient)
+
+	appConfig := appconfig.ConfigFromContext(ctx)
+	if appConfig == nil {
+		appConfig, err = appconfig.FromRemoteApp(ctx, appName)
+		if err != nil {
+			return fmt.Errorf("failed to fetch app config from backend: %w", err)
+		}
+	}
+
+	currentRelease, err := apiClient.GetAppCurrentReleaseMachines(ctx, app.Name)
+	if err != nil {
+		return err
+	}
+	if currentRelease == nil {
+		return errors.New("can't run a task since the app has not yet been released")
+	}
+
+	machConfig, err := appConfig.ToTaskMachineConfig(taskCmd)
+	if err != nil {
+		return fmt.Errorf("failed to generate task machine configuration: %w", err)
+	}
+	machConfig.Image = currentRelease.ImageRef
+
+	guest := helpers.Clone(api.MachinePresets["shared-cpu-1x"])
+	if err := guest.SetSize(flag.GetString(ctx, "vm-size")); err != nil {
+		return err
+	}
+	machConfig.Guest = guest
+
+	region := flag.GetRegion(ctx)
+	if region == "" {
+		region = appConfig.PrimaryRegion
+	}
+
+	launchInput := api.LaunchMachineInput{
+		Config: machConfig,
+		Region: region,
+	}
+	taskMachine, err := flapsClient.Launch(ctx, launchInput)
+	if err != nil {
+		return fmt.Errorf("failed to launch task machine: %w", err)
+	}
+	fmt.Fprintf(io.ErrOut, "Created task machine %s in region %s\n", colorize.Bold(taskMachine.ID), taskMachine.Region)
+
+	if flag.GetDetach(ctx) {
+		fmt.Fprintf(io.ErrOut, "The machine is destroyed once the task exits. Check its logs with 'fly logs -i %s'.\n", taskMachine.ID)
+		return nil
+	}
+
+	lm := machine.NewLeasableMachine(flapsClient, io, taskMachine)
+
+	destroyed := false
+	defer func() {
+		if destroyed {
+			return
+		}
+
+		const destroyTimeout = 30 * time.Second
+
+		destroyCtx, cancel := context.WithTimeout(context.Background(), destroyTimeout)
+		defer cancel()
+
+		if err := lm.Destroy(destroyCtx, true); err != nil {
+			terminal.Warnf("Failed to destroy task machine %s: %v\n", taskMachine.ID, err)
+			terminal.Warn("You may need to destroy it manually (`fly machine destroy`).")
+			return
+		}
+		fmt.Fprintf(io.ErrOut, "Destroyed task machine %s\n", colorize.Bold(taskMachine.ID))
+	}()
+
+	taskCtx := ctx
+	if timeout := flag.GetDuration(ctx, "timeout"); timeout > 0 {
+		var cancel context.CancelFunc
+		taskCtx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	logsCtx, cancelLogs := context.WithCancel(taskCtx)
+	logsDone := streamLogs(logsCtx, apiClient, appName, taskMachine.ID)
+	defer func() {
+		cancelLogs()
+		<-logsDone
+	}()
+
+	if err := waitForTask(taskCtx, lm); err != nil {
+		if errors.Is(taskCtx.Err(), context.DeadlineExceeded) {
+			return fmt.Errorf("task machine %s did not finish within %s", taskMachine.ID, flag.GetDuration(ctx, "timeout"))
+		}
+		return err
+	}
+	destroyed = true
+
+	// Give the last log lines a chance to reach us before we stop streaming.
+	pause.For(logsCtx, 2*time.Second)
+
+	event, err := lm.WaitForEventTypeAfterType(ctx, "exit", "start", 0, true)
+	if err != nil {
+		return fmt.Errorf("error finding the task machine %s exit event: %w", taskMachine.ID, err)
+	}
+	exitEvent, err := taskExitEvent(taskMachine.ID, event)
+	if err != nil {
+		return err
+	}
+
+	if exitEvent.ExitCode != 0 {
+		return &exitCodeError{machineID: taskMachine.ID, exitEvent: exitEvent}
+	}
+
+	fmt.Fprintf(io.ErrOut, "Task machine %s completed successfully\n", colorize.Bold(taskMachine.ID))
+	return nil
+}
+
+func taskCommand(args []string) ([]string, error) {
+	if len(args) != 1 {
+		return args, nil
+	}
+
+	cmd, err := shlex.Split(args[0])
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse task command: %w", err)
+	}
+	return cmd, nil
+}
+
+// waitForTask waits for the task machine to run to completion, by which time
+// it has been destroyed.
+func waitForTask(ctx context.Context, lm machine.LeasableMachine) error {
+	err := lm.WaitForState(ctx, api.MachineStateStarted, 0, "", true)
+	if err != nil {
+		var flapsErr *flaps.FlapsError
+		if !errors.As(err, &flapsErr) || flapsErr.ResponseStatusCode != http.StatusNotFound {
+			return fmt.Errorf("error waiting for task machine %s to start: %w", lm.Machine().ID, err)
+		}
+		// The machine exited and was destroyed quickly.
+	}
+
+	if err := lm.WaitForState(ctx, api.MachineStateDestroyed, 0, "", true); err != nil {
+		return fmt.Errorf("error waiting for task machine %s to finish running: %w", lm.Machine().ID, err)
+	}
+	return nil
+}
+
+// taskExitEvent returns how the task machine exited, as recorded by its exit
+// event.
+func taskExitEvent(machineID string, event *api.MachineEvent) (*api.MachineExitEvent, error) {
+	var exitEvent *api.MachineExitEvent
+	if event.Request != nil {
+		exitEvent = event.Request.GetExitEvent()
+	}
+	if exitEvent == nil {
+		return nil, fmt.Errorf("error getting task machine %s exit code: its exit event has none", machineID)
+	}
+	return exitEvent, nil
+}
+
+// streamLogs prints the logs of the task machine until ctx is done. The
+// returned channel is closed once streaming has stopped.
+func streamLogs(ctx context.Context, apiClient *api.Client, appName, machineID string) <-chan struct{} {
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		var (
+			out  = iostreams.FromContext(ctx).Out
+			opts = &logs.LogOptions{
+				AppName: appName,
+				VMID:    machineID,
+			}
+		)
+
+		stream := logs.NewStream(ctx, apiClient, opts)
+		for entry := range stream.Stream(ctx, opts) {
+			_ = render.LogEntry(out, entry,
+				render.HideAllocID(),
+				render.RemoveNewlines(),
+				render.HideRegion(),
+			)
+		}
+	}()
+
+	return done
+}
@@ -0,0 +1,75 @@
+package runtask
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/superfly/flyctl/api"
+	"github.com/superfly/flyctl/internal/flyerr"
+)
+
+func TestTaskExitEvent(t *testing.T) {
+	exit := &api.MachineExitEvent{ExitCode: 1}
+	monitorExit := &api.MachineExitEvent{ExitCode: 137, OOMKilled: true}
+
+	// the monitor's exit event is preferred
+	got, err := taskExitEvent("m1", &api.MachineEvent{Type: "exit", Request: &api.MachineRequest{
+		ExitEvent:    exit,
+		MonitorEvent: &api.MachineMonitorEvent{ExitEvent: monitorExit},
+	}})
+	require.NoError(t, err)
+	assert.Same(t, monitorExit, got)
+
+	got, err = taskExitEvent("m1", &api.MachineEvent{Type: "exit", Request: &api.MachineRequest{ExitEvent: exit}})
+	require.NoError(t, err)
+	assert.Same(t, exit, got)
+
+	_, err = taskExitEvent("m1", &api.MachineEvent{Type: "exit", Request: &api.MachineRequest{}})
+	assert.EqualError(t, err, "error getting task machine m1 exit code: its exit event has none")
+
+	_, err = taskExitEvent("m1", &api.MachineEvent{Type: "exit"})
+	assert.Error(t, err)
+}
+
+func TestExitCodeError(t *testing.T) {
+	cases := []struct {
+		exitEvent *api.MachineExitEvent
+		message   string
+		code      int
+	}{
+		{
+			exitEvent: &api.MachineExitEvent{ExitCode: 3},
+			message:   "task machine m1 exited with code 3",
+			code:      3,
+		},
+		{
+			exitEvent: &api.MachineExitEvent{ExitCode: 137, OOMKilled: true},
+			message:   "task machine m1 ran out of memory and exited with code 137",
+			code:      137,
+		},
+	}
+
+	for _, c := range cases {
+		err := &exitCodeError{machineID: "m1", exitEvent: c.exitEvent}
+		assert.EqualError(t, err, c.message)
+
+		code, ok := flyerr.GetErrorExitCode(err)
+		assert.True(t, ok)
+		assert.Equal(t, c.code, code)
+	}
+}
+
+func TestTaskCommand(t *testing.T) {
+	cmd, err := taskCommand([]string{"bin/rails db:migrate --trace"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"bin/rails", "db:migrate", "--trace"}, cmd)
+
+	cmd, err = taskCommand([]string{"echo", "a b"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"echo", "a b"}, cmd)
+
+	_, err = taskCommand([]string{`echo "unterminated`})
+	assert.Error(t, err)
+}
@@ -0,0 +1,493 @@
+package ssh
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+	xssh "golang.org/x/crypto/ssh"
+
+	"github.com/superfly/flyctl/api"
+	"github.com/superfly/flyctl/internal/command"
+	"github.com/superfly/flyctl/internal/config"
+	"github.com/superfly/flyctl/internal/env"
+	"github.com/superfly/flyctl/internal/filemu"
+	"github.com/superfly/flyctl/internal/flag"
+	"github.com/superfly/flyctl/internal/format"
+	"github.com/superfly/flyctl/internal/render"
+	"github.com/superfly/flyctl/internal/state"
+	"github.com/superfly/flyctl/iostreams"
+	"github.com/superfly/flyctl/terminal"
+)
+
+const (
+	// certRefreshMargin is how long before its expiry a cached certificate is
+	// replaced.
+	certRefreshMargin = 10 * time.Minute
+
+	// cachedCertHours is how long the certificates flyctl issues for itself
+	// are valid.
+	cachedCertHours = 24
+
+	// singleUseCertsEnvKey has flyctl issue a certificate, valid for an hour,
+	// for every connection and keep its key in memory only, rather than cache
+	// one on disk.
+	singleUseCertsEnvKey = "FLY_SSH_SINGLE_USE_CERTS"
+)
+
+// certMu serializes the issuing of certificates within the process, so that
+// concurrent connections share one. The file lock only guards against other
+// processes.
+var certMu sync.Mutex
+
+// cachedCert is a certificate of an organization, and its key, that flyctl
+// keeps to reuse.
+type cachedCert struct {
+	slug    string
+	keyPath string
+
+	cert   *xssh.Certificate
+	text   string
+	keyPEM []byte
+}
+
+func (c *cachedCert) validAfter() time.Time {
+	return time.Unix(int64(c.cert.ValidAfter), 0)
+}
+
+func (c *cachedCert) validBefore() time.Time {
+	if c.cert.ValidBefore == xssh.CertTimeInfinity {
+		return time.Now().AddDate(100, 0, 0)
+	}
+
+	return time.Unix(int64(c.cert.ValidBefore), 0)
+}
+
+// fresh reports whether the certificate is valid for a while longer.
+func (c *cachedCert) fresh() bool {
+	now := time.Now()
+
+	return !now.Before(c.validAfter()) && c.validBefore().Sub(now) > certRefreshMargin
+}
+
+// hours returns how many hours the certificate is valid for, within what can
+// be issued.
+func (c *cachedCert) hours() int {
+	hours := int(c.validBefore().Sub(c.validAfter()).Round(time.Hour) / time.Hour)
+
+	switch {
+	case hours < 1:
+		return 1
+	case hours > 72:
+		return 72
+	default:
+		return hours
+	}
+}
+
+func (c *cachedCert) status() string {
+	switch until := time.Until(c.validBefore()); {
+	case until <= 0:
+		return "expired"
+	case until <= certRefreshMargin:
+		return "expiring"
+	default:
+		return "valid"
+	}
+}
+
+// checkOrgSlug checks that slug names an organization rather than a path,
+// since cached certificates are kept in a directory named after it.
+func checkOrgSlug(slug string) error {
+	if slug == "" || slug == "." || strings.Contains(slug, "..") || strings.ContainsAny(slug, `/\`) {
+		return fmt.Errorf("invalid organization %q", slug)
+	}
+
+	return nil
+}
+
+// orgKeyPath returns the path of the org's cached key. The certificate goes
+// next to it, like ssh-keygen puts it, so that ssh finds it.
+func orgKeyPath(ctx context.Context, slug string) string {
+	return filepath.Join(certsDir(ctx), slug, "id_ed25519")
+}
+
+func certsDir(ctx context.Context) string {
+	return filepath.Join(state.ConfigDirectory(ctx), "ssh")
+}
+
+// loadCachedCert loads the org's cached certificate, checking that it goes
+// with the key next to it.
+func loadCachedCert(ctx context.Context, slug string) (*cachedCert, error) {
+	keyPath := orgKeyPath(ctx, slug)
+
+	text, err := os.ReadFile(keyPath + "-cert.pub")
+	if err != nil {
+		return nil, err
+	}
+
+	pub, _, _, _, err := xssh.ParseAuthorizedKey(text)
+	if err != nil {
+		return nil, err
+	}
+
+	cert, ok := pub.(*xssh.Certificate)
+	if !ok {
+		return nil, fmt.Errorf("%s-cert.pub isn't a certificate", keyPath)
+	}
+
+	keyPEM, err := os.ReadFile(keyPath)
+	if err != nil {
+		return nil, err
+	}
+
+	signer, err := xssh.ParsePrivateKey(keyPEM)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(signer.PublicKey().Marshal(), cert.Key.Marshal()) {
+		return nil, fmt.Errorf("%s doesn't go with its certificate", keyPath)
+	}
+
+	return &cachedCert{
+		slug:    slug,
+		keyPath: keyPath,
+		cert:    cert,
+		text:    string(text),
+		keyPEM:  keyPEM,
+	}, nil
+}
+
+// orgCertificate returns the org's cached certificate. When there's none, or
+// it's about to expire, it's replaced with a new one that's valid for as
+// long. With FLY_SSH_SINGLE_USE_CERTS set, it returns a new certificate that's
+// valid for an hour and isn't cached instead.
+func orgCertificate(ctx context.Context, org api.OrganizationImpl) (*cachedCert, error) {
+	if env.IsTruthy(singleUseCertsEnvKey) {
+		icert, priv, err := issueSSHCertificate(ctx, org, 1)
+		if err != nil {
+			return nil, err
+		}
+
+		return uncachedCert(org.GetSlug(), icert, priv)
+	}
+
+	if err := checkOrgSlug(org.GetSlug()); err != nil {
+		return nil, err
+	}
+
+	certMu.Lock()
+	defer certMu.Unlock()
+
+	if c, err := loadCachedCert(ctx, org.GetSlug()); err == nil && c.fresh() {
+		return c, nil
+	}
+
+	return replaceOrgCertificate(ctx, org, cachedCertHours, true)
+}
+
+// issueOrgCertificate replaces the org's cached certificate with a new one
+// that's valid for the given hours.
+func issueOrgCertificate(ctx context.Context, org api.OrganizationImpl, hours int) (*cachedCert, error) {
+	if err := checkOrgSlug(org.GetSlug()); err != nil {
+		return nil, err
+	}
+
+	certMu.Lock()
+	defer certMu.Unlock()
+
+	return replaceOrgCertificate(ctx, org, hours, false)
+}
+
+// replaceOrgCertificate issues the org a certificate and caches it. With
+// reuse, a fresh certificate another process cached in the meantime is
+// returned instead, and an expiring one is replaced with one valid for as
+// long.
+func replaceOrgCertificate(ctx context.Context, org api.OrganizationImpl, hours int, reuse bool) (*cachedCert, error) {
+	slug := org.GetSlug()
+	keyPath := orgKeyPath(ctx, slug)
+
+	if err := os.MkdirAll(filepath.Dir(keyPath), 0o700); err != nil {
+		return nil, err
+	}
+
+	unlock, err := filemu.Lock(ctx, keyPath+".lock")
+	if err != nil {
+		// another flyctl is busy replacing it; use a certificate of our own
+		terminal.Debugf("not caching ssh certificate for %s: %v\n", slug, err)
+
+		icert, priv, err := issueSSHCertificate(ctx, org, hours)
+		if err != nil {
+			return nil, err
+		}
+
+		return uncachedCert(slug, icert, priv)
+	}
+	defer unlock()
+
+	if reuse {
+		if c, err := loadCachedCert(ctx, slug); err == nil {
+			if c.fresh() {
+				return c, nil
+			}
+			hours = c.hours()
+		}
+	}
+
+	icert, priv, err := issueSSHCertificate(ctx, org, hours)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := writeOrgKey(keyPath, icert, priv); err != nil {
+		return nil, err
+	}
+
+	return loadCachedCert(ctx, slug)
+}
+
+func uncachedCert(slug string, icert *api.IssuedCertificate, priv ed25519.PrivateKey) (*cachedCert, error) {
+	pub, _, _, _, err := xssh.ParseAuthorizedKey([]byte(icert.Certificate))
+	if err != nil {
+		return nil, err
+	}
+
+	cert, ok := pub.(*xssh.Certificate)
+	if !ok {
+		return nil, errors.New("SSH public key must be a certificate")
+	}
+
+	return &cachedCert{
+		slug:   slug,
+		cert:   cert,
+		text:   icert.Certificate,
+		keyPEM: MarshalED25519PrivateKey(priv, "fly.io"),
+	}, nil
+}
+
+// writeOrgKey writes the key and its certificate through temporary files, so
+// that neither is seen half written.
+func writeOrgKey(keyPath string, icert *api.IssuedCertificate, priv ed25519.PrivateKey) error {
+	if err := writeFileAtomic(keyPath, MarshalED25519PrivateKey(priv, "fly.io")); err != nil {
+		return err
+	}
+
+	return writeFileAtomic(keyPath+"-cert.pub", []byte(icert.Certificate))
+}
+
+func writeFileAtomic(path string, data []byte) error {
+	tmp := path + ".tmp"
+
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp, path); err != nil {
+		_ = os.Remove(tmp)
+
+		return err
+	}
+
+	return nil
+}
+
+// cachedCerts returns the certificates cached for every organization.
+func cachedCerts(ctx context.Context) ([]*cachedCert, []error) {
+	entries, err := os.ReadDir(certsDir(ctx))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+
+		return nil, []error{err}
+	}
+
+	var (
+		certs []*cachedCert
+		errs  []error
+	)
+
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+
+		switch c, err := loadCachedCert(ctx, entry.Name()); {
+		case errors.Is(err, fs.ErrNotExist):
+		case err != nil:
+			errs = append(errs, fmt.Errorf("%s: %w", entry.Name(), err))
+		default:
+			certs = append(certs, c)
+		}
+	}
+
+	sort.Slice(certs, func(i, j int) bool {
+		return certs[i].slug < certs[j].slug
+	})
+
+	return certs, errs
+}
+
+func newCerts() *cobra.Command {
+	const (
+		long = `Manage the SSH certificates flyctl caches per organization. flyctl reuses
+a certificate until it's about to expire, then replaces it.
+
+Certificates are valid for 24 hours and their private keys are kept on disk,
+readable only by you, under the flyctl configuration directory. Set
+FLY_SSH_SINGLE_USE_CERTS=1 to have flyctl issue a certificate valid for an
+hour for every connection instead, keeping its key in memory only.`
+		short = "Manage cached SSH certificates"
+	)
+
+	cmd := command.New("certs", short, long, nil)
+
+	cmd.AddCommand(
+		newCertsList(),
+		newCertsRevokeLocal(),
+	)
+
+	return cmd
+}
+
+func newCertsList() *cobra.Command {
+	const (
+		short = "List cached SSH certificates"
+		long  = short + "\n"
+	)
+
+	cmd := command.New("list", short, long, runCertsList)
+
+	cmd.Args = cobra.NoArgs
+	cmd.Aliases = []string{"ls"}
+
+	flag.Add(cmd, flag.JSONOutput())
+
+	return cmd
+}
+
+type certInfo struct {
+	Org         string    `json:"org"`
+	Principals  []string  `json:"principals"`
+	ValidAfter  time.Time `json:"valid_after"`
+	ValidBefore time.Time `json:"valid_before"`
+	Status      string    `json:"status"`
+	Path        string    `json:"path"`
+}
+
+func runCertsList(ctx context.Context) error {
+	io := iostreams.FromContext(ctx)
+
+	certs, errs := cachedCerts(ctx)
+	for _, err := range errs {
+		fmt.Fprintf(io.ErrOut, "failed loading cached certificate %v\n", err)
+	}
+
+	infos := make([]certInfo, 0, len(certs))
+	for _, c := range certs {
+		infos = append(infos, certInfo{
+			Org:         c.slug,
+			Principals:  c.cert.ValidPrincipals,
+			ValidAfter:  c.validAfter(),
+			ValidBefore: c.validBefore(),
+			Status:      c.status(),
+			Path:        c.keyPath + "-cert.pub",
+		})
+	}
+
+	if config.FromContext(ctx).JSONOutput {
+		return render.JSON(io.Out, infos)
+	}
+
+	rows := make([][]string, 0, len(infos))
+	for _, info := range infos {
+		rows = append(rows, []string{
+			info.Org,
+			strings.Join(info.Principals, ","),
+			format.RelativeTime(info.ValidAfter),
+			info.ValidBefore.Local().Format(time.RFC3339),
+			info.Status,
+		})
+	}
+
+	return render.Table(io.Out, "", rows, "Org", "Principals", "Issued", "Expires", "Status")
+}
+
+func newCertsRevokeLocal() *cobra.Command {
+	const (
+		short = "Delete cached SSH certificates"
+		long  = `Delete the SSH certificate, and its key, cached for the organizations, or
+for every organization with --all. Certificates stay valid until they expire;
+this only deletes flyctl's copies, so that new ones are issued.`
+	)
+
+	cmd := command.New("revoke-local [org]...", short, long, runCertsRevokeLocal)
+
+	flag.Add(cmd,
+		flag.Bool{
+			Name:        "all",
+			Description: "Delete the certificates of every organization",
+		},
+	)
+
+	return cmd
+}
+
+func runCertsRevokeLocal(ctx context.Context) error {
+	io := iostreams.FromContext(ctx)
+
+	slugs := flag.Args(ctx)
+	if flag.GetBool(ctx, "all") {
+		if len(slugs) > 0 {
+			return errors.New("--all can't be used with organizations")
+		}
+
+		certs, _ := cachedCerts(ctx)
+		for _, c := range certs {
+			slugs = append(slugs, c.slug)
+		}
+	} else if len(slugs) == 0 {
+		return errors.New("specify the organizations, or --all")
+	}
+
+	for _, slug := range slugs {
+		if err := checkOrgSlug(slug); err != nil {
+			return err
+		}
+	}
+
+	certMu.Lock()
+	defer certMu.Unlock()
+
+	for _, slug := range slugs {
+		keyPath := orgKeyPath(ctx, slug)
+
+		var removed bool
+		for _, path := range []string{keyPath, keyPath + "-cert.pub"} {
+			switch err := os.Remove(path); {
+			case err == nil:
+				removed = true
+			case !errors.Is(err, fs.ErrNotExist):
+				return err
+			}
+		}
+
+		if removed {
+			fmt.Fprintf(io.Out, "Deleted the cached certificate of %s\n", slug)
+		} else {
+			fmt.Fprintf(io.Out, "No certificate is cached for %s\n", slug)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,93 @@
+package ssh
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	xssh "golang.org/x/crypto/ssh"
+
+	"github.com/superfly/flyctl/api"
+	"github.com/superfly/flyctl/internal/state"
+)
+
+// testCert returns a certificate for a new key, signed by a throwaway CA,
+// that's valid for the given window around now.
+func testCert(t *testing.T, from, until time.Duration) (*api.IssuedCertificate, ed25519.PrivateKey) {
+	t.Helper()
+
+	_, caKey, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	ca, err := xssh.NewSignerFromKey(caKey)
+	require.NoError(t, err)
+
+	pub, priv, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	sshPub, err := xssh.NewPublicKey(pub)
+	require.NoError(t, err)
+
+	cert := &xssh.Certificate{
+		Key:             sshPub,
+		CertType:        xssh.UserCert,
+		ValidPrincipals: []string{"root", "fly"},
+		ValidAfter:      uint64(time.Now().Add(from).Unix()),
+		ValidBefore:     uint64(time.Now().Add(until).Unix()),
+	}
+	require.NoError(t, cert.SignCert(rand.Reader, ca))
+
+	return &api.IssuedCertificate{Certificate: string(xssh.MarshalAuthorizedKey(cert))}, priv
+}
+
+func TestCachedCert(t *testing.T) {
+	ctx := state.WithConfigDirectory(context.Background(), t.TempDir())
+	keyPath := orgKeyPath(ctx, "personal")
+
+	_, err := loadCachedCert(ctx, "personal")
+	assert.Error(t, err)
+
+	require.NoError(t, os.MkdirAll(filepath.Dir(keyPath), 0o700))
+
+	icert, priv := testCert(t, -time.Hour, 5*time.Hour)
+	require.NoError(t, writeOrgKey(keyPath, icert, priv))
+
+	c, err := loadCachedCert(ctx, "personal")
+	require.NoError(t, err)
+	assert.True(t, c.fresh())
+	assert.Equal(t, 6, c.hours())
+	assert.Equal(t, "valid", c.status())
+
+	icert, priv = testCert(t, -time.Hour, 5*time.Minute)
+	require.NoError(t, writeOrgKey(keyPath, icert, priv))
+
+	c, err = loadCachedCert(ctx, "personal")
+	require.NoError(t, err)
+	assert.False(t, c.fresh())
+	assert.Equal(t, "expiring", c.status())
+
+	// a key that doesn't go with the certificate
+	other, _ := testCert(t, -time.Hour, 5*time.Hour)
+	require.NoError(t, writeFileAtomic(keyPath+"-cert.pub", []byte(other.Certificate)))
+
+	_, err = loadCachedCert(ctx, "personal")
+	assert.Error(t, err)
+
+	certs, errs := cachedCerts(ctx)
+	assert.Empty(t, certs)
+	assert.Len(t, errs, 1)
+}
+
+func TestCheckOrgSlug(t *testing.T) {
+	for _, slug := range []string{"personal", "acme-corp", "a.b"} {
+		assert.NoError(t, checkOrgSlug(slug), slug)
+	}
+
+	for _, slug := range []string{"", ".", "..", "../x", "a/b", `a\b`, "/etc", "x/../../y"} {
+		assert.Error(t, checkOrgSlug(slug), slug)
+	}
+}
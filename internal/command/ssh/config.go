@@ -0,0 +1,254 @@
+package ssh
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/superfly/flyctl/agent"
+	"github.com/superfly/flyctl/client"
+	"github.com/superfly/flyctl/internal/command"
+	"github.com/superfly/flyctl/internal/command/orgs"
+	"github.com/superfly/flyctl/internal/flag"
+	"github.com/superfly/flyctl/iostreams"
+)
+
+// hostSuffix ends the host names the ssh config snippet routes through
+// flyctl: <name>.<org>.fly reaches <name>.internal in the org.
+const hostSuffix = ".fly"
+
+func newConfig() *cobra.Command {
+	const (
+		long = `Write an ~/.ssh/config snippet that has ssh, scp, rsync and IDE remote
+plugins reach VMs of the organization through flyctl, with a short-lived
+certificate flyctl renews as it expires.
+
+Hosts are named after their private network name with the organization in
+place of "internal": "ssh my-app.personal.fly" reaches my-app.internal, and
+"ssh 3d8d9014b32d89.vm.my-app.personal.fly" reaches that machine.`
+		short = "Set up ssh, scp and friends to reach VMs through flyctl"
+		usage = "config [org]"
+	)
+
+	cmd := command.New(usage, short, long, runConfig, command.RequireSession)
+
+	cmd.Args = cobra.MaximumNArgs(1)
+
+	flag.Add(cmd,
+		flag.Org(),
+		flag.Int{
+			Name:        "hours",
+			Default:     24,
+			Description: "Validity of the certificate, in hours (<72)",
+		},
+		flag.String{
+			Name:        "file",
+			Description: "The ssh config file to update (default: ~/.ssh/config)",
+		},
+		flag.Bool{
+			Name:        "stdout",
+			Description: "Print the snippet rather than updating the ssh config file",
+		},
+	)
+
+	return cmd
+}
+
+func runConfig(ctx context.Context) error {
+	io := iostreams.FromContext(ctx)
+
+	hours := flag.GetInt(ctx, "hours")
+	if hours < 1 || hours > 72 {
+		return errors.New("invalid expiration time (1-72 hours)")
+	}
+
+	org, err := orgs.OrgFromFirstArgOrSelect(ctx)
+	if err != nil {
+		return err
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	cert, err := issueOrgCertificate(ctx, org, hours)
+	if err != nil {
+		return fmt.Errorf("create ssh certificate: %w", err)
+	}
+
+	block := sshConfigBlock(exe, org.Slug, cert.keyPath)
+
+	if flag.GetBool(ctx, "stdout") {
+		fmt.Fprint(io.Out, block)
+
+		return nil
+	}
+
+	path := flag.GetString(ctx, "file")
+	if path == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return err
+		}
+		path = filepath.Join(home, ".ssh", "config")
+	}
+
+	if err := updateSSHConfig(path, org.Slug, block); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(io.Out, "Updated %s. Reach VMs of %s with e.g.:\n\n  ssh <app>.%s%s\n\n", path, org.Slug, org.Slug, hostSuffix)
+
+	return nil
+}
+
+func sshConfigBlock(exe, slug, keyPath string) string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "# BEGIN flyctl %s\n", slug)
+	fmt.Fprintf(&b, "Host *.%s%s\n", slug, hostSuffix)
+	fmt.Fprintf(&b, "  ProxyCommand %q ssh bridge %%h %%p\n", exe)
+	fmt.Fprintf(&b, "  User %s\n", DefaultSshUsername)
+	fmt.Fprintf(&b, "  IdentityFile %q\n", keyPath)
+	fmt.Fprintf(&b, "  CertificateFile %q\n", keyPath+"-cert.pub")
+	b.WriteString("  IdentitiesOnly yes\n")
+	// VMs get new host keys as they're replaced
+	b.WriteString("  StrictHostKeyChecking no\n")
+	b.WriteString("  UserKnownHostsFile /dev/null\n")
+	b.WriteString("  LogLevel ERROR\n")
+	fmt.Fprintf(&b, "# END flyctl %s\n", slug)
+
+	return b.String()
+}
+
+// updateSSHConfig replaces the org's block in the ssh config file or, when
+// there's none, puts it first so that it takes precedence over catch-all
+// hosts.
+func updateSSHConfig(path, slug, block string) error {
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	begin := []byte(fmt.Sprintf("# BEGIN flyctl %s\n", slug))
+	end := []byte(fmt.Sprintf("# END flyctl %s\n", slug))
+
+	var updated []byte
+	if i := bytes.Index(data, begin); i >= 0 {
+		j := bytes.Index(data[i:], end)
+		if j < 0 {
+			return fmt.Errorf("%s has an unterminated flyctl block for %s", path, slug)
+		}
+
+		updated = append(updated, data[:i]...)
+		updated = append(updated, block...)
+		updated = append(updated, data[i+j+len(end):]...)
+	} else {
+		updated = append(updated, block...)
+		if len(data) > 0 {
+			updated = append(updated, '\n')
+			updated = append(updated, data...)
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, updated, 0o600)
+}
+
+func newBridge() *cobra.Command {
+	const (
+		long = `Connect stdin and stdout to a port of a host in the private network.
+The ssh config snippet fly ssh config writes uses this as its ProxyCommand.`
+		short = "Bridge stdio to a host in the private network"
+		usage = "bridge <host> <port>"
+	)
+
+	cmd := command.New(usage, short, long, runBridge, command.RequireSession)
+
+	cmd.Args = cobra.ExactArgs(2)
+	cmd.Hidden = true
+
+	return cmd
+}
+
+func runBridge(ctx context.Context) error {
+	args := flag.Args(ctx)
+
+	slug, host, err := bridgeTarget(args[0])
+	if err != nil {
+		return err
+	}
+
+	apiClient := client.FromContext(ctx).API()
+
+	// ssh reads the certificate after running the bridge, so it gets a fresh
+	// one
+	if c, err := loadCachedCert(ctx, slug); err != nil || !c.fresh() {
+		org, err := apiClient.GetOrganizationBySlug(ctx, slug)
+		if err != nil {
+			return err
+		}
+
+		if _, err := orgCertificate(ctx, org); err != nil {
+			return fmt.Errorf("create ssh certificate: %w", err)
+		}
+	}
+
+	agentclient, err := agent.Establish(ctx, apiClient)
+	if err != nil {
+		return fmt.Errorf("can't establish agent: %w", err)
+	}
+
+	dialer, err := agentclient.Dialer(ctx, slug)
+	if err != nil {
+		return fmt.Errorf("can't build tunnel for %s: %w", slug, err)
+	}
+
+	if err := agentclient.WaitForTunnel(ctx, slug); err != nil {
+		return fmt.Errorf("tunnel unavailable: %w", err)
+	}
+
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(host, args[1]))
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	go func() {
+		_, _ = io.Copy(conn, os.Stdin)
+
+		if cw, ok := conn.(interface{ CloseWrite() error }); ok {
+			_ = cw.CloseWrite()
+		}
+	}()
+
+	_, err = io.Copy(os.Stdout, conn)
+
+	return err
+}
+
+// bridgeTarget maps a <name>.<org>.fly host name to the org and the
+// <name>.internal host it names.
+func bridgeTarget(name string) (slug, host string, err error) {
+	rest := strings.TrimSuffix(strings.TrimSuffix(name, "."), hostSuffix)
+
+	i := strings.LastIndexByte(rest, '.')
+	if rest == name || i <= 0 || i == len(rest)-1 {
+		return "", "", fmt.Errorf("%s isn't a <name>.<org>%s host", name, hostSuffix)
+	}
+
+	return rest[i+1:], rest[:i] + ".internal", nil
+}
@@ -0,0 +1,41 @@
+package ssh
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBridgeTarget(t *testing.T) {
+	slug, host, err := bridgeTarget("3d8d9014b32d89.vm.my-app.personal.fly")
+	require.NoError(t, err)
+	assert.Equal(t, "personal", slug)
+	assert.Equal(t, "3d8d9014b32d89.vm.my-app.internal", host)
+
+	for _, name := range []string{"my-app.internal", "personal.fly", ".personal.fly"} {
+		_, _, err := bridgeTarget(name)
+		assert.Error(t, err, name)
+	}
+}
+
+func TestUpdateSSHConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config")
+	require.NoError(t, os.WriteFile(path, []byte("Host *\n  User me\n"), 0o600))
+
+	require.NoError(t, updateSSHConfig(path, "personal", sshConfigBlock("/bin/flyctl", "personal", "/keys/a")))
+	require.NoError(t, updateSSHConfig(path, "personal", sshConfigBlock("/bin/flyctl", "personal", "/keys/b")))
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+
+	config := string(data)
+	assert.Equal(t, 1, strings.Count(config, "# BEGIN flyctl personal"))
+	assert.Contains(t, config, `IdentityFile "/keys/b"`)
+	assert.NotContains(t, config, "/keys/a")
+	assert.True(t, strings.HasSuffix(config, "Host *\n  User me\n"))
+	assert.Less(t, strings.Index(config, "Host *.personal.fly"), strings.Index(config, "Host *\n"))
+}
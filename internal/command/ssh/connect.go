@@ -61,13 +61,11 @@ type ConnectParams struct {
 func Connect(p *ConnectParams, addr string) (*ssh.Client, error) {
 	terminal.Debugf("Fetching certificate for %s\n", addr)
 
-	cert, pk, err := singleUseSSHCertificate(p.Ctx, p.Org)
+	cert, err := orgCertificate(p.Ctx, p.Org)
 	if err != nil {
 		return nil, fmt.Errorf("create ssh certificate: %w (if you haven't created a key for your org yet, try `flyctl ssh issue`)", err)
 	}
 
-	pemkey := ssh.MarshalED25519PrivateKey(pk, "single-use certificate")
-
 	terminal.Debugf("Keys for %s configured; connecting...\n", addr)
 
 	sshClient := &ssh.Client{
@@ -76,8 +74,8 @@ func Connect(p *ConnectParams, addr string) (*ssh.Client, error) {
 
 		Dial: p.Dialer.DialContext,
 
-		Certificate: cert.Certificate,
-		PrivateKey:  string(pemkey),
+		Certificate: cert.text,
+		PrivateKey:  string(cert.keyPEM),
 	}
 
 	var endSpin context.CancelFunc
@@ -100,9 +98,10 @@ func Connect(p *ConnectParams, addr string) (*ssh.Client, error) {
 	return sshClient, nil
 }
 
-func singleUseSSHCertificate(ctx context.Context, org api.OrganizationImpl) (*api.IssuedCertificate, ed25519.PrivateKey, error) {
+// issueSSHCertificate issues a certificate for a new key that's valid for the
+// given hours.
+func issueSSHCertificate(ctx context.Context, org api.OrganizationImpl, hours int) (*api.IssuedCertificate, ed25519.PrivateKey, error) {
 	client := client.FromContext(ctx).API()
-	hours := 1
 
 	pub, priv, err := ed25519.GenerateKey(nil)
 	if err != nil {
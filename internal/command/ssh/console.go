@@ -21,6 +21,7 @@ import (
 	"github.com/superfly/flyctl/internal/appconfig"
 	"github.com/superfly/flyctl/internal/command"
 	"github.com/superfly/flyctl/internal/flag"
+	"github.com/superfly/flyctl/internal/machine"
 	"github.com/superfly/flyctl/internal/sentry"
 	"github.com/superfly/flyctl/iostreams"
 	"github.com/superfly/flyctl/ip"
@@ -70,6 +71,7 @@ func stdArgsSSH(cmd *cobra.Command) {
 			Description: "Unix username to connect as",
 			Default:     DefaultSshUsername,
 		},
+		machine.SelectFlags,
 	)
 }
 
@@ -101,8 +103,13 @@ func lookupAddress(ctx context.Context, cli *agent.Client, dialer agent.Dialer,
 
 func newConsole() *cobra.Command {
 	const (
-		long  = `Connect to a running instance of the current app.`
-		short = long
+		short = `Connect to a running instance of the current app.`
+		long  = short + `
+
+flyctl authenticates with a certificate of the app's organization that's
+valid for 24 hours and cached on disk; see "fly ssh certs". Set
+FLY_SSH_SINGLE_USE_CERTS=1 to use a certificate valid for an hour, kept in
+memory only, for every connection instead.`
 		usage = "console"
 	)
 
@@ -111,6 +118,13 @@ func newConsole() *cobra.Command {
 	cmd.Args = cobra.MaximumNArgs(1)
 
 	stdArgsSSH(cmd)
+	forwardFlags(cmd)
+	flag.Add(cmd,
+		flag.String{
+			Name:        "record",
+			Description: "Record the session to the asciicast file, or to a new file in the directory. ssh_recordings in the config file sets directories per organization to record to by default",
+		},
+	)
 
 	return cmd
 }
@@ -181,7 +195,20 @@ func runConsole(ctx context.Context) error {
 		return err
 	}
 
-	if err := Console(ctx, sshc, cmd, allocPTY); err != nil {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	if err := startForwards(ctx, sshc.Client); err != nil {
+		return err
+	}
+
+	rec, closeRecording, err := startRecording(ctx, app, fmt.Sprintf("%s@%s (%s)", params.Username, app.Name, addr))
+	if err != nil {
+		return err
+	}
+	defer closeRecording()
+
+	if err := console(ctx, sshc, cmd, allocPTY, rec); err != nil {
 		captureError(err, app)
 		return err
 	}
@@ -190,12 +217,17 @@ func runConsole(ctx context.Context) error {
 }
 
 func Console(ctx context.Context, sshClient *ssh.Client, cmd string, allocPTY bool) error {
+	return console(ctx, sshClient, cmd, allocPTY, nil)
+}
+
+func console(ctx context.Context, sshClient *ssh.Client, cmd string, allocPTY bool, rec *ssh.Recorder) error {
 	sessIO := &ssh.SessionIO{
 		Stdin:    os.Stdin,
 		Stdout:   ioutils.NewWriteCloserWrapper(colorable.NewColorableStdout(), func() error { return nil }),
 		Stderr:   ioutils.NewWriteCloserWrapper(colorable.NewColorableStderr(), func() error { return nil }),
 		AllocPTY: allocPTY,
 		TermEnv:  determineTermEnv(),
+		Recorder: rec,
 	}
 
 	currentStdin, currentStdout, currentStderr, err := setupConsole()
@@ -233,9 +265,19 @@ func addrForMachines(ctx context.Context, app *api.AppCompact, console bool) (ad
 		return "", fmt.Errorf("app %s has no started VMs", app.Name)
 	}
 
+	selector, err := machine.SelectorFromFlags(ctx)
 	if err != nil {
 		return "", err
 	}
+	if selector != nil {
+		machines = lo.Filter(machines, func(m *api.Machine, _ int) bool {
+			return selector.Matches(m)
+		})
+
+		if len(machines) < 1 {
+			return "", fmt.Errorf("app %s has no started VMs matching %s", app.Name, selector)
+		}
+	}
 
 	var namesWithRegion []string
 	var selectedMachine *api.Machine
@@ -302,6 +344,12 @@ func addrForMachines(ctx context.Context, app *api.AppCompact, console bool) (ad
 		}
 	}
 
+	if selectedMachine == nil && selector != nil {
+		// as with console and proxy, a selection must come down to one VM
+		if selectedMachine, err = selector.One(machines); err != nil {
+			return "", err
+		}
+	}
 	if selectedMachine == nil {
 		selectedMachine = machines[0]
 	}
@@ -311,6 +359,12 @@ func addrForMachines(ctx context.Context, app *api.AppCompact, console bool) (ad
 }
 
 func addrForNomad(ctx context.Context, agentclient *agent.Client, app *api.AppCompact, console bool) (addr string, err error) {
+	if selector, err := machine.SelectorFromFlags(ctx); err != nil {
+		return "", err
+	} else if selector != nil {
+		return "", errSelectNomad
+	}
+
 	if flag.GetBool(ctx, "select") {
 
 		instances, err := agentclient.Instances(ctx, app.Organization.Slug, app.Name)
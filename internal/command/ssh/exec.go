@@ -0,0 +1,332 @@
+package ssh
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+	xssh "golang.org/x/crypto/ssh"
+	"golang.org/x/sync/errgroup"
+
+	"github.com/superfly/flyctl/agent"
+	"github.com/superfly/flyctl/api"
+	"github.com/superfly/flyctl/client"
+	"github.com/superfly/flyctl/internal/appconfig"
+	"github.com/superfly/flyctl/internal/command"
+	"github.com/superfly/flyctl/internal/flag"
+	"github.com/superfly/flyctl/internal/machine"
+	"github.com/superfly/flyctl/internal/render"
+	"github.com/superfly/flyctl/iostreams"
+)
+
+// exitConnectFailed is the exit status of VMs the command couldn't run on,
+// like ssh's.
+const exitConnectFailed = 255
+
+func newExec() *cobra.Command {
+	const (
+		long = `Run a command on VMs of the current app. With --all, the command runs on
+every started VM, or those in --region or those --machine, --process-group
+and --select-meta select, with at most
+--concurrency running at once. Output is prefixed with the VM it came from,
+and flyctl exits with the highest exit status of the command.
+
+Arguments are quoted so that the command runs with them as given; put flags
+meant for the command after --, e.g. fly ssh exec --all -- sh -c 'echo $HOSTNAME'.`
+		short = "Run a command on one or more VMs"
+		usage = "exec <command> [args...]"
+	)
+
+	cmd := command.New(usage, short, long, runExec, command.RequireSession, command.LoadAppNameIfPresent)
+
+	cmd.Args = cobra.MinimumNArgs(1)
+	cmd.Flags().SetInterspersed(false)
+
+	flag.Add(cmd,
+		flag.Org(),
+		flag.App(),
+		flag.AppConfig(),
+		flag.Bool{
+			Name:        "all",
+			Description: "Run the command on every started VM",
+		},
+		flag.String{
+			Name:        "region",
+			Shorthand:   "r",
+			Description: "Run the command on the VMs in the region",
+		},
+		flag.Int{
+			Name:        "concurrency",
+			Description: "How many VMs to run the command on at once",
+			Default:     8,
+		},
+		flag.Bool{
+			Name:        "quiet",
+			Shorthand:   "q",
+			Description: "Don't print progress indicators for WireGuard",
+		},
+		flag.String{
+			Name:        "user",
+			Shorthand:   "u",
+			Description: "Unix username to run the command as",
+			Default:     DefaultSshUsername,
+		},
+		machine.SelectFlags,
+	)
+
+	return cmd
+}
+
+// execResult is the outcome of running the command on a VM.
+type execResult struct {
+	target   target
+	status   int
+	err      error
+	duration time.Duration
+}
+
+type execExitError struct {
+	failed, total, status int
+}
+
+func (e *execExitError) Error() string {
+	return fmt.Sprintf("command failed on %d of %d VMs", e.failed, e.total)
+}
+
+func (e *execExitError) ExitCode() int {
+	return e.status
+}
+
+func runExec(ctx context.Context) error {
+	io := iostreams.FromContext(ctx)
+	client := client.FromContext(ctx).API()
+	appName := appconfig.NameFromContext(ctx)
+
+	app, err := client.GetAppCompact(ctx, appName)
+	if err != nil {
+		return fmt.Errorf("get app: %w", err)
+	}
+
+	agentclient, dialer, err := BringUpAgent(ctx, client, app, quiet(ctx))
+	if err != nil {
+		return err
+	}
+
+	selector, err := machine.SelectorFromFlags(ctx)
+	if err != nil {
+		return err
+	}
+
+	targets, err := selectTargets(ctx, agentclient, dialer, app, targetFilter{
+		all:      flag.GetBool(ctx, "all"),
+		region:   flag.GetString(ctx, "region"),
+		selector: selector,
+	})
+	if err != nil {
+		return err
+	}
+
+	cmdline := shellJoin(flag.Args(ctx))
+
+	var (
+		mu      sync.Mutex
+		results = make([]execResult, len(targets))
+		eg      errgroup.Group
+	)
+
+	concurrency := flag.GetInt(ctx, "concurrency")
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	eg.SetLimit(concurrency)
+
+	for i, t := range targets {
+		i, t := i, t
+
+		eg.Go(func() error {
+			prefix := ""
+			if len(targets) > 1 {
+				prefix = fmt.Sprintf("[%s] ", t.label)
+			}
+
+			stdout := &prefixWriter{mu: &mu, w: io.Out, prefix: prefix}
+			stderr := &prefixWriter{mu: &mu, w: io.ErrOut, prefix: prefix}
+
+			start := time.Now()
+			status, err := execOn(ctx, app, dialer, t.addr, cmdline, stdout, stderr)
+			stdout.Flush()
+			stderr.Flush()
+
+			results[i] = execResult{target: t, status: status, err: err, duration: time.Since(start)}
+
+			return nil
+		})
+	}
+	_ = eg.Wait()
+
+	rows, failed, status := summarizeExec(results)
+
+	if len(targets) > 1 {
+		fmt.Fprintln(io.Out)
+		if err := render.Table(io.Out, "", rows, "VM", "Result", "Duration"); err != nil {
+			return err
+		}
+	} else if failed > 0 && results[0].err != nil {
+		return results[0].err
+	}
+
+	if failed > 0 {
+		return &execExitError{failed: failed, total: len(targets), status: status}
+	}
+
+	return nil
+}
+
+// summarizeExec returns the rows of the summary table of the results, how
+// many VMs the command failed on and the highest exit status it exited with.
+// VMs the command couldn't run on count as exiting with exitConnectFailed.
+func summarizeExec(results []execResult) (rows [][]string, failed, status int) {
+	rows = make([][]string, 0, len(results))
+
+	for _, r := range results {
+		outcome := "ok"
+
+		switch {
+		case r.err != nil:
+			outcome = fmt.Sprintf("error: %v", r.err)
+			r.status = exitConnectFailed
+		case r.status != 0:
+			outcome = "exit " + strconv.Itoa(r.status)
+		}
+
+		if r.status != 0 {
+			failed++
+		}
+		if r.status > status {
+			status = r.status
+		}
+
+		rows = append(rows, []string{r.target.label, outcome, r.duration.Round(time.Millisecond).String()})
+	}
+
+	return rows, failed, status
+}
+
+// shellJoin joins args into a command line the remote shell splits back into
+// the same args.
+func shellJoin(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = shellQuote(arg)
+	}
+
+	return strings.Join(quoted, " ")
+}
+
+// shellSafe are the characters that need no quoting in a POSIX shell.
+const shellSafe = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789@%+=:,./_-"
+
+// shellQuote quotes s for a POSIX shell, unless it needs no quoting.
+func shellQuote(s string) string {
+	if s != "" && strings.Trim(s, shellSafe) == "" {
+		return s
+	}
+
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// execOn runs the command on the VM at addr and returns its exit status.
+func execOn(ctx context.Context, app *api.AppCompact, dialer agent.Dialer, addr, command string, stdout, stderr io.Writer) (int, error) {
+	params := &ConnectParams{
+		Ctx:            ctx,
+		Org:            app.Organization,
+		Dialer:         dialer,
+		Username:       flag.GetString(ctx, "user"),
+		DisableSpinner: true,
+	}
+
+	sshc, err := Connect(params, addr)
+	if err != nil {
+		captureError(err, app)
+		return 0, err
+	}
+	defer sshc.Close()
+
+	sess, err := sshc.Client.NewSession()
+	if err != nil {
+		return 0, err
+	}
+	defer sess.Close()
+
+	sess.Stdout = stdout
+	sess.Stderr = stderr
+
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = sshc.Close()
+		case <-done:
+		}
+	}()
+
+	err = sess.Run(command)
+
+	var exitErr *xssh.ExitError
+	switch {
+	case errors.As(err, &exitErr):
+		return exitErr.ExitStatus(), nil
+	case err != nil && ctx.Err() != nil:
+		return 0, ctx.Err()
+	default:
+		return 0, err
+	}
+}
+
+// prefixWriter writes whole lines, prefixed, to w. Writers sharing mu don't
+// interleave their lines.
+type prefixWriter struct {
+	mu     *sync.Mutex
+	w      io.Writer
+	prefix string
+	buf    bytes.Buffer
+}
+
+func (p *prefixWriter) Write(b []byte) (int, error) {
+	p.buf.Write(b)
+
+	for {
+		i := bytes.IndexByte(p.buf.Bytes(), '\n')
+		if i < 0 {
+			break
+		}
+
+		p.writeLine(p.buf.Next(i + 1))
+	}
+
+	return len(b), nil
+}
+
+// Flush writes what's left of an unterminated last line.
+func (p *prefixWriter) Flush() {
+	if p.buf.Len() > 0 {
+		p.writeLine(append(p.buf.Bytes(), '\n'))
+		p.buf.Reset()
+	}
+}
+
+func (p *prefixWriter) writeLine(line []byte) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	fmt.Fprintf(p.w, "%s%s", p.prefix, line)
+}
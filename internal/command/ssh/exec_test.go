@@ -0,0 +1,88 @@
+package ssh
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/shlex"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/superfly/flyctl/internal/flyerr"
+)
+
+func TestShellJoin(t *testing.T) {
+	assert.Equal(t, "ls -la /app", shellJoin([]string{"ls", "-la", "/app"}))
+	assert.Equal(t, `sh -c 'echo a; rm -rf /tmp/x/*'`, shellJoin([]string{"sh", "-c", "echo a; rm -rf /tmp/x/*"}))
+	assert.Equal(t, `echo ''`, shellJoin([]string{"echo", ""}))
+
+	for _, args := range [][]string{
+		{"sh", "-c", "echo a; rm -rf /tmp/x/*"},
+		{"echo", "it's", `"quoted"`, "$HOME", "`id`", "a\nb"},
+		{"printf", "%s\\n", "", " "},
+	} {
+		split, err := shlex.Split(shellJoin(args))
+		require.NoError(t, err)
+		assert.Equal(t, args, split)
+	}
+}
+
+func TestPrefixWriter(t *testing.T) {
+	var (
+		mu  sync.Mutex
+		out bytes.Buffer
+		a   = &prefixWriter{mu: &mu, w: &out, prefix: "[a] "}
+		b   = &prefixWriter{mu: &mu, w: &out, prefix: "[b] "}
+	)
+
+	fmt.Fprint(a, "one")
+	fmt.Fprint(b, "two\nthr")
+	fmt.Fprint(a, " two\nthree\n")
+	fmt.Fprint(b, "ee")
+
+	assert.Equal(t, "[b] two\n[a] one two\n[a] three\n", out.String())
+
+	a.Flush()
+	b.Flush()
+	assert.Equal(t, "[b] two\n[a] one two\n[a] three\n[b] three\n", out.String())
+}
+
+func TestSummarizeExec(t *testing.T) {
+	results := []execResult{
+		{target: target{label: "vm1"}, duration: 1500 * time.Microsecond},
+		{target: target{label: "vm2"}, status: 2},
+		{target: target{label: "vm3"}, err: errors.New("tunnel down")},
+		{target: target{label: "vm4"}, status: 1},
+	}
+
+	rows, failed, status := summarizeExec(results)
+	assert.Equal(t, [][]string{
+		{"vm1", "ok", "2ms"},
+		{"vm2", "exit 2", "0s"},
+		{"vm3", "error: tunnel down", "0s"},
+		{"vm4", "exit 1", "0s"},
+	}, rows)
+	assert.Equal(t, 3, failed)
+	assert.Equal(t, exitConnectFailed, status)
+
+	_, failed, status = summarizeExec(results[:2])
+	assert.Equal(t, 1, failed)
+	assert.Equal(t, 2, status)
+
+	_, failed, status = summarizeExec(results[:1])
+	assert.Zero(t, failed)
+	assert.Zero(t, status)
+}
+
+func TestExecExitError(t *testing.T) {
+	err := fmt.Errorf("exec: %w", &execExitError{failed: 2, total: 5, status: 3})
+
+	code, ok := flyerr.GetErrorExitCode(err)
+	assert.True(t, ok)
+	assert.Equal(t, 3, code)
+	assert.Equal(t, "exec: command failed on 2 of 5 VMs", err.Error())
+}
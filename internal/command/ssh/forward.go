@@ -0,0 +1,196 @@
+package ssh
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/spf13/cobra"
+	xssh "golang.org/x/crypto/ssh"
+
+	"github.com/superfly/flyctl/internal/flag"
+	"github.com/superfly/flyctl/iostreams"
+	"github.com/superfly/flyctl/terminal"
+)
+
+func forwardFlags(cmd *cobra.Command) {
+	flag.Add(cmd,
+		flag.StringSlice{
+			Name:        "local-forward",
+			Shorthand:   "L",
+			Description: "Forward a local port to the VM, as [bind_address:]port:host:hostport; may be repeated",
+		},
+		flag.StringSlice{
+			Name:        "remote-forward",
+			Shorthand:   "R",
+			Description: "Forward a port on the VM to this machine, as [bind_address:]port:host:hostport; may be repeated",
+		},
+	)
+}
+
+// forward is a port forward like ssh's -L and -R take: connections to bind,
+// on one end of the SSH connection, are forwarded to target, on the other.
+type forward struct {
+	bind   string
+	target string
+}
+
+func (f forward) String() string {
+	return f.bind + " -> " + f.target
+}
+
+// parseForward parses a [bind_address:]port:host:hostport forward
+// specification. IPv6 addresses go in square brackets.
+func parseForward(spec string) (forward, error) {
+	fields, err := splitForward(spec)
+	if err != nil {
+		return forward{}, err
+	}
+
+	bind := "localhost"
+	switch len(fields) {
+	case 3:
+	case 4:
+		bind, fields = fields[0], fields[1:]
+	default:
+		return forward{}, fmt.Errorf("invalid forward %q: want [bind_address:]port:host:hostport", spec)
+	}
+
+	for _, port := range []string{fields[0], fields[2]} {
+		if n, err := strconv.ParseUint(port, 10, 16); err != nil || n == 0 {
+			return forward{}, fmt.Errorf("invalid forward %q: bad port %q", spec, port)
+		}
+	}
+
+	return forward{
+		bind:   net.JoinHostPort(bind, fields[0]),
+		target: net.JoinHostPort(fields[1], fields[2]),
+	}, nil
+}
+
+// splitForward splits spec at the colons outside of square brackets.
+func splitForward(spec string) ([]string, error) {
+	var (
+		fields []string
+		field  strings.Builder
+		inside bool
+	)
+
+	for _, r := range spec {
+		switch {
+		case r == '[' && !inside:
+			inside = true
+		case r == ']' && inside:
+			inside = false
+		case r == ':' && !inside:
+			fields = append(fields, field.String())
+			field.Reset()
+		default:
+			field.WriteRune(r)
+		}
+	}
+
+	if inside {
+		return nil, fmt.Errorf("invalid forward %q: unterminated [", spec)
+	}
+
+	return append(fields, field.String()), nil
+}
+
+// startForwards starts the forwards the --local-forward and --remote-forward
+// flags specify. They're served until ctx is done.
+func startForwards(ctx context.Context, client *xssh.Client) error {
+	errOut := iostreams.FromContext(ctx).ErrOut
+
+	for _, spec := range flag.GetStringSlice(ctx, "local-forward") {
+		f, err := parseForward(spec)
+		if err != nil {
+			return err
+		}
+
+		var lc net.ListenConfig
+		l, err := lc.Listen(ctx, "tcp", f.bind)
+		if err != nil {
+			return fmt.Errorf("forward %s: %w", f, err)
+		}
+
+		fmt.Fprintf(errOut, "Forwarding local %s\n", f)
+		go serveForward(ctx, l, f, client.Dial)
+	}
+
+	for _, spec := range flag.GetStringSlice(ctx, "remote-forward") {
+		f, err := parseForward(spec)
+		if err != nil {
+			return err
+		}
+
+		l, err := client.Listen("tcp", f.bind)
+		if err != nil {
+			return fmt.Errorf("forward %s: %w", f, err)
+		}
+
+		fmt.Fprintf(errOut, "Forwarding remote %s\n", f)
+		go serveForward(ctx, l, f, net.Dial)
+	}
+
+	return nil
+}
+
+// serveForward pipes the connections l accepts to the forward's target, which
+// dial connects to, until ctx is done.
+func serveForward(ctx context.Context, l net.Listener, f forward, dial func(network, addr string) (net.Conn, error)) {
+	go func() {
+		<-ctx.Done()
+		_ = l.Close()
+	}()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if ctx.Err() == nil {
+				terminal.Debugf("forward %s: %v\n", f, err)
+			}
+
+			return
+		}
+
+		go func() {
+			defer conn.Close()
+
+			target, err := dial("tcp", f.target)
+			if err != nil {
+				terminal.Debugf("forward %s: %v\n", f, err)
+
+				return
+			}
+			defer target.Close()
+
+			pipe(conn, target)
+		}()
+	}
+}
+
+// pipe copies between a and b until both directions are done.
+func pipe(a, b io.ReadWriter) {
+	var wg sync.WaitGroup
+	wg.Add(2)
+
+	copyHalf := func(dst, src io.ReadWriter) {
+		defer wg.Done()
+
+		_, _ = io.Copy(dst, src)
+
+		if cw, ok := dst.(interface{ CloseWrite() error }); ok {
+			_ = cw.CloseWrite()
+		}
+	}
+
+	go copyHalf(a, b)
+	go copyHalf(b, a)
+
+	wg.Wait()
+}
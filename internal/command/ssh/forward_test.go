@@ -0,0 +1,31 @@
+package ssh
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseForward(t *testing.T) {
+	cases := []struct {
+		spec         string
+		bind, target string
+	}{
+		{"5432:localhost:5432", "localhost:5432", "localhost:5432"},
+		{"0.0.0.0:8080:app.internal:80", "0.0.0.0:8080", "app.internal:80"},
+		{"[::1]:8080:[fdaa::3]:80", "[::1]:8080", "[fdaa::3]:80"},
+	}
+
+	for _, c := range cases {
+		f, err := parseForward(c.spec)
+		require.NoError(t, err, c.spec)
+		assert.Equal(t, c.bind, f.bind, c.spec)
+		assert.Equal(t, c.target, f.target, c.spec)
+	}
+
+	for _, spec := range []string{"5432", "5432:localhost", "x:localhost:5432", "5432:localhost:0", "[::1:8080:h:80"} {
+		_, err := parseForward(spec)
+		assert.Error(t, err, spec)
+	}
+}
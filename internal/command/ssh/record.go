@@ -0,0 +1,113 @@
+package ssh
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/superfly/flyctl/api"
+	"github.com/superfly/flyctl/flyctl"
+	"github.com/superfly/flyctl/internal/command"
+	"github.com/superfly/flyctl/internal/flag"
+	"github.com/superfly/flyctl/iostreams"
+	"github.com/superfly/flyctl/ssh"
+)
+
+// startRecording starts recording the session when --record is set or the
+// config file has the organization's sessions recorded. The returned func
+// finishes the recording.
+func startRecording(ctx context.Context, app *api.AppCompact, title string) (*ssh.Recorder, func(), error) {
+	io := iostreams.FromContext(ctx)
+
+	path := flag.GetString(ctx, "record")
+	if path == "" {
+		dir := viper.GetStringMapString(flyctl.ConfigSSHRecordings)[app.Organization.Slug]
+		if dir == "" {
+			return nil, func() {}, nil
+		}
+
+		if err := os.MkdirAll(dir, 0o700); err != nil {
+			return nil, nil, fmt.Errorf("failed creating recordings directory: %w", err)
+		}
+		path = dir
+	}
+
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		path = filepath.Join(path, fmt.Sprintf("%s-%s.cast", app.Name, time.Now().UTC().Format("20060102T150405Z")))
+	}
+
+	// recordings aren't overwritten, since they may be all there is to tell
+	// what happened
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed creating recording: %w", err)
+	}
+
+	fmt.Fprintf(io.ErrOut, "Recording session to %s\n", path)
+
+	rec := ssh.NewRecorder(f, title)
+
+	return rec, func() {
+		err := rec.Close()
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+
+		if err != nil {
+			fmt.Fprintf(io.ErrOut, "failed recording session to %s: %v\n", path, err)
+		}
+	}, nil
+}
+
+func newReplay() *cobra.Command {
+	const (
+		long = `Play back a session recorded with fly ssh console --record, or any
+other asciicast v2 recording, in the terminal.`
+		short = "Play back a recorded SSH session"
+		usage = "replay <file>"
+	)
+
+	cmd := command.New(usage, short, long, runReplay)
+
+	cmd.Args = cobra.ExactArgs(1)
+
+	flag.Add(cmd,
+		flag.String{
+			Name:        "speed",
+			Description: "Play back at this multiple of the recorded speed",
+			Default:     "1",
+		},
+		flag.Duration{
+			Name:        "idle-limit",
+			Description: "Cap pauses between output at this duration",
+		},
+	)
+
+	return cmd
+}
+
+func runReplay(ctx context.Context) error {
+	io := iostreams.FromContext(ctx)
+
+	speed, err := strconv.ParseFloat(flag.GetString(ctx, "speed"), 64)
+	if err != nil || speed <= 0 {
+		return fmt.Errorf("invalid speed %q", flag.GetString(ctx, "speed"))
+	}
+
+	f, err := os.Open(flag.FirstArg(ctx))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return ssh.Replay(ctx, f, io.Out, ssh.ReplayOptions{
+		Speed:     speed,
+		IdleLimit: flag.GetDuration(ctx, "idle-limit"),
+	})
+}
@@ -3,6 +3,7 @@ package ssh
 import (
 	"archive/zip"
 	"context"
+	"errors"
 	goflag "flag"
 	"fmt"
 	"io"
@@ -12,13 +13,18 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 
+	"github.com/dustin/go-humanize"
 	"github.com/pkg/sftp"
 	"github.com/spf13/cobra"
+	"github.com/superfly/flyctl/agent"
+	"github.com/superfly/flyctl/api"
 	"github.com/superfly/flyctl/client"
 	"github.com/superfly/flyctl/internal/appconfig"
 	"github.com/superfly/flyctl/internal/command"
 	"github.com/superfly/flyctl/internal/flag"
+	"github.com/superfly/flyctl/iostreams"
 
 	"github.com/chzyer/readline"
 	"github.com/google/shlex"
@@ -37,6 +43,7 @@ func NewSFTP() *cobra.Command {
 		newFind(),
 		newSFTPShell(),
 		newGet(),
+		newPut(),
 	)
 
 	return cmd
@@ -72,9 +79,9 @@ func newFind() *cobra.Command {
 
 func newGet() *cobra.Command {
 	const (
-		long  = `The SFTP GET retrieves a file from a remote VM.`
-		short = long
-		usage = "get <path>"
+		short = `The SFTP GET retrieves a file, or with --recursive a directory, from a remote VM.`
+		long  = short + "\n\n" + recursiveNote
+		usage = "get <path> [local-path]"
 	)
 
 	cmd := command.New(usage, short, long, runGet, command.RequireSession, command.LoadAppNameIfPresent)
@@ -82,10 +89,70 @@ func newGet() *cobra.Command {
 	cmd.Args = cobra.MaximumNArgs(2)
 
 	stdArgsSSH(cmd)
+	transferFlags(cmd)
 
 	return cmd
 }
 
+func newPut() *cobra.Command {
+	const (
+		short = `The SFTP PUT uploads a file, or with --recursive a directory, to a remote VM.`
+		long  = short + "\n\n" + recursiveNote
+		usage = "put <local-path> [path]"
+	)
+
+	cmd := command.New(usage, short, long, runPut, command.RequireSession, command.LoadAppNameIfPresent)
+
+	cmd.Args = cobra.RangeArgs(1, 2)
+
+	stdArgsSSH(cmd)
+	transferFlags(cmd)
+	flag.Add(cmd,
+		flag.String{
+			Name:        "mode",
+			Shorthand:   "m",
+			Default:     "0644",
+			Description: "File mode of the uploaded file; uploaded directories keep the modes of their files",
+		},
+	)
+
+	return cmd
+}
+
+// recursiveNote explains why get and put recurse with -R rather than -r, as the
+// sftp shell's do: -r is short for --region in every ssh command.
+const recursiveNote = "Directories are transferred with -R or --recursive; -r is short for --region."
+
+func transferFlags(cmd *cobra.Command) {
+	flag.Add(cmd,
+		flag.Bool{
+			Name:        "recursive",
+			Shorthand:   "R",
+			Description: "Transfer directories recursively",
+		},
+		flag.Bool{
+			Name:        "resume",
+			Description: "Resume partial transfers of files that exist at the destination",
+		},
+	)
+}
+
+// newTransfer returns a transfer drawing progress bars when stderr is a
+// terminal.
+func newTransfer(ctx context.Context, ftp *sftp.Client, out func(string, ...interface{}), resume bool) *transfer {
+	t := &transfer{
+		ftp:    ftp,
+		out:    out,
+		resume: resume,
+	}
+
+	if io := iostreams.FromContext(ctx); io.IsStderrTTY() {
+		t.progress = io.ErrOut
+	}
+
+	return t
+}
+
 func newSFTPConnection(ctx context.Context) (*sftp.Client, error) {
 	client := client.FromContext(ctx).API()
 	appName := appconfig.NameFromContext(ctx)
@@ -105,6 +172,11 @@ func newSFTPConnection(ctx context.Context) (*sftp.Client, error) {
 		return nil, err
 	}
 
+	return connectSFTP(ctx, app, dialer, addr)
+}
+
+// connectSFTP opens an SFTP session on the VM at addr.
+func connectSFTP(ctx context.Context, app *api.AppCompact, dialer agent.Dialer, addr string) (*sftp.Client, error) {
 	params := &ConnectParams{
 		Ctx:            ctx,
 		Org:            app.Organization,
@@ -168,34 +240,68 @@ func runGet(ctx context.Context) error {
 		local = args[1]
 	}
 
-	if _, err := os.Stat(local); err == nil {
-		return fmt.Errorf("file %s is already there. `fly ssh` doesn't override existing files for safety.", local)
-	}
-
 	ftp, err := newSFTPConnection(ctx)
 	if err != nil {
 		return err
 	}
 
-	rf, err := ftp.Open(remote)
+	info, err := ftp.Stat(remote)
 	if err != nil {
 		return fmt.Errorf("get: remote file %s: %w", remote, err)
 	}
-	defer rf.Close()
 
-	f, err := os.OpenFile(local, os.O_CREATE|os.O_WRONLY|os.O_EXCL, 0644)
+	if info.IsDir() && !flag.GetBool(ctx, "recursive") {
+		return fmt.Errorf("get: %s is a directory; pass --recursive to get it", remote)
+	}
+
+	t := newTransfer(ctx, ftp, func(format string, args ...interface{}) {
+		fmt.Printf(format+"\n", args...)
+	}, flag.GetBool(ctx, "resume"))
+
+	if err := t.get(remote, local, info); err != nil {
+		return fmt.Errorf("get %s -> %s: %w", remote, local, err)
+	}
+
+	return nil
+}
+
+func runPut(ctx context.Context) error {
+	args := flag.Args(ctx)
+
+	local := args[0]
+	remote := path.Base(filepath.ToSlash(local))
+	if len(args) > 1 {
+		remote = args[1]
+	}
+
+	mode, err := strconv.ParseInt(flag.GetString(ctx, "mode"), 8, 16)
 	if err != nil {
-		return fmt.Errorf("get: local file %s: %w", local, err)
+		return fmt.Errorf("put: invalid mode (only numeric allowed) '%s': %w", flag.GetString(ctx, "mode"), err)
 	}
-	defer f.Close()
 
-	bytes, err := rf.WriteTo(f)
+	info, err := os.Stat(local)
 	if err != nil {
-		return fmt.Errorf("get: copy file: %w (%d bytes written)", err, bytes)
+		return fmt.Errorf("put: local file %s: %w", local, err)
+	}
+
+	if info.IsDir() && !flag.GetBool(ctx, "recursive") {
+		return fmt.Errorf("put: %s is a directory; pass --recursive to put it", local)
 	}
 
-	fmt.Printf("%d bytes written to %s\n", bytes, local)
-	return f.Sync()
+	ftp, err := newSFTPConnection(ctx)
+	if err != nil {
+		return err
+	}
+
+	t := newTransfer(ctx, ftp, func(format string, args ...interface{}) {
+		fmt.Printf(format+"\n", args...)
+	}, flag.GetBool(ctx, "resume"))
+
+	if err := t.put(local, remote, fs.FileMode(mode)); err != nil {
+		return fmt.Errorf("put %s -> %s: %w", local, remote, err)
+	}
+
+	return nil
 }
 
 var completer = readline.NewPrefixCompleter(
@@ -204,14 +310,65 @@ var completer = readline.NewPrefixCompleter(
 	readline.PcItem("get"),
 	readline.PcItem("put"),
 	readline.PcItem("chmod"),
+	readline.PcItem("rm"),
+	readline.PcItem("mkdir"),
+	readline.PcItem("rmdir"),
+	readline.PcItem("mv"),
+	readline.PcItem("stat"),
+	readline.PcItem("df"),
 )
 
 type sftpContext struct {
+	ctx context.Context
 	ftp *sftp.Client
 	wd  string
 	out func(string, ...interface{})
 }
 
+// remotePath resolves p relative to the working directory.
+func (sc *sftpContext) remotePath(p string) string {
+	if strings.HasPrefix(p, "/") {
+		return p
+	}
+
+	return sc.wd + p
+}
+
+// glob resolves the pattern relative to the working directory and expands
+// it. Paths without wildcards are returned as they are, whether they exist or
+// not.
+func (sc *sftpContext) glob(pattern string) ([]string, error) {
+	pattern = sc.remotePath(pattern)
+	if !hasMeta(pattern) {
+		return []string{pattern}, nil
+	}
+
+	matches, err := sc.ftp.Glob(pattern)
+	if err == nil && len(matches) == 0 {
+		err = errors.New("no matches")
+	}
+
+	return matches, err
+}
+
+// globLocal expands the local pattern like glob does remote ones.
+func globLocal(pattern string) ([]string, error) {
+	if !hasMeta(pattern) {
+		return []string{pattern}, nil
+	}
+
+	matches, err := filepath.Glob(pattern)
+	if err == nil && len(matches) == 0 {
+		err = errors.New("no matches")
+	}
+
+	return matches, err
+}
+
+func hasMeta(p string) bool {
+	return strings.ContainsAny(p, "*?[")
+}
+
 func (sc *sftpContext) cd(args ...string) error {
 	if len(args) < 2 {
 		sc.wd = "/"
@@ -294,15 +451,12 @@ func (sc *sftpContext) ls(args ...string) error {
 	return nil
 }
 
-func (sc *sftpContext) getDir(rpath string, args []string) {
-	lpath := path.Base(rpath) + ".zip"
-
-	if len(args) > 2 {
-		lpath = args[2]
-
-		if !strings.HasSuffix(lpath, ".zip") {
-			lpath += ".zip"
-		}
+func (sc *sftpContext) getDir(rpath, lpath string) {
+	if lpath == "" {
+		lpath = path.Base(rpath)
+	}
+	if !strings.HasSuffix(lpath, ".zip") {
+		lpath += ".zip"
 	}
 
 	if _, err := os.Stat(lpath); err == nil {
@@ -397,9 +551,18 @@ func (sc *sftpContext) chmod(args ...string) error {
 }
 
 func (sc *sftpContext) put(args ...string) error {
+	const usage = "put [-r] [-a] [-m mode] <local-filename> [filename]"
+
 	fgs := goflag.NewFlagSet("put", goflag.ContinueOnError)
 
 	perm := fgs.String("m", "0644", "file mode")
+	recursive := fgs.Bool("r", false, "put directories recursively")
+	resume := fgs.Bool("a", false, "resume partial transfers")
+
+	if err := fgs.Parse(args[1:]); err != nil || fgs.Arg(0) == "" {
+		sc.out(usage)
+		return nil
+	}
 
 	permbits, err := strconv.ParseInt(*perm, 8, 16)
 	if err != nil {
@@ -407,120 +570,313 @@ func (sc *sftpContext) put(args ...string) error {
 		return nil
 	}
 
-	if err := fgs.Parse(args[1:]); err != nil {
-		sc.out("put [-m] <local-filename> [filename]")
+	matches, err := globLocal(fgs.Arg(0))
+	if err != nil {
+		sc.out("put %s: %s", fgs.Arg(0), err)
 		return nil
 	}
 
-	lpath := fgs.Arg(0)
-	if lpath == "" {
-		sc.out("put [-m] <local-filename> [filename]")
-		return nil
-	}
+	t := newTransfer(sc.ctx, sc.ftp, sc.out, *resume)
 
-	rpath := sc.wd + path.Base(lpath)
-	if rarg := fgs.Arg(1); rarg != "" {
-		if rarg[0] == '/' {
-			rpath = rarg
-		} else {
-			rpath = sc.wd + rarg
+	for _, lpath := range matches {
+		rpath := sc.wd + filepath.Base(lpath)
+		if rarg := fgs.Arg(1); rarg != "" {
+			rpath = sc.remotePath(rarg)
+
+			// put into the directory, if there's one
+			if inf, err := sc.ftp.Stat(rpath); err == nil && inf.IsDir() {
+				rpath = path.Join(rpath, filepath.Base(lpath))
+			}
+		}
+
+		inf, err := os.Stat(lpath)
+		if err != nil {
+			sc.out("put %s: %s", lpath, err)
+			continue
+		}
+
+		if inf.IsDir() && !*recursive {
+			sc.out("put %s: is a directory; use put -r", lpath)
+			continue
+		}
+
+		if err := t.put(lpath, rpath, fs.FileMode(permbits)); err != nil {
+			sc.out("put %s -> %s: %s", lpath, rpath, err)
 		}
 	}
 
-	if _, err = sc.ftp.Stat(rpath); err == nil {
-		sc.out("put %s -> %s: file exists on VM", lpath, rpath)
+	return nil
+}
+
+func (sc *sftpContext) get(args ...string) error {
+	const usage = "get [-r] [-a] <filename> [local-filename]"
+
+	fgs := goflag.NewFlagSet("get", goflag.ContinueOnError)
+
+	recursive := fgs.Bool("r", false, "get directories recursively")
+	resume := fgs.Bool("a", false, "resume partial transfers")
+
+	if err := fgs.Parse(args[1:]); err != nil || fgs.Arg(0) == "" {
+		sc.out(usage)
 		return nil
 	}
 
-	f, err := os.Open(lpath)
+	matches, err := sc.glob(fgs.Arg(0))
 	if err != nil {
-		sc.out("put %s -> %s: open local file: %s", lpath, rpath, err)
+		sc.out("get %s: %s", fgs.Arg(0), err)
 		return nil
 	}
-	// Safe to ignore the error because this file is for reading.
-	defer f.Close() // skipcq: GO-S2307
 
-	rf, err := sc.ftp.OpenFile(rpath, os.O_WRONLY|os.O_CREATE|os.O_EXCL)
-	if err != nil {
-		sc.out("put %s -> %s: create remote file: %s", lpath, rpath, err)
-		return nil
+	t := newTransfer(sc.ctx, sc.ftp, sc.out, *resume)
+
+	for _, rpath := range matches {
+		inf, err := sc.ftp.Stat(rpath)
+		if err != nil {
+			sc.out("get %s: %s", rpath, err)
+			continue
+		}
+
+		if inf.IsDir() && !*recursive {
+			sc.getDir(rpath, fgs.Arg(1))
+			continue
+		}
+
+		lpath := path.Base(rpath)
+		if larg := fgs.Arg(1); larg != "" {
+			lpath = larg
+
+			// get into the directory, if there's one
+			if linf, err := os.Stat(larg); err == nil && linf.IsDir() {
+				lpath = filepath.Join(larg, path.Base(rpath))
+			}
+		}
+
+		if err := t.get(rpath, lpath, inf); err != nil {
+			sc.out("get %s -> %s: %s", rpath, lpath, err)
+		}
 	}
-	defer rf.Close()
 
-	bytes, err := rf.ReadFrom(f)
-	if err != nil {
-		sc.out("put %s -> %s: copy file file: %s (%d bytes written)", lpath, rpath, err, bytes)
+	return nil
+}
+
+func (sc *sftpContext) rm(args ...string) error {
+	fgs := goflag.NewFlagSet("rm", goflag.ContinueOnError)
+
+	recursive := fgs.Bool("r", false, "remove directories and their contents")
+
+	if err := fgs.Parse(args[1:]); err != nil || fgs.NArg() == 0 {
+		sc.out("rm [-r] <filename>...")
 		return nil
 	}
 
-	sc.out("%d bytes written", bytes)
+	for _, arg := range fgs.Args() {
+		matches, err := sc.glob(arg)
+		if err != nil {
+			sc.out("rm %s: %s", arg, err)
+			continue
+		}
+
+		for _, rpath := range matches {
+			if *recursive {
+				err = sc.removeAll(rpath)
+			} else {
+				err = sc.ftp.Remove(rpath)
+			}
+
+			if err != nil {
+				sc.out("rm %s: %s", rpath, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// removeAll removes the tree at rpath, deepest entries first.
+func (sc *sftpContext) removeAll(rpath string) error {
+	var paths []string
+
+	walker := sc.ftp.Walk(rpath)
+	for walker.Step() {
+		if err := walker.Err(); err != nil {
+			return err
+		}
+
+		paths = append(paths, walker.Path())
+	}
 
-	if err = sc.ftp.Chmod(rpath, fs.FileMode(permbits)); err != nil {
-		sc.out("put %s -> %s: set permissions: %s", lpath, rpath, err)
+	for i := len(paths) - 1; i >= 0; i-- {
+		if err := sc.ftp.Remove(paths[i]); err != nil {
+			return fmt.Errorf("%s: %w", paths[i], err)
+		}
+	}
+
+	return nil
+}
+
+func (sc *sftpContext) mkdir(args ...string) error {
+	fgs := goflag.NewFlagSet("mkdir", goflag.ContinueOnError)
+
+	parents := fgs.Bool("p", false, "make parent directories as needed")
+
+	if err := fgs.Parse(args[1:]); err != nil || fgs.NArg() == 0 {
+		sc.out("mkdir [-p] <directory>...")
 		return nil
 	}
 
+	for _, arg := range fgs.Args() {
+		rpath := sc.remotePath(arg)
+
+		var err error
+		if *parents {
+			err = sc.ftp.MkdirAll(rpath)
+		} else {
+			err = sc.ftp.Mkdir(rpath)
+		}
+
+		if err != nil {
+			sc.out("mkdir %s: %s", rpath, err)
+		}
+	}
+
 	return nil
 }
 
-func (sc *sftpContext) get(args ...string) error {
+func (sc *sftpContext) rmdir(args ...string) error {
 	if len(args) < 2 {
-		sc.out("get <filename> [local-filename]")
+		sc.out("rmdir <directory>...")
 		return nil
 	}
 
-	rpath := sc.wd + args[1]
+	for _, arg := range args[1:] {
+		rpath := sc.remotePath(arg)
 
-	inf, err := sc.ftp.Stat(rpath)
-	if err != nil {
-		sc.out("get %s: %s", rpath, err)
-		return nil
+		if err := sc.ftp.RemoveDirectory(rpath); err != nil {
+			sc.out("rmdir %s: %s", rpath, err)
+		}
 	}
 
-	if inf.IsDir() {
-		sc.getDir(rpath, args)
+	return nil
+}
+
+func (sc *sftpContext) mv(args ...string) error {
+	if len(args) < 3 {
+		sc.out("mv <source>... <destination>")
 		return nil
 	}
 
-	localFile := path.Base(rpath)
-	if len(args) > 2 {
-		localFile = args[2]
+	var sources []string
+	for _, arg := range args[1 : len(args)-1] {
+		matches, err := sc.glob(arg)
+		if err != nil {
+			sc.out("mv %s: %s", arg, err)
+			return nil
+		}
+		sources = append(sources, matches...)
 	}
 
-	_, err = os.Stat(localFile)
-	if err == nil {
-		sc.out("file %s is already there. `fly ssh` doesn't overwrite existing files for safety.", localFile)
+	dst := sc.remotePath(args[len(args)-1])
+
+	inf, err := sc.ftp.Stat(dst)
+	intoDir := err == nil && inf.IsDir()
+
+	if len(sources) > 1 && !intoDir {
+		sc.out("mv: %s is not a directory", dst)
 		return nil
 	}
 
-	func() {
-		rf, err := sc.ftp.Open(rpath)
-		if err != nil {
-			sc.out("get %s -> %s: %s", err)
-			return
+	for _, src := range sources {
+		target := dst
+		if intoDir {
+			target = path.Join(dst, path.Base(src))
 		}
-		defer rf.Close()
 
-		f, err := os.OpenFile(localFile, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
-		if err != nil {
-			sc.out("get %s -> %s: %s", rpath, localFile, err)
-			return
+		if err := sc.ftp.Rename(src, target); err != nil {
+			sc.out("mv %s -> %s: %s", src, target, err)
 		}
-		defer f.Close()
+	}
+
+	return nil
+}
 
-		sc.out("get %s -> %s", rpath, localFile)
+func (sc *sftpContext) stat(args ...string) error {
+	if len(args) < 2 {
+		sc.out("stat <filename>...")
+		return nil
+	}
 
-		bytes, err := rf.WriteTo(f)
+	for _, arg := range args[1:] {
+		matches, err := sc.glob(arg)
 		if err != nil {
-			sc.out("get %s -> %s: %s (wrote %d bytes)", rpath, localFile, err, bytes)
-		} else {
-			sc.out("wrote %d bytes", bytes)
+			sc.out("stat %s: %s", arg, err)
+			continue
 		}
-		err = f.Sync()
-		if err != nil {
-			sc.out("failed to sync %s: %s", localFile, err)
+
+		for _, rpath := range matches {
+			inf, err := sc.ftp.Lstat(rpath)
+			if err != nil {
+				sc.out("stat %s: %s", rpath, err)
+				continue
+			}
+
+			sc.out("  File: %s", rpath)
+			sc.out("  Size: %d\tType: %s", inf.Size(), fileType(inf.Mode()))
+			sc.out("  Mode: %s (%04o)", inf.Mode(), inf.Mode().Perm())
+
+			if st, ok := inf.Sys().(*sftp.FileStat); ok {
+				sc.out("   Uid: %d\tGid: %d", st.UID, st.GID)
+				sc.out("Access: %s", time.Unix(int64(st.Atime), 0))
+			}
+
+			sc.out("Modify: %s", inf.ModTime())
 		}
-	}()
+	}
+
+	return nil
+}
+
+func fileType(mode fs.FileMode) string {
+	switch {
+	case mode.IsDir():
+		return "directory"
+	case mode&fs.ModeSymlink != 0:
+		return "symbolic link"
+	case mode.IsRegular():
+		return "regular file"
+	default:
+		return "special file"
+	}
+}
+
+func (sc *sftpContext) df(args ...string) error {
+	rpath := sc.wd
+	if len(args) > 1 {
+		rpath = sc.remotePath(args[len(args)-1])
+	}
+
+	if _, ok := sc.ftp.HasExtension("statvfs@openssh.com"); !ok {
+		sc.out("df: not supported by the SFTP server")
+		return nil
+	}
+
+	vfs, err := sc.ftp.StatVFS(rpath)
+	if err != nil {
+		sc.out("df %s: %s", rpath, err)
+		return nil
+	}
+
+	size := vfs.Blocks * vfs.Frsize
+	free := vfs.Bfree * vfs.Frsize
+	avail := vfs.Bavail * vfs.Frsize
+
+	var capacity uint64
+	if used := size - free; used+avail > 0 {
+		capacity = 100 * used / (used + avail)
+	}
+
+	sc.out("%10s %10s %10s %8s %10s %10s", "Size", "Used", "Avail", "Capacity", "Inodes", "IFree")
+	sc.out("%10s %10s %10s %7d%% %10d %10d",
+		humanize.IBytes(size), humanize.IBytes(size-free), humanize.IBytes(avail), capacity, vfs.Files, vfs.Ffree)
 
 	return nil
 }
@@ -552,6 +908,7 @@ func runShell(ctx context.Context) error {
 	}
 
 	sc := &sftpContext{
+		ctx: ctx,
 		wd:  "/",
 		out: out,
 		ftp: ftp,
@@ -605,8 +962,38 @@ func runShell(ctx context.Context) error {
 				return err
 			}
 
+		case "rm":
+			if err = sc.rm(args...); err != nil {
+				return err
+			}
+
+		case "mkdir":
+			if err = sc.mkdir(args...); err != nil {
+				return err
+			}
+
+		case "rmdir":
+			if err = sc.rmdir(args...); err != nil {
+				return err
+			}
+
+		case "mv":
+			if err = sc.mv(args...); err != nil {
+				return err
+			}
+
+		case "stat":
+			if err = sc.stat(args...); err != nil {
+				return err
+			}
+
+		case "df":
+			if err = sc.df(args...); err != nil {
+				return err
+			}
+
 		default:
-			out("unrecognized command; try 'cd', 'ls', 'get', 'put', or 'chmod'")
+			out("unrecognized command; try 'cd', 'ls', 'get', 'put', 'chmod', 'rm', 'mkdir', 'rmdir', 'mv', 'stat' or 'df'")
 		}
 	}
 
@@ -0,0 +1,338 @@
+package ssh
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/pkg/sftp"
+)
+
+// transfer copies files and directory trees between the local machine and a
+// VM.
+type transfer struct {
+	ftp *sftp.Client
+	out func(string, ...interface{})
+
+	// progress is where progress bars are drawn. No progress bars are drawn
+	// when it's nil.
+	progress io.Writer
+
+	// resume has transfers of files that exist at the destination continue
+	// where they stopped, instead of failing.
+	resume bool
+}
+
+var errExists = errors.New("file is already there. `fly ssh` doesn't overwrite existing files for safety")
+
+// get copies the remote file or, when info is a directory, the remote tree at
+// rpath to lpath.
+func (t *transfer) get(rpath, lpath string, info fs.FileInfo) error {
+	if !info.IsDir() {
+		return t.getFile(rpath, lpath, info.Size())
+	}
+
+	var failed int
+
+	walker := t.ftp.Walk(rpath)
+	for walker.Step() {
+		if err := walker.Err(); err != nil {
+			return err
+		}
+
+		rel := strings.TrimPrefix(strings.TrimPrefix(walker.Path(), rpath), "/")
+		target := filepath.Join(lpath, filepath.FromSlash(rel))
+
+		switch stat := walker.Stat(); {
+		case stat.IsDir():
+			if err := os.MkdirAll(target, 0o755); err != nil {
+				return err
+			}
+		case !stat.Mode().IsRegular():
+			t.out("skipping %s: not a regular file", walker.Path())
+		default:
+			if err := t.getFile(walker.Path(), target, stat.Size()); err != nil {
+				t.out("get %s -> %s: %s", walker.Path(), target, err)
+				failed++
+			}
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d files failed to transfer", failed)
+	}
+
+	return nil
+}
+
+func (t *transfer) getFile(rpath, lpath string, size int64) error {
+	flags := os.O_WRONLY | os.O_CREATE | os.O_EXCL
+
+	var offset int64
+	if info, err := os.Stat(lpath); err == nil {
+		if offset, err = t.resumeAt(info.Size(), size); err != nil {
+			return err
+		}
+		if offset == size {
+			t.out("%s is already complete", lpath)
+
+			return nil
+		}
+		flags = os.O_WRONLY | os.O_APPEND
+	}
+
+	rf, err := t.ftp.Open(rpath)
+	if err != nil {
+		return err
+	}
+	defer rf.Close()
+
+	if _, err := rf.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(lpath, flags, 0o644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var w io.Writer = f
+	bar := t.bar(rpath, size, offset)
+	if bar != nil {
+		w = io.MultiWriter(f, bar)
+	}
+
+	n, err := rf.WriteTo(w)
+	bar.finish()
+	if err != nil {
+		return fmt.Errorf("%w (wrote %d bytes)", err, n)
+	}
+
+	if bar == nil {
+		t.out("%s -> %s (%d bytes)", rpath, lpath, n)
+	}
+
+	return f.Sync()
+}
+
+// put copies the local file or, when it's a directory, the local tree at lpath
+// to rpath. Files of trees keep their local permissions; single files get
+// mode.
+func (t *transfer) put(lpath, rpath string, mode fs.FileMode) error {
+	info, err := os.Stat(lpath)
+	if err != nil {
+		return err
+	}
+
+	if !info.IsDir() {
+		return t.putFile(lpath, rpath, info.Size(), mode)
+	}
+
+	var failed int
+
+	err = filepath.WalkDir(lpath, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(lpath, p)
+		if err != nil {
+			return err
+		}
+		target := path.Join(rpath, filepath.ToSlash(rel))
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case d.IsDir():
+			return t.ftp.MkdirAll(target)
+		case !info.Mode().IsRegular():
+			t.out("skipping %s: not a regular file", p)
+		default:
+			if err := t.putFile(p, target, info.Size(), info.Mode().Perm()); err != nil {
+				t.out("put %s -> %s: %s", p, target, err)
+				failed++
+			}
+		}
+
+		return nil
+	})
+
+	if err == nil && failed > 0 {
+		err = fmt.Errorf("%d files failed to transfer", failed)
+	}
+
+	return err
+}
+
+func (t *transfer) putFile(lpath, rpath string, size int64, mode fs.FileMode) error {
+	flags := os.O_WRONLY | os.O_CREATE | os.O_EXCL
+
+	var offset int64
+	if info, err := t.ftp.Stat(rpath); err == nil {
+		if offset, err = t.resumeAt(info.Size(), size); err != nil {
+			return err
+		}
+		if offset == size {
+			t.out("%s is already complete", rpath)
+
+			return nil
+		}
+		flags = os.O_WRONLY
+	}
+
+	f, err := os.Open(lpath)
+	if err != nil {
+		return err
+	}
+	// Safe to ignore the error because this file is for reading.
+	defer f.Close() // skipcq: GO-S2307
+
+	rf, err := t.ftp.OpenFile(rpath, flags)
+	if err != nil {
+		return err
+	}
+	defer rf.Close()
+
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+	if _, err := rf.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+
+	r := &sizedReader{Reader: f, size: size - offset}
+	bar := t.bar(lpath, size, offset)
+	if bar != nil {
+		r.Reader = io.TeeReader(f, bar)
+	}
+
+	n, err := rf.ReadFrom(r)
+	bar.finish()
+	if err != nil {
+		return fmt.Errorf("%w (wrote %d bytes)", err, n)
+	}
+
+	if bar == nil {
+		t.out("%s -> %s (%d bytes)", lpath, rpath, n)
+	}
+
+	if offset == 0 {
+		if err := t.ftp.Chmod(rpath, mode); err != nil {
+			return fmt.Errorf("set permissions: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// resumeAt returns the offset to resume the transfer of a file of size bytes
+// at, given the size of what's at the destination already.
+func (t *transfer) resumeAt(existing, size int64) (int64, error) {
+	switch {
+	case !t.resume:
+		return 0, errExists
+	case existing > size:
+		return 0, errors.New("destination is larger than the source; can't resume")
+	}
+
+	return existing, nil
+}
+
+func (t *transfer) bar(name string, size, offset int64) *progressBar {
+	if t.progress == nil {
+		return nil
+	}
+
+	return &progressBar{
+		w:       t.progress,
+		name:    path.Base(filepath.ToSlash(name)),
+		size:    size,
+		done:    offset,
+		resumed: offset,
+		start:   time.Now(),
+	}
+}
+
+// sizedReader tells the SFTP client how much it's going to read, so that it
+// writes concurrently.
+type sizedReader struct {
+	io.Reader
+	size int64
+}
+
+func (r *sizedReader) Size() int64 {
+	return r.size
+}
+
+// progressBar draws the progress of a transfer, with its throughput, as the
+// bytes are written to it.
+type progressBar struct {
+	w       io.Writer
+	name    string
+	size    int64
+	done    int64
+	resumed int64
+	start   time.Time
+	drawn   time.Time
+}
+
+func (p *progressBar) Write(b []byte) (int, error) {
+	p.done += int64(len(b))
+
+	if time.Since(p.drawn) >= 200*time.Millisecond {
+		p.draw()
+	}
+
+	return len(b), nil
+}
+
+func (p *progressBar) draw() {
+	p.drawn = time.Now()
+
+	const width = 20
+
+	ratio := 1.0
+	if p.size > 0 {
+		ratio = float64(p.done) / float64(p.size)
+	}
+	if ratio > 1 {
+		ratio = 1
+	}
+	filled := int(ratio * width)
+
+	var rate float64
+	if elapsed := time.Since(p.start).Seconds(); elapsed > 0 {
+		rate = float64(p.done-p.resumed) / elapsed
+	}
+
+	name := p.name
+	if len(name) > 24 {
+		name = name[:21] + "..."
+	}
+
+	fmt.Fprintf(p.w, "\r%-24s %3.0f%% [%s%s] %8s / %-8s %10s/s",
+		name, ratio*100, strings.Repeat("=", filled), strings.Repeat(" ", width-filled),
+		humanize.Bytes(uint64(p.done)), humanize.Bytes(uint64(p.size)), humanize.Bytes(uint64(rate)))
+}
+
+// finish draws the final state of the bar. It's safe to call on a nil bar.
+func (p *progressBar) finish() {
+	if p == nil {
+		return
+	}
+
+	p.draw()
+	fmt.Fprintln(p.w)
+}
@@ -0,0 +1,102 @@
+package ssh
+
+import (
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/sftp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestSFTP(t *testing.T) *sftp.Client {
+	t.Helper()
+
+	serverConn, clientConn := net.Pipe()
+
+	server := sftp.NewRequestServer(serverConn, sftp.InMemHandler())
+	go func() { _ = server.Serve() }()
+	t.Cleanup(func() { _ = server.Close() })
+
+	client, err := sftp.NewClientPipe(clientConn, clientConn)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = client.Close() })
+
+	return client
+}
+
+func TestTransferRecursive(t *testing.T) {
+	ftp := newTestSFTP(t)
+	tr := &transfer{ftp: ftp, out: t.Logf}
+
+	src := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(src, "a", "b"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(src, "top.txt"), []byte("top"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(src, "a", "b", "deep.txt"), []byte("deep"), 0o644))
+
+	require.NoError(t, tr.put(src, "/tree", 0o644))
+
+	info, err := ftp.Stat("/tree")
+	require.NoError(t, err)
+
+	dst := filepath.Join(t.TempDir(), "tree")
+	require.NoError(t, tr.get("/tree", dst, info))
+
+	data, err := os.ReadFile(filepath.Join(dst, "a", "b", "deep.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, "deep", string(data))
+
+	data, err = os.ReadFile(filepath.Join(dst, "top.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, "top", string(data))
+}
+
+func TestTransferResume(t *testing.T) {
+	ftp := newTestSFTP(t)
+
+	content := []byte("0123456789abcdefghij")
+
+	rf, err := ftp.Create("/big")
+	require.NoError(t, err)
+	_, err = rf.Write(content)
+	require.NoError(t, err)
+	require.NoError(t, rf.Close())
+
+	info, err := ftp.Stat("/big")
+	require.NoError(t, err)
+
+	// a partial download
+	local := filepath.Join(t.TempDir(), "big")
+	require.NoError(t, os.WriteFile(local, content[:7], 0o644))
+
+	tr := &transfer{ftp: ftp, out: t.Logf}
+	assert.ErrorIs(t, tr.get("/big", local, info), errExists)
+
+	tr.resume = true
+	require.NoError(t, tr.get("/big", local, info))
+
+	data, err := os.ReadFile(local)
+	require.NoError(t, err)
+	assert.Equal(t, content, data)
+
+	// a partial upload, drawing progress
+	rf, err = ftp.Create("/up")
+	require.NoError(t, err)
+	_, err = rf.Write(content[:12])
+	require.NoError(t, err)
+	require.NoError(t, rf.Close())
+
+	tr.progress = io.Discard
+	require.NoError(t, tr.put(local, "/up", 0o644))
+
+	rf, err = ftp.Open("/up")
+	require.NoError(t, err)
+	defer rf.Close()
+
+	data, err = io.ReadAll(rf)
+	require.NoError(t, err)
+	assert.Equal(t, content, data)
+}
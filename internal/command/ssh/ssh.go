@@ -19,6 +19,12 @@ func New() *cobra.Command {
 		newIssue(),
 		newLog(),
 		NewSFTP(),
+		newSync(),
+		newExec(),
+		newConfig(),
+		newBridge(),
+		newReplay(),
+		newCerts(),
 	)
 
 	return cmd
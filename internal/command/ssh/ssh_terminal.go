@@ -65,13 +65,11 @@ func RunSSHCommand(ctx context.Context, app *api.AppCompact, dialer agent.Dialer
 func SSHConnect(p *SSHParams, addr string) error {
 	terminal.Debugf("Fetching certificate for %s\n", addr)
 
-	cert, pk, err := singleUseSSHCertificate(p.Ctx, p.Org)
+	cert, err := orgCertificate(p.Ctx, p.Org)
 	if err != nil {
 		return fmt.Errorf("create ssh certificate: %w (if you haven't created a key for your org yet, try `flyctl ssh issue`)", err)
 	}
 
-	pemkey := ssh.MarshalED25519PrivateKey(pk, "single-use certificate")
-
 	terminal.Debugf("Keys for %s configured; connecting...\n", addr)
 
 	sshClient := &ssh.Client{
@@ -80,8 +78,8 @@ func SSHConnect(p *SSHParams, addr string) error {
 
 		Dial: p.Dialer.DialContext,
 
-		Certificate: cert.Certificate,
-		PrivateKey:  string(pemkey),
+		Certificate: cert.text,
+		PrivateKey:  string(cert.keyPEM),
 	}
 
 	var endSpin context.CancelFunc
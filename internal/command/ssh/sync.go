@@ -0,0 +1,439 @@
+package ssh
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/dustin/go-humanize"
+	"github.com/pkg/sftp"
+	"github.com/spf13/cobra"
+
+	"github.com/superfly/flyctl/client"
+	"github.com/superfly/flyctl/internal/appconfig"
+	"github.com/superfly/flyctl/internal/command"
+	"github.com/superfly/flyctl/internal/flag"
+	"github.com/superfly/flyctl/iostreams"
+)
+
+func newSync() *cobra.Command {
+	const (
+		long = `Sync a local directory to a directory on a VM, transferring only the
+files that changed. Files are compared by size and modification time, or by
+checksum with --checksum, and replaced atomically.
+
+Exclude patterns match either the base name or the path relative to the
+directory, e.g. --exclude node_modules --exclude '*.log'.`
+		short = "Sync a local directory to a VM"
+		usage = "sync <local-dir> <remote-dir>"
+	)
+
+	cmd := command.New(usage, short, long, runSync, command.RequireSession, command.LoadAppNameIfPresent)
+
+	cmd.Args = cobra.ExactArgs(2)
+
+	stdArgsSSH(cmd)
+	flag.Add(cmd,
+		flag.Bool{
+			Name:        "delete",
+			Description: "Delete remote files that don't exist locally",
+		},
+		flag.StringSlice{
+			Name:        "exclude",
+			Description: "Exclude files matching the pattern; may be repeated",
+		},
+		flag.Bool{
+			Name:        "checksum",
+			Description: "Compare files by checksum rather than by size and modification time",
+		},
+		flag.Bool{
+			Name:        "dry-run",
+			Shorthand:   "n",
+			Description: "Print what would change without changing anything",
+		},
+	)
+
+	return cmd
+}
+
+func runSync(ctx context.Context) error {
+	io := iostreams.FromContext(ctx)
+	client := client.FromContext(ctx).API()
+	appName := appconfig.NameFromContext(ctx)
+
+	args := flag.Args(ctx)
+	local, remote := args[0], args[1]
+
+	if info, err := os.Stat(local); err != nil {
+		return err
+	} else if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", local)
+	}
+
+	app, err := client.GetAppCompact(ctx, appName)
+	if err != nil {
+		return fmt.Errorf("get app: %w", err)
+	}
+
+	agentclient, dialer, err := BringUpAgent(ctx, client, app, quiet(ctx))
+	if err != nil {
+		return err
+	}
+
+	targets, err := lookupTargets(ctx, agentclient, dialer, app)
+	if err != nil {
+		return err
+	}
+
+	var failed int
+	for _, t := range targets {
+		if len(targets) > 1 {
+			fmt.Fprintf(io.Out, "==> %s\n", t.label)
+		}
+
+		ftp, err := connectSFTP(ctx, app, dialer, t.addr)
+		if err != nil {
+			fmt.Fprintf(io.ErrOut, "failed connecting to %s: %v\n", t.label, err)
+			failed++
+
+			continue
+		}
+
+		s := &syncer{
+			ftp: ftp,
+			out: func(format string, args ...interface{}) {
+				fmt.Fprintf(io.Out, format+"\n", args...)
+			},
+			excludes: flag.GetStringSlice(ctx, "exclude"),
+			checksum: flag.GetBool(ctx, "checksum"),
+			delete:   flag.GetBool(ctx, "delete"),
+			dryRun:   flag.GetBool(ctx, "dry-run"),
+		}
+
+		err = s.sync(local, remote)
+		ftp.Close()
+
+		if err != nil {
+			fmt.Fprintf(io.ErrOut, "failed syncing %s: %v\n", t.label, err)
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("failed syncing %d of %d VMs", failed, len(targets))
+	}
+
+	return nil
+}
+
+// syncer makes a remote directory a copy of a local one.
+type syncer struct {
+	ftp *sftp.Client
+	out func(string, ...interface{})
+
+	excludes []string
+	checksum bool
+	delete   bool
+	dryRun   bool
+}
+
+type syncStats struct {
+	transferred, deleted, unchanged int
+	bytes                           int64
+}
+
+// sync syncs the remote directory to the local one.
+func (s *syncer) sync(local, remote string) error {
+	locals, err := s.walkLocal(local)
+	if err != nil {
+		return err
+	}
+
+	remotes, err := s.walkRemote(remote)
+	if err != nil {
+		return err
+	}
+
+	// the remote directory may not exist yet, and files at its top level
+	// can't be sent to it until it does
+	if !s.dryRun {
+		if err := s.ftp.MkdirAll(remote); err != nil {
+			return err
+		}
+	}
+
+	var stats syncStats
+
+	// locals are sorted, so that directories come before their contents
+	for _, rel := range sortedKeys(locals) {
+		info := locals[rel]
+		rpath := path.Join(remote, rel)
+
+		if info.IsDir() {
+			if r, ok := remotes[rel]; ok && r.IsDir() {
+				continue
+			}
+
+			s.out("mkdir %s", rpath)
+			if !s.dryRun {
+				if err := s.ftp.MkdirAll(rpath); err != nil {
+					return err
+				}
+			}
+
+			continue
+		}
+
+		lpath := filepath.Join(local, filepath.FromSlash(rel))
+
+		changed, err := s.changed(lpath, rpath, info, remotes[rel])
+		if err != nil {
+			return err
+		}
+		if !changed {
+			stats.unchanged++
+
+			continue
+		}
+
+		s.out("send %s (%s)", rel, humanize.Bytes(uint64(info.Size())))
+		if !s.dryRun {
+			if err := s.upload(lpath, rpath, info); err != nil {
+				return fmt.Errorf("send %s: %w", rel, err)
+			}
+		}
+		stats.transferred++
+		stats.bytes += info.Size()
+	}
+
+	if s.delete {
+		// deepest first, so that directories are empty by the time they go
+		rels := sortedKeys(remotes)
+		for i := len(rels) - 1; i >= 0; i-- {
+			rel := rels[i]
+			if _, ok := locals[rel]; ok {
+				continue
+			}
+
+			rpath := path.Join(remote, rel)
+
+			s.out("delete %s", rpath)
+			if !s.dryRun {
+				if err := s.ftp.Remove(rpath); err != nil {
+					return fmt.Errorf("delete %s: %w", rpath, err)
+				}
+			}
+			stats.deleted++
+		}
+	}
+
+	s.out("%d files sent (%s), %d deleted, %d unchanged",
+		stats.transferred, humanize.Bytes(uint64(stats.bytes)), stats.deleted, stats.unchanged)
+
+	return nil
+}
+
+func (s *syncer) excluded(rel string) bool {
+	base := path.Base(rel)
+
+	for _, pattern := range s.excludes {
+		pattern = strings.TrimSuffix(pattern, "/")
+
+		if ok, _ := path.Match(pattern, base); ok {
+			return true
+		}
+		if ok, _ := path.Match(pattern, rel); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// walkLocal returns the entries of the local tree by their slash-separated
+// path relative to its root.
+func (s *syncer) walkLocal(root string) (map[string]fs.FileInfo, error) {
+	entries := map[string]fs.FileInfo{}
+
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(root, p)
+		if err != nil || rel == "." {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+
+		if s.excluded(rel) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		if info.IsDir() || info.Mode().IsRegular() {
+			entries[rel] = info
+		}
+
+		return nil
+	})
+
+	return entries, err
+}
+
+// walkRemote returns the entries of the remote tree like walkLocal does. The
+// tree may not exist yet.
+func (s *syncer) walkRemote(root string) (map[string]fs.FileInfo, error) {
+	entries := map[string]fs.FileInfo{}
+
+	switch info, err := s.ftp.Stat(root); {
+	case errors.Is(err, fs.ErrNotExist):
+		return entries, nil
+	case err != nil:
+		return nil, err
+	case !info.IsDir():
+		return nil, fmt.Errorf("%s is not a directory", root)
+	}
+
+	walker := s.ftp.Walk(root)
+	for walker.Step() {
+		if err := walker.Err(); err != nil {
+			return nil, err
+		}
+
+		rel := strings.TrimPrefix(strings.TrimPrefix(walker.Path(), root), "/")
+		if rel == "" {
+			continue
+		}
+
+		if s.excluded(rel) {
+			if walker.Stat().IsDir() {
+				walker.SkipDir()
+			}
+
+			continue
+		}
+
+		entries[rel] = walker.Stat()
+	}
+
+	return entries, nil
+}
+
+// changed reports whether the local file differs from the remote one.
+func (s *syncer) changed(lpath, rpath string, local, remote fs.FileInfo) (bool, error) {
+	switch {
+	case remote == nil, remote.IsDir(), remote.Size() != local.Size():
+		return true, nil
+	case !s.checksum:
+		// SFTP keeps modification times in seconds
+		return local.ModTime().Unix() != remote.ModTime().Unix(), nil
+	}
+
+	lsum, err := checksum(func() (io.ReadCloser, error) { return os.Open(lpath) })
+	if err != nil {
+		return false, err
+	}
+
+	rsum, err := checksum(func() (io.ReadCloser, error) { return s.ftp.Open(rpath) })
+	if err != nil {
+		return false, err
+	}
+
+	return !bytes.Equal(lsum, rsum), nil
+}
+
+func checksum(open func() (io.ReadCloser, error)) ([]byte, error) {
+	f, err := open()
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return nil, err
+	}
+
+	return h.Sum(nil), nil
+}
+
+// upload replaces the remote file with the local one through a temporary
+// file, so that the remote file is never seen half written, and gives it the
+// local file's mode and modification time.
+func (s *syncer) upload(lpath, rpath string, info fs.FileInfo) error {
+	tmp := path.Join(path.Dir(rpath), ".fly-sync-"+path.Base(rpath))
+	_ = s.ftp.Remove(tmp) // left over by an interrupted sync
+
+	f, err := os.Open(lpath)
+	if err != nil {
+		return err
+	}
+	// Safe to ignore the error because this file is for reading.
+	defer f.Close() // skipcq: GO-S2307
+
+	rf, err := s.ftp.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_EXCL)
+	if err != nil {
+		return err
+	}
+
+	_, err = rf.ReadFrom(&sizedReader{Reader: f, size: info.Size()})
+	if cerr := rf.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = s.ftp.Chmod(tmp, info.Mode().Perm())
+	}
+	if err == nil {
+		err = s.ftp.Chtimes(tmp, info.ModTime(), info.ModTime())
+	}
+	if err == nil {
+		err = s.rename(tmp, rpath)
+	}
+
+	if err != nil {
+		_ = s.ftp.Remove(tmp)
+	}
+
+	return err
+}
+
+// rename renames over the target, atomically when the server supports it.
+func (s *syncer) rename(from, to string) error {
+	if _, ok := s.ftp.HasExtension("posix-rename@openssh.com"); ok {
+		return s.ftp.PosixRename(from, to)
+	}
+
+	if err := s.ftp.Remove(to); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	return s.ftp.Rename(from, to)
+}
+
+func sortedKeys(m map[string]fs.FileInfo) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
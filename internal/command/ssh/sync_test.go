@@ -0,0 +1,94 @@
+package ssh
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSync(t *testing.T) {
+	ftp := newTestSFTP(t)
+
+	src := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(src, "a", "node_modules"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(src, "a", "keep.txt"), []byte("keep"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(src, "a", "node_modules", "dep.js"), []byte("dep"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(src, "debug.log"), []byte("log"), 0o644))
+
+	var sent []string
+	s := &syncer{
+		ftp: ftp,
+		out: func(format string, args ...interface{}) {
+			if format == "send %s (%s)" {
+				sent = append(sent, args[0].(string))
+			}
+		},
+		excludes: []string{"node_modules", "*.log"},
+		delete:   true,
+	}
+
+	require.NoError(t, s.sync(src, "/dst"))
+	assert.Equal(t, []string{"a/keep.txt"}, sent)
+
+	_, err := ftp.Stat("/dst/a/node_modules")
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	// a remote extra goes, unchanged files stay
+	rf, err := ftp.Create("/dst/extra")
+	require.NoError(t, err)
+	require.NoError(t, rf.Close())
+
+	sent = nil
+	require.NoError(t, s.sync(src, "/dst"))
+	assert.Empty(t, sent)
+
+	_, err = ftp.Stat("/dst/extra")
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	// a changed file is sent again
+	later := time.Now().Add(time.Hour)
+	require.NoError(t, os.WriteFile(filepath.Join(src, "a", "keep.txt"), []byte("kept"), 0o644))
+	require.NoError(t, os.Chtimes(filepath.Join(src, "a", "keep.txt"), later, later))
+
+	require.NoError(t, s.sync(src, "/dst"))
+	assert.Equal(t, []string{"a/keep.txt"}, sent)
+
+	rf, err = ftp.Open("/dst/a/keep.txt")
+	require.NoError(t, err)
+	defer rf.Close()
+
+	data, err := io.ReadAll(rf)
+	require.NoError(t, err)
+	assert.Equal(t, "kept", string(data))
+}
+
+func TestSyncCreatesRemoteDir(t *testing.T) {
+	ftp := newTestSFTP(t)
+
+	src := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(src, "index.html"), []byte("<html>"), 0o644))
+
+	s := &syncer{ftp: ftp, out: t.Logf}
+
+	// a dry run leaves the remote alone
+	s.dryRun = true
+	require.NoError(t, s.sync(src, "/app/dist"))
+	_, err := ftp.Stat("/app/dist")
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	s.dryRun = false
+	require.NoError(t, s.sync(src, "/app/dist"))
+
+	rf, err := ftp.Open("/app/dist/index.html")
+	require.NoError(t, err)
+	defer rf.Close()
+
+	data, err := io.ReadAll(rf)
+	require.NoError(t, err)
+	assert.Equal(t, "<html>", string(data))
+}
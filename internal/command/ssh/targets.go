@@ -0,0 +1,131 @@
+package ssh
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/samber/lo"
+
+	"github.com/superfly/flyctl/agent"
+	"github.com/superfly/flyctl/api"
+	"github.com/superfly/flyctl/flaps"
+	"github.com/superfly/flyctl/internal/machine"
+)
+
+var errSelectNomad = errors.New("selecting VMs by machine, process group, metadata or region is only supported for apps on machines")
+
+// target is a VM a command runs against.
+type target struct {
+	label string
+	addr  string
+}
+
+// targetFilter selects the machines of an app a command runs against.
+type targetFilter struct {
+	// all selects every started machine the other fields don't rule out.
+	all bool
+
+	region   string
+	selector *machine.Selector
+}
+
+func (f targetFilter) empty() bool {
+	return !f.all && f.region == "" && f.selector == nil
+}
+
+func (f targetFilter) matches(m *api.Machine) bool {
+	switch {
+	case m.State != api.MachineStateStarted:
+		return false
+	case f.region != "" && m.Region != f.region:
+		return false
+	case f.selector != nil && !f.selector.Matches(m):
+		return false
+	default:
+		return true
+	}
+}
+
+// lookupTargets returns the VMs machine.SelectFlags select or, when none are
+// set, the single VM lookupAddress selects.
+func lookupTargets(ctx context.Context, agentclient *agent.Client, dialer agent.Dialer, app *api.AppCompact) ([]target, error) {
+	selector, err := machine.SelectorFromFlags(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return selectTargets(ctx, agentclient, dialer, app, targetFilter{selector: selector})
+}
+
+// selectTargets returns the VMs the filter selects or, when it's empty, the
+// single VM lookupAddress selects.
+func selectTargets(ctx context.Context, agentclient *agent.Client, dialer agent.Dialer, app *api.AppCompact, filter targetFilter) ([]target, error) {
+	if filter.empty() {
+		addr, err := lookupAddress(ctx, agentclient, dialer, app, false)
+		if err != nil {
+			return nil, err
+		}
+
+		return []target{{label: addr, addr: addr}}, nil
+	}
+
+	if app.PlatformVersion != "machines" {
+		if filter.all && filter.region == "" && filter.selector == nil {
+			return instanceTargets(ctx, agentclient, app)
+		}
+
+		return nil, errSelectNomad
+	}
+
+	flapsClient, err := flaps.New(ctx, app)
+	if err != nil {
+		return nil, err
+	}
+
+	machines, err := flapsClient.ListActive(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	machines = lo.Filter(machines, func(m *api.Machine, _ int) bool {
+		return filter.matches(m)
+	})
+
+	if len(machines) == 0 {
+		return nil, fmt.Errorf("app %s has no started machines matching the selection", app.Name)
+	}
+
+	targets := make([]target, 0, len(machines))
+	for _, m := range machines {
+		targets = append(targets, target{
+			label: fmt.Sprintf("%s (%s)", m.ID, m.Region),
+			addr:  m.PrivateIP,
+		})
+	}
+
+	return targets, nil
+}
+
+// instanceTargets returns every instance of an app on nomad.
+func instanceTargets(ctx context.Context, agentclient *agent.Client, app *api.AppCompact) ([]target, error) {
+	instances, err := agentclient.Instances(ctx, app.Organization.Slug, app.Name)
+	if err != nil {
+		return nil, fmt.Errorf("look up %s: %w", app.Name, err)
+	}
+	if len(instances.Addresses) == 0 {
+		return nil, fmt.Errorf("no instances found for %s", app.Name)
+	}
+
+	targets := make([]target, 0, len(instances.Addresses))
+	for i, addr := range instances.Addresses {
+		label := addr
+		if i < len(instances.Labels) {
+			label = instances.Labels[i]
+		}
+
+		targets = append(targets, target{label: label, addr: addr})
+	}
+
+	return targets, nil
+}
@@ -7,12 +7,17 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"time"
 
+	"github.com/samber/lo"
 	"github.com/superfly/flyctl/api"
 	"github.com/superfly/flyctl/client"
 	"github.com/superfly/flyctl/flaps"
 	"github.com/superfly/flyctl/internal/command/postgres"
 	"github.com/superfly/flyctl/internal/config"
+	"github.com/superfly/flyctl/internal/format"
+	"github.com/superfly/flyctl/internal/logger"
+	"github.com/superfly/flyctl/internal/machine"
 	"github.com/superfly/flyctl/internal/render"
 	"github.com/superfly/flyctl/iostreams"
 	"golang.org/x/exp/slices"
@@ -192,6 +197,8 @@ func renderMachineStatus(ctx context.Context, app *api.AppCompact, out io.Writer
 		if hasStandbys {
 			fmt.Fprintf(out, "  † Standby machine (it will take over only in case of host hardware failure)\n")
 		}
+
+		renderMachineLeases(flaps.NewContext(ctx, flapsClient), managed, out)
 	}
 
 	if len(unmanaged) > 0 {
@@ -202,6 +209,37 @@ func renderMachineStatus(ctx context.Context, app *api.AppCompact, out io.Writer
 	return nil
 }
 
+// renderMachineLeases lists who holds a lease on the given machines, if anyone,
+// so that a deployment stuck waiting for a lease can be traced to its owner.
+// Leases are extra information, so failing to get them doesn't fail the status.
+func renderMachineLeases(ctx context.Context, machines []*api.Machine, out io.Writer) {
+	ids := lo.Map(machines, func(m *api.Machine, _ int) string { return m.ID })
+	leases, err := machine.FindLeases(ctx, ids)
+	if err != nil {
+		logger.FromContext(ctx).Warnf("could not get machine leases: %v", err)
+		return
+	}
+	if len(leases) == 0 {
+		return
+	}
+
+	rows := [][]string{}
+	for id, lease := range leases {
+		expiresAt := time.Unix(lease.Data.ExpiresAt, 0)
+		rows = append(rows, []string{
+			id,
+			lease.Data.Owner,
+			fmt.Sprintf("%s (%s)", format.Time(expiresAt), format.RelativeTime(expiresAt)),
+		})
+	}
+
+	sort.Slice(rows, func(i, j int) bool {
+		return rows[i][0] < rows[j][0]
+	})
+
+	_ = render.Table(out, "Leases", rows, "Machine", "Owner", "Expires")
+}
+
 func renderMachineJSONStatus(ctx context.Context, app *api.AppCompact, machines []*api.Machine) error {
 	var (
 		out    = iostreams.FromContext(ctx).Out
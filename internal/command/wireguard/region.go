@@ -0,0 +1,103 @@
+package wireguard
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/superfly/flyctl/agent"
+	"github.com/superfly/flyctl/api"
+	"github.com/superfly/flyctl/client"
+	"github.com/superfly/flyctl/internal/command"
+	"github.com/superfly/flyctl/internal/flag"
+	"github.com/superfly/flyctl/internal/prompt"
+	"github.com/superfly/flyctl/internal/wireguard"
+	"github.com/superfly/flyctl/iostreams"
+)
+
+func newWireguardUseRegion() *cobra.Command {
+	const (
+		short = "Pin the gateway region the agent connects to an organization through"
+		long  = `Pin the gateway region the agent connects to an organization's private
+network through, for latency-sensitive work far from the closest gateway.
+
+The agent switches to a WireGuard peer in the region, creating one if the
+organization has none there, and keeps the peers of other regions to fail
+over to. Pass 'auto' to go back to the closest gateway region.`
+	)
+	cmd := command.New("use-region <region> [org]", short, long, runWireguardUseRegion,
+		command.RequireSession,
+	)
+	cmd.Args = cobra.RangeArgs(1, 2)
+	return cmd
+}
+
+func runWireguardUseRegion(ctx context.Context) error {
+	io := iostreams.FromContext(ctx)
+	apiClient := client.FromContext(ctx).API()
+
+	args := flag.Args(ctx)
+
+	var (
+		org *api.Organization
+		err error
+	)
+	if len(args) > 1 {
+		org, err = apiClient.GetOrganizationBySlug(ctx, args[1])
+	} else {
+		org, err = prompt.Org(ctx)
+	}
+	if err != nil {
+		return err
+	}
+
+	region := args[0]
+	if region == "auto" {
+		region = ""
+	} else if err := validateGatewayRegion(ctx, apiClient, region); err != nil {
+		return err
+	}
+
+	if err := wireguard.PinRegion(org.Slug, region); err != nil {
+		return err
+	}
+
+	// the agent reads the pin when it starts
+	if err := killAgent(ctx); err != nil {
+		return fmt.Errorf("failed stopping the agent: %w", err)
+	}
+
+	agentclient, err := agent.Establish(ctx, apiClient)
+	if err != nil {
+		return err
+	}
+
+	res, err := agentclient.Establish(ctx, org.Slug)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(io.Out, "Connected to organization %s through WireGuard peer %s in region %s\n",
+		org.Slug, res.WireGuardState.Name, res.WireGuardState.Region)
+
+	return nil
+}
+
+func validateGatewayRegion(ctx context.Context, apiClient *api.Client, code string) error {
+	regions, err := wireguard.GatewayRegions(ctx, apiClient)
+	if err != nil {
+		return err
+	}
+
+	codes := make([]string, 0, len(regions))
+	for _, region := range regions {
+		if region.Code == code {
+			return nil
+		}
+		codes = append(codes, region.Code)
+	}
+
+	return fmt.Errorf("%s is not a WireGuard gateway region; try one of %s", code, strings.Join(codes, ", "))
+}
@@ -21,6 +21,8 @@ func New() *cobra.Command {
 		newWireguardReset(),
 		newWireguardWebsockets(),
 		newWireguardToken(),
+		newWireguardSocks(),
+		newWireguardUseRegion(),
 	)
 	return cmd
 }
@@ -0,0 +1,114 @@
+package wireguard
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+
+	"github.com/spf13/cobra"
+
+	"github.com/superfly/flyctl/agent"
+	"github.com/superfly/flyctl/client"
+	"github.com/superfly/flyctl/internal/command"
+	"github.com/superfly/flyctl/internal/flag"
+	"github.com/superfly/flyctl/iostreams"
+	"github.com/superfly/flyctl/proxy"
+)
+
+func newWireguardSocks() *cobra.Command {
+	const (
+		short = "Expose an organization's private network as a local SOCKS5 and HTTP proxy"
+		long  = `Expose an organization's private network as a local SOCKS5 and HTTP proxy,
+so that browsers, database clients and curl can reach apps over the private
+network, including by their .internal names, without installing WireGuard.
+
+The proxy serves SOCKS5 and HTTP on the same port. Have clients resolve names
+through the proxy, e.g.:
+
+  curl --proxy socks5h://127.0.0.1:1080 http://my-app.internal:8080
+  curl --proxy http://127.0.0.1:1080 http://my-app.internal:8080
+
+The proxy doesn't authenticate its clients: anyone who can reach it can reach
+the private network. It only listens on loopback addresses unless
+--allow-remote is given.`
+	)
+	cmd := command.New("socks [org]", short, long, runWireguardSocks,
+		command.RequireSession,
+	)
+	flag.Add(cmd,
+		flag.Int{
+			Name:        "port",
+			Shorthand:   "p",
+			Description: "Local port to serve the proxy on",
+			Default:     1080,
+		},
+		flag.String{
+			Name:        "bind-addr",
+			Description: "Local address to serve the proxy on",
+			Default:     "127.0.0.1",
+		},
+		flag.Bool{
+			Name:        "allow-remote",
+			Description: "Allow --bind-addr to be a non-loopback address, exposing the private network to anyone who can reach it",
+		},
+	)
+	cmd.Args = cobra.MaximumNArgs(1)
+	return cmd
+}
+
+func runWireguardSocks(ctx context.Context) error {
+	io := iostreams.FromContext(ctx)
+	apiClient := client.FromContext(ctx).API()
+
+	bindAddr := flag.GetString(ctx, "bind-addr")
+	if !isLoopback(bindAddr) {
+		if !flag.GetBool(ctx, "allow-remote") {
+			return fmt.Errorf("refusing to serve the proxy on %s, a non-loopback address; pass --allow-remote to expose the private network to anyone who can reach it", bindAddr)
+		}
+
+		fmt.Fprintf(io.ErrOut, "WARNING: the proxy doesn't authenticate its clients; anyone who can reach %s can reach the private network\n", bindAddr)
+	}
+
+	org, err := orgByArg(ctx)
+	if err != nil {
+		return err
+	}
+
+	agentclient, err := agent.Establish(ctx, apiClient)
+	if err != nil {
+		return err
+	}
+
+	dialer, err := agentclient.ConnectToTunnel(ctx, org.Slug)
+	if err != nil {
+		return err
+	}
+
+	addr := net.JoinHostPort(bindAddr, strconv.Itoa(flag.GetInt(ctx, "port")))
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(io.Out, "Serving a SOCKS5 and HTTP proxy to the private network of %s on %s\n", org.Slug, listener.Addr())
+
+	server := &proxy.SocksServer{
+		Listener: listener,
+		Dial:     dialer.DialContext,
+	}
+
+	return server.Serve(ctx)
+}
+
+// isLoopback reports whether host is localhost or a loopback IP address.
+// Other names count as remote, since they may resolve to anything.
+func isLoopback(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
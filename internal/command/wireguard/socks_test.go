@@ -0,0 +1,17 @@
+package wireguard
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsLoopback(t *testing.T) {
+	for _, host := range []string{"127.0.0.1", "127.1.2.3", "::1", "localhost"} {
+		assert.True(t, isLoopback(host), host)
+	}
+
+	for _, host := range []string{"", "0.0.0.0", "::", "192.168.1.10", "fdaa::3", "example.com"} {
+		assert.False(t, isLoopback(host), host)
+	}
+}
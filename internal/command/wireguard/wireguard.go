@@ -73,19 +73,8 @@ func runWireguardWebsockets(ctx context.Context) error {
 		return errors.Wrap(err, "error saving config file")
 	}
 
-	tryKillingAgent := func() error {
-		client, err := agent.DefaultClient(ctx)
-		if err == agent.ErrAgentNotRunning {
-			return nil
-		} else if err != nil {
-			return err
-		}
-
-		return client.Kill(ctx)
-	}
-
 	// kill the agent if necessary, if that fails print manual instructions
-	if err := tryKillingAgent(); err != nil {
+	if err := killAgent(ctx); err != nil {
 		terminal.Debugf("error stopping the agent: %s", err)
 		fmt.Fprintf(io.Out, "Run `flyctl agent restart` to make changes take effect.\n")
 	}
@@ -93,6 +82,19 @@ func runWireguardWebsockets(ctx context.Context) error {
 	return nil
 }
 
+// killAgent stops the agent, if it's running, so that the next one reads the
+// config file anew.
+func killAgent(ctx context.Context) error {
+	client, err := agent.DefaultClient(ctx)
+	if err == agent.ErrAgentNotRunning {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	return client.Kill(ctx)
+}
+
 func runWireguardReset(ctx context.Context) error {
 	io := iostreams.FromContext(ctx)
 
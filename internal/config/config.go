@@ -1,6 +1,7 @@
 package config
 
 import (
+	"fmt"
 	"strings"
 	"sync"
 
@@ -146,6 +147,37 @@ func (cfg *Config) ApplyFile(path string) (err error) {
 	return
 }
 
+// ApplyCredentials sets the access token of cfg to the one kept by the
+// credential store the configuration file at path selects, if any. A token the
+// file still keeps in plain text is moved to the store first, unless the store
+// is read-only, in which case the file's token takes precedence.
+func (cfg *Config) ApplyCredentials(path string) error {
+	store, err := OpenCredentialStore(path)
+	if err != nil || store == nil {
+		return err
+	}
+
+	if err := MigrateCredentials(path, store); err != nil {
+		return fmt.Errorf("failed migrating credentials: %w", err)
+	}
+
+	token, err := store.Get(AccessTokenFileKey)
+	if err != nil {
+		return err
+	}
+
+	cfg.mu.Lock()
+	defer cfg.mu.Unlock()
+
+	// a token left in the file after migrating is one a read-only store
+	// couldn't take
+	if token != "" && cfg.AccessToken == "" {
+		cfg.AccessToken = token
+	}
+
+	return nil
+}
+
 // ApplyFlags sets the properties of cfg which may be set via command line flags
 // to the values the flags of the given FlagSet may contain.
 func (cfg *Config) ApplyFlags(fs *pflag.FlagSet) {
@@ -0,0 +1,399 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sync"
+
+	"golang.org/x/crypto/nacl/secretbox"
+	"golang.org/x/crypto/scrypt"
+
+	"github.com/superfly/flyctl/internal/env"
+	"github.com/superfly/flyctl/internal/filemu"
+)
+
+const (
+	// CredentialsFileName denotes the name of the file the encrypted credential
+	// store keeps its credentials in, next to the configuration file.
+	CredentialsFileName = "credentials.enc"
+
+	CredentialHelperFileKey      = "credential_helper"
+	CredentialHelperStoreFileKey = "credential_helper_store"
+	CredentialsKeyFileFileKey    = "credentials_key_file"
+
+	credentialHelperEnvKey      = envKeyPrefix + "CREDENTIAL_HELPER"
+	credentialHelperStoreEnvKey = envKeyPrefix + "CREDENTIAL_HELPER_STORE"
+	credentialsKeyFileEnvKey    = envKeyPrefix + "CREDENTIALS_KEY_FILE"
+	CredentialsPassphraseEnvKey = envKeyPrefix + "CREDENTIALS_PASSPHRASE"
+)
+
+// CredentialStore keeps the secrets flyctl would otherwise write to the
+// configuration file in plain text: the access token and the WireGuard state,
+// which carries the private keys of the peers.
+type CredentialStore interface {
+	// Get returns the value of the named credential or an empty string when
+	// it isn't set.
+	Get(name string) (string, error)
+
+	// Set sets the value of the named credential. Setting it to an empty
+	// string removes it. Read-only stores fail with ErrCredentialsReadOnly.
+	Set(name, value string) error
+}
+
+// ErrCredentialsReadOnly is returned when setting a credential in a store that
+// can't keep it, like a credential helper without a store command. Callers
+// keep the credential in the configuration file instead, as they would
+// without a store.
+var ErrCredentialsReadOnly = errors.New("credential store is read-only")
+
+// OpenCredentialStore returns the credential store selected by the
+// configuration file at path or by the environment, the latter taking
+// precedence. It returns nil when credentials are kept in the configuration
+// file itself, which remains the default.
+//
+// A credential helper takes precedence over the encrypted file. The helper
+// command prints the credentials as a JSON object; the store command, when
+// set, is given the updated object on its standard input. Without a store
+// command, the helper is read-only and the credentials flyctl sets stay in the
+// configuration file:
+//
+//	credential_helper: pass show fly
+//	credential_helper_store: pass insert --multiline --force fly
+//
+// The encrypted file is sealed with a key derived from the passphrase in
+// FLY_CREDENTIALS_PASSPHRASE or from the contents of credentials_key_file.
+func OpenCredentialStore(path string) (CredentialStore, error) {
+	var w struct {
+		Helper      string `yaml:"credential_helper"`
+		HelperStore string `yaml:"credential_helper_store"`
+		KeyFile     string `yaml:"credentials_key_file"`
+	}
+
+	switch err := unmarshal(path, &w); {
+	case err == nil, errors.Is(err, fs.ErrNotExist), errors.Is(err, io.EOF):
+		break
+	default:
+		return nil, err
+	}
+
+	helper := env.FirstOrDefault(w.Helper, credentialHelperEnvKey)
+	helperStore := env.FirstOrDefault(w.HelperStore, credentialHelperStoreEnvKey)
+	keyFile := env.FirstOrDefault(w.KeyFile, credentialsKeyFileEnvKey)
+	sealed := filepath.Join(filepath.Dir(path), CredentialsFileName)
+
+	switch {
+	case helper != "":
+		return &commandStore{get: helper, store: helperStore}, nil
+	case env.IsSet(CredentialsPassphraseEnvKey):
+		return &encryptedStore{path: sealed, secret: []byte(os.Getenv(CredentialsPassphraseEnvKey))}, nil
+	case keyFile != "":
+		secret, err := os.ReadFile(keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed reading credentials key file: %w", err)
+		}
+
+		return &encryptedStore{path: sealed, secret: bytes.TrimSpace(secret)}, nil
+	default:
+		return nil, nil
+	}
+}
+
+// MigrateCredentials moves the access token the configuration file at path
+// keeps in plain text to the store. Read-only stores leave it in place.
+func MigrateCredentials(path string, store CredentialStore) error {
+	var w struct {
+		AccessToken string `yaml:"access_token"`
+	}
+
+	switch err := unmarshal(path, &w); {
+	case errors.Is(err, fs.ErrNotExist), errors.Is(err, io.EOF):
+		return nil
+	case err != nil:
+		return err
+	case w.AccessToken == "":
+		return nil
+	}
+
+	switch err := store.Set(AccessTokenFileKey, w.AccessToken); {
+	case errors.Is(err, ErrCredentialsReadOnly):
+		return nil
+	case err != nil:
+		return err
+	}
+
+	return set(path, map[string]interface{}{
+		AccessTokenFileKey: "",
+	})
+}
+
+// ErrCredentialsDecrypt is returned when the encrypted credentials can't be
+// opened with the configured passphrase or key file.
+var ErrCredentialsDecrypt = errors.New("failed decrypting credentials; check the passphrase or key file")
+
+const sealedVersion = 1
+
+type sealedCredentials struct {
+	Version int    `json:"version"`
+	Salt    []byte `json:"salt"`
+	Nonce   []byte `json:"nonce"`
+	Box     []byte `json:"box"`
+}
+
+// encryptedStore keeps the credentials in a file sealed with NaCl secretbox,
+// under a key derived from secret with scrypt.
+type encryptedStore struct {
+	path   string
+	secret []byte
+
+	mu   sync.Mutex
+	salt []byte
+	key  *[32]byte
+}
+
+func (s *encryptedStore) Get(name string) (value string, err error) {
+	var unlock filemu.UnlockFunc
+	if unlock, err = filemu.RLock(context.Background(), s.lockPath()); err != nil {
+		return
+	}
+	defer func() {
+		if e := unlock(); err == nil {
+			err = e
+		}
+	}()
+
+	var creds map[string]string
+	if creds, err = s.load(); err == nil {
+		value = creds[name]
+	}
+
+	return
+}
+
+func (s *encryptedStore) Set(name, value string) (err error) {
+	var unlock filemu.UnlockFunc
+	if unlock, err = filemu.Lock(context.Background(), s.lockPath()); err != nil {
+		return
+	}
+	defer func() {
+		if e := unlock(); err == nil {
+			err = e
+		}
+	}()
+
+	var creds map[string]string
+	if creds, err = s.load(); err != nil {
+		return
+	}
+
+	if value == "" {
+		delete(creds, name)
+	} else {
+		creds[name] = value
+	}
+
+	err = s.save(creds)
+
+	return
+}
+
+func (s *encryptedStore) lockPath() string {
+	return s.path + ".lock"
+}
+
+func (s *encryptedStore) load() (map[string]string, error) {
+	creds := map[string]string{}
+
+	data, err := os.ReadFile(s.path)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return creds, nil
+	case err != nil:
+		return nil, err
+	}
+
+	var sealed sealedCredentials
+	if err := json.Unmarshal(data, &sealed); err != nil {
+		return nil, fmt.Errorf("failed decoding %s: %w", filepath.Base(s.path), err)
+	}
+	if sealed.Version != sealedVersion || len(sealed.Nonce) != 24 {
+		return nil, fmt.Errorf("unsupported credentials file %s", filepath.Base(s.path))
+	}
+
+	key, err := s.deriveKey(sealed.Salt)
+	if err != nil {
+		return nil, err
+	}
+
+	var nonce [24]byte
+	copy(nonce[:], sealed.Nonce)
+
+	plain, ok := secretbox.Open(nil, sealed.Box, &nonce, key)
+	if !ok {
+		return nil, ErrCredentialsDecrypt
+	}
+
+	if err := json.Unmarshal(plain, &creds); err != nil {
+		return nil, fmt.Errorf("failed decoding credentials: %w", err)
+	}
+
+	return creds, nil
+}
+
+func (s *encryptedStore) save(creds map[string]string) error {
+	plain, err := json.Marshal(creds)
+	if err != nil {
+		return err
+	}
+
+	// keep the salt of the file, so that the key needn't be derived again
+	salt := s.currentSalt()
+	if salt == nil {
+		salt = make([]byte, 16)
+		if _, err := rand.Read(salt); err != nil {
+			return err
+		}
+	}
+
+	key, err := s.deriveKey(salt)
+	if err != nil {
+		return err
+	}
+
+	var nonce [24]byte
+	if _, err := rand.Read(nonce[:]); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(sealedCredentials{
+		Version: sealedVersion,
+		Salt:    salt,
+		Nonce:   nonce[:],
+		Box:     secretbox.Seal(nil, plain, &nonce, key),
+	})
+	if err != nil {
+		return err
+	}
+
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, s.path)
+}
+
+func (s *encryptedStore) currentSalt() []byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.salt
+}
+
+// deriveKey derives the key for the salt, reusing the last one derived since
+// scrypt is deliberately slow.
+func (s *encryptedStore) deriveKey(salt []byte) (*[32]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.key != nil && bytes.Equal(s.salt, salt) {
+		return s.key, nil
+	}
+
+	derived, err := scrypt.Key(s.secret, salt, 1<<15, 8, 1, 32)
+	if err != nil {
+		return nil, err
+	}
+
+	var key [32]byte
+	copy(key[:], derived)
+	s.salt, s.key = salt, &key
+
+	return s.key, nil
+}
+
+// commandStore keeps the credentials with external commands, such as a
+// password manager's.
+type commandStore struct {
+	get   string
+	store string
+}
+
+func (s *commandStore) Get(name string) (string, error) {
+	creds, err := s.load()
+	if err != nil {
+		return "", err
+	}
+
+	return creds[name], nil
+}
+
+func (s *commandStore) Set(name, value string) error {
+	if s.store == "" {
+		return ErrCredentialsReadOnly
+	}
+
+	creds, err := s.load()
+	if err != nil {
+		return err
+	}
+
+	if value == "" {
+		delete(creds, name)
+	} else {
+		creds[name] = value
+	}
+
+	data, err := json.Marshal(creds)
+	if err != nil {
+		return err
+	}
+
+	cmd := shellCommand(s.store)
+	cmd.Stdin = bytes.NewReader(data)
+	cmd.Stderr = os.Stderr
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("credential helper %q failed: %w", s.store, err)
+	}
+
+	return nil
+}
+
+func (s *commandStore) load() (map[string]string, error) {
+	cmd := shellCommand(s.get)
+	cmd.Stderr = os.Stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("credential helper %q failed: %w", s.get, err)
+	}
+
+	creds := map[string]string{}
+	if len(bytes.TrimSpace(out)) == 0 {
+		return creds, nil
+	}
+
+	if err := json.Unmarshal(out, &creds); err != nil {
+		return nil, fmt.Errorf("credential helper %q printed invalid credentials: %w", s.get, err)
+	}
+
+	return creds, nil
+}
+
+func shellCommand(line string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.Command("cmd", "/C", line)
+	}
+
+	return exec.Command("sh", "-c", line)
+}
@@ -0,0 +1,116 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncryptedStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), CredentialsFileName)
+
+	store := &encryptedStore{path: path, secret: []byte("hunter2")}
+	require.NoError(t, store.Set(AccessTokenFileKey, "token"))
+	require.NoError(t, store.Set(WireGuardStateFileKey, "{}"))
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "token")
+
+	reopened := &encryptedStore{path: path, secret: []byte("hunter2")}
+	token, err := reopened.Get(AccessTokenFileKey)
+	require.NoError(t, err)
+	assert.Equal(t, "token", token)
+
+	require.NoError(t, reopened.Set(AccessTokenFileKey, ""))
+	token, err = reopened.Get(AccessTokenFileKey)
+	require.NoError(t, err)
+	assert.Empty(t, token)
+
+	wrong := &encryptedStore{path: path, secret: []byte("hunter3")}
+	_, err = wrong.Get(WireGuardStateFileKey)
+	assert.ErrorIs(t, err, ErrCredentialsDecrypt)
+}
+
+func TestMigrateCredentials(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the credential helper commands below need a POSIX shell")
+	}
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, FileName)
+	require.NoError(t, os.WriteFile(path, []byte("access_token: token\ncredential_helper: cat creds.json\ncredential_helper_store: cat > creds.json\n"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "creds.json"), nil, 0o600))
+
+	// the helper commands run in the working directory
+	chdir(t, dir)
+
+	store, err := OpenCredentialStore(path)
+	require.NoError(t, err)
+	require.IsType(t, &commandStore{}, store)
+
+	require.NoError(t, MigrateCredentials(path, store))
+
+	token, err := store.Get(AccessTokenFileKey)
+	require.NoError(t, err)
+	assert.Equal(t, "token", token)
+
+	cfg := New()
+	require.NoError(t, cfg.ApplyFile(path))
+	assert.Empty(t, cfg.AccessToken)
+
+	require.NoError(t, cfg.ApplyCredentials(path))
+	assert.Equal(t, "token", cfg.AccessToken)
+}
+
+func TestReadOnlyCredentialHelper(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the credential helper command below needs a POSIX shell")
+	}
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, FileName)
+	chdir(t, dir)
+	require.NoError(t, os.WriteFile(path, []byte("credential_helper: echo '{\"access_token\":\"helper\"}'\n"), 0o600))
+
+	store, err := OpenCredentialStore(path)
+	require.NoError(t, err)
+	assert.ErrorIs(t, store.Set(AccessTokenFileKey, "token"), ErrCredentialsReadOnly)
+
+	cfg := New()
+	require.NoError(t, cfg.ApplyFile(path))
+	require.NoError(t, cfg.ApplyCredentials(path))
+	assert.Equal(t, "helper", cfg.AccessToken)
+
+	// logging in keeps the token in the file, which takes precedence
+	require.NoError(t, SetAccessToken(path, "token"))
+	require.NoError(t, MigrateCredentials(path, store))
+
+	cfg = New()
+	require.NoError(t, cfg.ApplyFile(path))
+	require.NoError(t, cfg.ApplyCredentials(path))
+	assert.Equal(t, "token", cfg.AccessToken)
+
+	// logging out clears what the file keeps
+	require.NoError(t, Clear(path))
+
+	cfg = New()
+	require.NoError(t, cfg.ApplyFile(path))
+	assert.Empty(t, cfg.AccessToken)
+}
+
+// chdir changes the working directory to dir for the test. Without a
+// configuration directory, the configuration file lock is created in the
+// working directory.
+func chdir(t *testing.T, dir string) {
+	t.Helper()
+
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	require.NoError(t, os.Chdir(dir))
+	t.Cleanup(func() { _ = os.Chdir(wd) })
+}
@@ -3,6 +3,7 @@ package config
 import (
 	"bytes"
 	"context"
+	"errors"
 	"os"
 	"path/filepath"
 
@@ -13,8 +14,21 @@ import (
 )
 
 // SetAccessToken sets the value of the access token at the configuration file
-// found at path.
+// found at path, or at the credential store the file selects unless the store
+// is read-only.
 func SetAccessToken(path, token string) error {
+	switch store, err := OpenCredentialStore(path); {
+	case err != nil:
+		return err
+	case store != nil:
+		switch err := store.Set(AccessTokenFileKey, token); {
+		case err == nil:
+			token = ""
+		case !errors.Is(err, ErrCredentialsReadOnly):
+			return err
+		}
+	}
+
 	return set(path, map[string]interface{}{
 		AccessTokenFileKey: token,
 	})
@@ -37,8 +51,19 @@ func SetSendMetrics(path string, sendMetrics bool) error {
 }
 
 // Clear clears the access token, metrics token, and wireguard-related keys of the configuration
-// file found at path.
+// file found at path, and of the credential store the file selects unless the store is read-only.
 func Clear(path string) (err error) {
+	switch store, err := OpenCredentialStore(path); {
+	case err != nil:
+		return err
+	case store != nil:
+		for _, key := range []string{AccessTokenFileKey, WireGuardStateFileKey} {
+			if err := store.Set(key, ""); err != nil && !errors.Is(err, ErrCredentialsReadOnly) {
+				return err
+			}
+		}
+	}
+
 	return set(path, map[string]interface{}{
 		AccessTokenFileKey:    "",
 		MetricsTokenFileKey:   "",
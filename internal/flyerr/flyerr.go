@@ -39,6 +39,20 @@ func GetErrorSuggestion(err error) string {
 	return ""
 }
 
+// ErrorExitCode is an error that dictates the exit code the CLI exits with
+type ErrorExitCode interface {
+	error
+	ExitCode() int
+}
+
+func GetErrorExitCode(err error) (int, bool) {
+	var ferr ErrorExitCode
+	if errors.As(err, &ferr) {
+		return ferr.ExitCode(), true
+	}
+	return 0, false
+}
+
 func PrintCLIOutput(err error) {
 	if err == nil {
 		return
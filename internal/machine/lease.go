@@ -4,6 +4,10 @@ import (
 	"context"
 	"fmt"
 	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/errgroup"
 
 	"github.com/superfly/flyctl/api"
 	"github.com/superfly/flyctl/flaps"
@@ -89,3 +93,84 @@ func AcquireLease(ctx context.Context, machine *api.Machine) (*api.Machine, rele
 
 	return machine, releaseFunc, nil
 }
+
+// findLeasesConcurrency caps how many leases FindLeases looks up at once.
+const findLeasesConcurrency = 8
+
+// FindLeases returns the leases currently held on the specified machines, keyed
+// by machine ID. Machines without a lease are left out.
+func FindLeases(ctx context.Context, machineIDs []string) (map[string]*api.MachineLease, error) {
+	flapsClient := flaps.FromContext(ctx)
+
+	var (
+		mu     sync.Mutex
+		leases = make(map[string]*api.MachineLease)
+	)
+
+	eg, ctx := errgroup.WithContext(ctx)
+	eg.SetLimit(findLeasesConcurrency)
+
+	for _, machineID := range machineIDs {
+		machineID := machineID
+
+		eg.Go(func() error {
+			lease, err := flapsClient.FindLease(ctx, machineID)
+			if err != nil {
+				if strings.Contains(err.Error(), " lease not found") {
+					return nil
+				}
+				return err
+			}
+			if lease == nil || lease.Data == nil {
+				return nil
+			}
+
+			mu.Lock()
+			leases[machineID] = lease
+			mu.Unlock()
+
+			return nil
+		})
+	}
+
+	if err := eg.Wait(); err != nil {
+		return nil, err
+	}
+
+	return leases, nil
+}
+
+// FindStaleLeases returns the leases on the specified machines that were last
+// refreshed more than olderThan ago. The API only reports when a lease
+// expires, so a lease is taken to have been refreshed ttl before that, ttl
+// being the lease time its holder asks for. Deployments refresh their leases
+// well before they expire, so a lease left untouched for longer than that most
+// likely belongs to a flyctl process that is no longer running.
+func FindStaleLeases(ctx context.Context, machineIDs []string, olderThan, ttl time.Duration) (map[string]*api.MachineLease, error) {
+	leases, err := FindLeases(ctx, machineIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	return StaleLeases(leases, olderThan, ttl, time.Now()), nil
+}
+
+// StaleLeases returns the leases, keyed by machine ID, that were last refreshed
+// at or before now minus olderThan, taking each to have been refreshed ttl
+// before it expires. A holder that asked for a shorter lease time than ttl
+// refreshed its lease later than that, so its lease may be returned while
+// it's still being refreshed; callers should only release leases whose holder
+// they know the lease time of.
+func StaleLeases(leases map[string]*api.MachineLease, olderThan, ttl time.Duration, now time.Time) map[string]*api.MachineLease {
+	cutoff := now.Add(-olderThan)
+
+	stale := make(map[string]*api.MachineLease)
+	for machineID, lease := range leases {
+		refreshedAt := time.Unix(lease.Data.ExpiresAt, 0).Add(-ttl)
+		if !refreshedAt.After(cutoff) {
+			stale[machineID] = lease
+		}
+	}
+
+	return stale
+}
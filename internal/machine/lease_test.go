@@ -0,0 +1,44 @@
+package machine
+
+import (
+	"testing"
+	"time"
+
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/superfly/flyctl/api"
+)
+
+func TestStaleLeases(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	lease := func(expiresIn time.Duration) *api.MachineLease {
+		return &api.MachineLease{Data: &api.MachineLeaseData{
+			Nonce:     "nonce",
+			ExpiresAt: now.Add(expiresIn).Unix(),
+		}}
+	}
+
+	leases := map[string]*api.MachineLease{
+		// refreshed just now
+		"fresh": lease(time.Hour),
+		// refreshed 10 minutes ago
+		"recent": lease(50 * time.Minute),
+		// refreshed 2 hours ago, exactly at the cutoff
+		"cutoff": lease(-time.Hour),
+		// refreshed 3 hours ago
+		"old": lease(-2 * time.Hour),
+	}
+
+	stale := StaleLeases(leases, 2*time.Hour, time.Hour, now)
+	assert.ElementsMatch(t, []string{"cutoff", "old"}, lo.Keys(stale))
+
+	stale = StaleLeases(leases, 5*time.Minute, time.Hour, now)
+	assert.ElementsMatch(t, []string{"recent", "cutoff", "old"}, lo.Keys(stale))
+
+	// a shorter TTL makes leases look like they were refreshed more recently
+	stale = StaleLeases(leases, 2*time.Hour, time.Minute, now)
+	assert.ElementsMatch(t, []string{"old"}, lo.Keys(stale))
+
+	assert.Empty(t, StaleLeases(nil, time.Hour, time.Hour, now))
+}
@@ -0,0 +1,164 @@
+package machine
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/samber/lo"
+
+	"github.com/superfly/flyctl/api"
+	"github.com/superfly/flyctl/flaps"
+	"github.com/superfly/flyctl/internal/flag"
+)
+
+// SelectFlags select the machines of an app commands run against.
+var SelectFlags = flag.Set{
+	flag.StringSlice{
+		Name:        "machine",
+		Description: "Target the machine with this ID; may be repeated",
+	},
+	flag.String{
+		Name:        "process-group",
+		Description: "Target the machines of this process group",
+	},
+	flag.StringArray{
+		Name:        "select-meta",
+		Description: "Target the machines with this key=value metadata; may be repeated",
+	},
+}
+
+// Selector selects machines by ID, process group and metadata. Machines match
+// when they match all of what's set.
+type Selector struct {
+	IDs          []string
+	ProcessGroup string
+	Metadata     map[string]string
+}
+
+// SelectorFromFlags returns the Selector SelectFlags describe, or nil when
+// none of them are set.
+func SelectorFromFlags(ctx context.Context) (*Selector, error) {
+	s := &Selector{
+		IDs:          flag.GetStringSlice(ctx, "machine"),
+		ProcessGroup: flag.GetString(ctx, "process-group"),
+	}
+
+	for _, kv := range flag.GetStringArray(ctx, "select-meta") {
+		key, value, ok := strings.Cut(kv, "=")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid --select-meta %q: want key=value", kv)
+		}
+
+		if s.Metadata == nil {
+			s.Metadata = map[string]string{}
+		}
+		s.Metadata[key] = value
+	}
+
+	if len(s.IDs) == 0 && s.ProcessGroup == "" && len(s.Metadata) == 0 {
+		return nil, nil
+	}
+
+	return s, nil
+}
+
+// Matches reports whether the machine matches the selector.
+func (s *Selector) Matches(m *api.Machine) bool {
+	if len(s.IDs) > 0 && !lo.Contains(s.IDs, m.ID) {
+		return false
+	}
+
+	if s.ProcessGroup != "" && !m.HasProcessGroup(s.ProcessGroup) {
+		return false
+	}
+
+	for key, value := range s.Metadata {
+		if m.Config == nil || m.Config.Metadata[key] != value {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (s *Selector) String() string {
+	var parts []string
+
+	if len(s.IDs) > 0 {
+		parts = append(parts, "machine "+strings.Join(s.IDs, ", "))
+	}
+	if s.ProcessGroup != "" {
+		parts = append(parts, "process group "+s.ProcessGroup)
+	}
+
+	keys := lo.Keys(s.Metadata)
+	sort.Strings(keys)
+	for _, key := range keys {
+		parts = append(parts, fmt.Sprintf("metadata %s=%s", key, s.Metadata[key]))
+	}
+
+	return strings.Join(parts, " and ")
+}
+
+// Select returns the started machines of the app flapsClient is for that
+// match the selector. It fails when none match.
+func (s *Selector) Select(ctx context.Context, flapsClient *flaps.Client) ([]*api.Machine, error) {
+	machines, err := flapsClient.ListActive(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	machines = lo.Filter(machines, func(m *api.Machine, _ int) bool {
+		return m.State == api.MachineStateStarted && s.Matches(m)
+	})
+
+	if len(machines) == 0 {
+		return nil, fmt.Errorf("no started machines match %s", s)
+	}
+
+	return machines, nil
+}
+
+// SelectOne returns the one started machine the selector selects, for
+// commands that run against a single machine. A lone machine ID is looked up
+// directly, so that it may name a machine Select leaves out, such as a console
+// machine. It fails when more than one machine matches rather than pick one.
+func (s *Selector) SelectOne(ctx context.Context, flapsClient *flaps.Client) (*api.Machine, error) {
+	if len(s.IDs) == 1 {
+		m, err := flapsClient.Get(ctx, s.IDs[0])
+		if err != nil {
+			return nil, err
+		}
+
+		switch {
+		case !s.Matches(m):
+			return nil, fmt.Errorf("machine %s doesn't match %s", m.ID, s)
+		case m.State != api.MachineStateStarted:
+			return nil, fmt.Errorf("machine %s is not started", m.ID)
+		}
+
+		return m, nil
+	}
+
+	machines, err := s.Select(ctx, flapsClient)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.One(machines)
+}
+
+// One returns the machine of machines, the ones the selector selected, for
+// commands that run against a single machine. It fails when there are more
+// than one rather than pick one.
+func (s *Selector) One(machines []*api.Machine) (*api.Machine, error) {
+	if len(machines) > 1 {
+		ids := lo.Map(machines, func(m *api.Machine, _ int) string { return m.ID })
+
+		return nil, fmt.Errorf("%d machines match %s (%s); select one with --machine", len(machines), s, strings.Join(ids, ", "))
+	}
+
+	return machines[0], nil
+}
@@ -0,0 +1,49 @@
+package machine
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/superfly/flyctl/api"
+)
+
+func TestSelectorMatches(t *testing.T) {
+	web := &api.Machine{ID: "a1", Config: &api.MachineConfig{Metadata: map[string]string{
+		api.MachineConfigMetadataKeyFlyProcessGroup: "web",
+		"role": "primary",
+	}}}
+	worker := &api.Machine{ID: "b2", Config: &api.MachineConfig{Metadata: map[string]string{
+		api.MachineConfigMetadataKeyFlyProcessGroup: "worker",
+	}}}
+	bare := &api.Machine{ID: "c3"}
+
+	s := &Selector{ProcessGroup: "web"}
+	assert.True(t, s.Matches(web))
+	assert.False(t, s.Matches(worker))
+	assert.False(t, s.Matches(bare))
+
+	s = &Selector{Metadata: map[string]string{"role": "primary"}}
+	assert.True(t, s.Matches(web))
+	assert.False(t, s.Matches(bare))
+
+	s = &Selector{IDs: []string{"b2", "c3"}}
+	assert.False(t, s.Matches(web))
+	assert.True(t, s.Matches(worker))
+	assert.True(t, s.Matches(bare))
+
+	s = &Selector{IDs: []string{"a1"}, Metadata: map[string]string{"role": "primary", "zone": "x"}}
+	assert.False(t, s.Matches(web))
+	assert.Equal(t, "machine a1 and metadata role=primary and metadata zone=x", s.String())
+}
+
+func TestSelectorOne(t *testing.T) {
+	s := &Selector{ProcessGroup: "web"}
+
+	m, err := s.One([]*api.Machine{{ID: "a1"}})
+	assert.NoError(t, err)
+	assert.Equal(t, "a1", m.ID)
+
+	_, err = s.One([]*api.Machine{{ID: "a1"}, {ID: "b2"}})
+	assert.EqualError(t, err, "2 machines match process group web (a1, b2); select one with --machine")
+}
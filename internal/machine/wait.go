@@ -8,6 +8,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/azazeal/pause"
 	"github.com/jpillora/backoff"
 	"github.com/superfly/flyctl/api"
 	"github.com/superfly/flyctl/flaps"
@@ -58,3 +59,43 @@ func WaitForStartOrStop(ctx context.Context, machine *api.Machine, action string
 		}
 	}
 }
+
+// WaitForState blocks until the machine reaches the given state and returns the
+// machine as last seen. A machine that can no longer be found is considered
+// destroyed. It returns the context's error once ctx is done.
+func WaitForState(ctx context.Context, machineID, state string) (*api.Machine, error) {
+	var (
+		flapsClient = flaps.FromContext(ctx)
+		b           = &backoff.Backoff{
+			Min:    500 * time.Millisecond,
+			Max:    5 * time.Second,
+			Factor: 2,
+			Jitter: true,
+		}
+	)
+
+	for {
+		machine, err := flapsClient.Get(ctx, machineID)
+		switch {
+		case err != nil && ctx.Err() != nil:
+			return nil, ctx.Err()
+		case errors.Is(err, flaps.FlapsErrorNotFound) && state == api.MachineStateDestroyed:
+			return &api.Machine{ID: machineID, State: api.MachineStateDestroyed}, nil
+		case err != nil:
+			return nil, fmt.Errorf("could not get machine %s: %w", machineID, err)
+		case machine.State == state:
+			return machine, nil
+		case !machine.IsActive() && state != api.MachineStateDestroyed:
+			return nil, fmt.Errorf("machine %s is %s and will never be %s", machineID, machine.State, state)
+		}
+
+		// The machine may be updated while we wait, so its state is checked
+		// again after every attempt.
+		if err := flapsClient.Wait(ctx, machine, state, time.Minute); err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			pause.For(ctx, b.Duration())
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package machine
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/superfly/flyctl/api"
+	"github.com/superfly/flyctl/flaps"
+	"github.com/superfly/flyctl/internal/config"
+	"github.com/superfly/flyctl/internal/logger"
+)
+
+// fakeMachine serves the machine m1 of the app app over the machines API. Its
+// state moves to the next of states whenever a wait for that state succeeds;
+// waits for any other state time out right away. An empty state makes the
+// machine not found.
+type fakeMachine struct {
+	mu     sync.Mutex
+	states []string
+	gets   int
+	waits  int
+}
+
+func (f *fakeMachine) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch r.URL.Path {
+	case "/v1/apps/app/machines/m1":
+		f.gets++
+		if f.states[0] == "" {
+			http.Error(w, `{"error":"not found"}`, http.StatusNotFound)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(&api.Machine{ID: "m1", State: f.states[0]})
+	case "/v1/apps/app/machines/m1/wait":
+		f.waits++
+		if len(f.states) > 1 && r.URL.Query().Get("state") == f.states[1] {
+			f.states = f.states[1:]
+			_, _ = w.Write([]byte("{}"))
+			return
+		}
+		http.Error(w, `{"error":"deadline_exceeded"}`, http.StatusRequestTimeout)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func fakeFlapsContext(t *testing.T, ctx context.Context, fake *fakeMachine) context.Context {
+	t.Helper()
+
+	srv := httptest.NewServer(fake)
+	t.Cleanup(srv.Close)
+	t.Setenv("FLY_FLAPS_BASE_URL", srv.URL)
+
+	ctx = config.NewContext(ctx, &config.Config{})
+	ctx = logger.NewContext(ctx, logger.FromEnv(io.Discard))
+	client, err := flaps.NewWithOptions(ctx, flaps.NewClientOpts{AppName: "app"})
+	require.NoError(t, err)
+
+	return flaps.NewContext(ctx, client)
+}
+
+func TestWaitForStateReachesState(t *testing.T) {
+	fake := &fakeMachine{states: []string{api.MachineStateStopped, api.MachineStateStarted}}
+	ctx := fakeFlapsContext(t, context.Background(), fake)
+
+	m, err := WaitForState(ctx, "m1", api.MachineStateStarted)
+	require.NoError(t, err)
+	assert.Equal(t, api.MachineStateStarted, m.State)
+	assert.Equal(t, 2, fake.gets)
+	assert.Equal(t, 1, fake.waits)
+
+	// a machine already in the state is returned right away
+	m, err = WaitForState(ctx, "m1", api.MachineStateStarted)
+	require.NoError(t, err)
+	assert.Equal(t, api.MachineStateStarted, m.State)
+	assert.Equal(t, 1, fake.waits)
+}
+
+func TestWaitForStateDestroyed(t *testing.T) {
+	fake := &fakeMachine{states: []string{""}}
+	ctx := fakeFlapsContext(t, context.Background(), fake)
+
+	m, err := WaitForState(ctx, "m1", api.MachineStateDestroyed)
+	require.NoError(t, err)
+	assert.Equal(t, &api.Machine{ID: "m1", State: api.MachineStateDestroyed}, m)
+
+	_, err = WaitForState(ctx, "m1", api.MachineStateStarted)
+	assert.ErrorIs(t, err, flaps.FlapsErrorNotFound)
+}
+
+func TestWaitForStateNeverReached(t *testing.T) {
+	fake := &fakeMachine{states: []string{api.MachineStateDestroying}}
+	ctx := fakeFlapsContext(t, context.Background(), fake)
+
+	_, err := WaitForState(ctx, "m1", api.MachineStateStarted)
+	assert.EqualError(t, err, "machine m1 is destroying and will never be started")
+	assert.Zero(t, fake.waits)
+}
+
+func TestWaitForStateTimeout(t *testing.T) {
+	fake := &fakeMachine{states: []string{api.MachineStateStopped}}
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	ctx = fakeFlapsContext(t, ctx, fake)
+
+	start := time.Now()
+	_, err := WaitForState(ctx, "m1", api.MachineStateStarted)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), 5*time.Second)
+	assert.Positive(t, fake.waits)
+}
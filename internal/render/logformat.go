@@ -0,0 +1,183 @@
+package render
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/logrusorgru/aurora"
+
+	"github.com/superfly/flyctl/logs"
+)
+
+// LogFormatter renders a log entry.
+type LogFormatter func(w io.Writer, entry logs.LogEntry, opts ...LogOption) error
+
+// LogFormat returns the formatter for the named format: "default" for the
+// usual layout, "short" for just the time, level and message, "logfmt", or
+// otherwise a Go template executed against the log entry, e.g.
+// '{{.Timestamp}} {{.Region}} {{.Message}}'.
+//
+// Besides the fields of the entry, templates can use .Time, the timestamp as
+// a time.Time, and the json, upper, lower and pad functions.
+func LogFormat(format string) (LogFormatter, error) {
+	switch format {
+	case "", "default":
+		return LogEntry, nil
+	case "short":
+		return shortLogEntry, nil
+	case "logfmt":
+		return logfmtLogEntry, nil
+	}
+
+	tmpl, err := template.New("log").Funcs(logTemplateFuncs).Parse(format)
+	if err != nil {
+		return nil, fmt.Errorf("invalid log format: %w", err)
+	}
+	return templateLogFormatter(tmpl), nil
+}
+
+var logTemplateFuncs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+	"pad": func(n int, s string) string {
+		return fmt.Sprintf("%-*s", n, s)
+	},
+}
+
+type logTemplateData struct {
+	logs.LogEntry
+	Time time.Time
+}
+
+func templateLogFormatter(tmpl *template.Template) LogFormatter {
+	return func(w io.Writer, entry logs.LogEntry, opts ...LogOption) error {
+		options := newLogOptions(opts)
+
+		ts := entryTimestamp(entry, options)
+		if !ts.IsZero() {
+			entry.Timestamp = ts.Format(time.RFC3339Nano)
+		}
+		entry.Message = message(entry, options)
+
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, logTemplateData{LogEntry: entry, Time: ts}); err != nil {
+			return fmt.Errorf("failed rendering log entry: %w", err)
+		}
+		if !bytes.HasSuffix(buf.Bytes(), []byte("\n")) {
+			buf.WriteByte('\n')
+		}
+
+		_, err := buf.WriteTo(w)
+		return err
+	}
+}
+
+func shortLogEntry(w io.Writer, entry logs.LogEntry, opts ...LogOption) error {
+	options := newLogOptions(opts)
+
+	var buf bytes.Buffer
+	if options.ShowApp && entry.App != "" {
+		fmt.Fprintf(&buf, "%s ", aurora.Colorize(entry.App, appColor(entry.App)).Bold())
+	}
+	if ts := entryTimestamp(entry, options); !ts.IsZero() {
+		fmt.Fprintf(&buf, "%s ", aurora.Faint(ts.Format("15:04:05")))
+	}
+	fmt.Fprintf(&buf, "[%s] %s\n", aurora.Colorize(entry.Level, levelColor(entry.Level)), message(entry, options))
+
+	_, err := buf.WriteTo(w)
+	return err
+}
+
+func logfmtLogEntry(w io.Writer, entry logs.LogEntry, opts ...LogOption) error {
+	options := newLogOptions(opts)
+
+	var buf bytes.Buffer
+	field := func(key, value string) {
+		if value == "" {
+			return
+		}
+		if buf.Len() > 0 {
+			buf.WriteByte(' ')
+		}
+		fmt.Fprintf(&buf, "%s=%s", key, logfmtValue(value))
+	}
+
+	timestamp := entry.Timestamp
+	if ts := entryTimestamp(entry, options); !ts.IsZero() {
+		timestamp = ts.Format(time.RFC3339Nano)
+	}
+
+	field("time", timestamp)
+	field("app", entry.App)
+	field("region", entry.Region)
+	field("instance", entry.Instance)
+	field("level", entry.Level)
+	if status := entry.Meta.HTTP.Response.StatusCode; status > 0 {
+		field("status", strconv.Itoa(status))
+	}
+	field("msg", entry.Message)
+	buf.WriteByte('\n')
+
+	_, err := buf.WriteTo(w)
+	return err
+}
+
+func logfmtValue(s string) string {
+	if s != "" && !strings.ContainsAny(s, " =\"\t\n\r") {
+		return s
+	}
+	return strconv.Quote(s)
+}
+
+func newLogOptions(opts []LogOption) *LogOptions {
+	options := &LogOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+	return options
+}
+
+// entryTimestamp returns the parsed timestamp of the entry, in the timezone
+// requested by the options, or the zero time if it can't be parsed.
+func entryTimestamp(entry logs.LogEntry, options *LogOptions) time.Time {
+	ts, err := time.Parse(time.RFC3339Nano, entry.Timestamp)
+	if err != nil {
+		return time.Time{}
+	}
+	if options.LocalTime {
+		ts = ts.Local()
+	}
+	return ts
+}
+
+var jsonKeyPattern = regexp.MustCompile(`(?m)^(\s*)("(?:[^"\\]|\\.)*")(:)`)
+
+// message returns the message of the entry, pretty-printed if it's a JSON
+// object and the options ask for it.
+func message(entry logs.LogEntry, options *LogOptions) string {
+	msg := strings.TrimSpace(entry.Message)
+	if !options.PrettyJSON || !strings.HasPrefix(msg, "{") || !json.Valid([]byte(msg)) {
+		return entry.Message
+	}
+
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, []byte(msg), "", "  "); err != nil {
+		return entry.Message
+	}
+
+	return "\n" + jsonKeyPattern.ReplaceAllStringFunc(buf.String(), func(line string) string {
+		m := jsonKeyPattern.FindStringSubmatch(line)
+		return m[1] + aurora.Cyan(m[2]).String() + m[3]
+	})
+}
@@ -0,0 +1,54 @@
+package render
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/logrusorgru/aurora"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/superfly/flyctl/logs"
+)
+
+func TestLogFormat(t *testing.T) {
+	entry := logs.LogEntry{
+		App:       "my-app",
+		Level:     "info",
+		Instance:  "abc123",
+		Region:    "ams",
+		Message:   `hello "world"`,
+		Timestamp: "2023-06-01T12:00:00.5Z",
+	}
+
+	cases := map[string]string{
+		"logfmt": `time=2023-06-01T12:00:00.5Z app=my-app region=ams instance=abc123 level=info msg="hello \"world\""` + "\n",
+		"{{.Region}} {{upper .Level}} {{.Message}}":   `ams INFO hello "world"` + "\n",
+		`{{.Time.Format "15:04:05"}} {{json .Level}}`: `12:00:00 "info"` + "\n",
+	}
+
+	for format, want := range cases {
+		formatter, err := LogFormat(format)
+		require.NoError(t, err, format)
+
+		var buf bytes.Buffer
+		require.NoError(t, formatter(&buf, entry), format)
+		assert.Equal(t, want, buf.String(), format)
+	}
+
+	_, err := LogFormat("{{.Message")
+	assert.Error(t, err)
+}
+
+func TestPrettyJSONMessage(t *testing.T) {
+	entry := logs.LogEntry{Message: `{"user":{"id":42}}`}
+
+	assert.Equal(t, entry.Message, message(entry, &LogOptions{}))
+	assert.Equal(t,
+		"\n{\n  "+aurora.Cyan(`"user"`).String()+": {\n    "+aurora.Cyan(`"id"`).String()+": 42\n  }\n}",
+		message(entry, &LogOptions{PrettyJSON: true}),
+	)
+
+	entry.Message = "not json {"
+	assert.Equal(t, entry.Message, message(entry, &LogOptions{PrettyJSON: true}))
+}
@@ -3,6 +3,7 @@ package render
 import (
 	"bytes"
 	"fmt"
+	"hash/fnv"
 	"io"
 	"time"
 
@@ -17,6 +18,9 @@ type LogOptions struct {
 	RemoveNewlines bool
 	HideRegion     bool
 	HideAllocID    bool
+	ShowApp        bool
+	LocalTime      bool
+	PrettyJSON     bool
 }
 
 // LogOption is a func type that returns a LogOption.
@@ -43,11 +47,30 @@ func HideAllocID() LogOption {
 	}
 }
 
-func LogEntry(w io.Writer, entry logs.LogEntry, opts ...LogOption) (err error) {
-	options := &LogOptions{}
-	for _, opt := range opts {
-		opt(options)
+// LocalTime shows timestamps in the local timezone rather than in UTC.
+func LocalTime() LogOption {
+	return func(o *LogOptions) {
+		o.LocalTime = true
+	}
+}
+
+// PrettyJSON indents messages that are JSON objects and highlights their keys.
+func PrettyJSON() LogOption {
+	return func(o *LogOptions) {
+		o.PrettyJSON = true
 	}
+}
+
+// ShowApp prefixes the log output with the name of the app, colored
+// consistently for each app.
+func ShowApp() LogOption {
+	return func(o *LogOptions) {
+		o.ShowApp = true
+	}
+}
+
+func LogEntry(w io.Writer, entry logs.LogEntry, opts ...LogOption) (err error) {
+	options := newLogOptions(opts)
 
 	var ts time.Time
 	if ts, err = time.Parse(time.RFC3339Nano, entry.Timestamp); err != nil {
@@ -55,6 +78,9 @@ func LogEntry(w io.Writer, entry logs.LogEntry, opts ...LogOption) (err error) {
 
 		return
 	}
+	if options.LocalTime {
+		ts = ts.Local()
+	}
 
 	if !options.HideAllocID {
 		if entry.Meta.Event.Provider != "" {
@@ -74,6 +100,9 @@ func LogEntry(w io.Writer, entry logs.LogEntry, opts ...LogOption) (err error) {
 	}
 
 	var buf bytes.Buffer
+	if options.ShowApp && entry.App != "" {
+		fmt.Fprintf(&buf, "%s ", aurora.Colorize(entry.App, appColor(entry.App)).Bold())
+	}
 	fmt.Fprintf(&buf, "%s ", aurora.Faint(format.Time(ts)))
 
 	if entry.Meta.Event.Provider != "" {
@@ -96,7 +125,7 @@ func LogEntry(w io.Writer, entry logs.LogEntry, opts ...LogOption) (err error) {
 	printFieldIfPresent(&buf, "response.status", entry.Meta.HTTP.Response.StatusCode)
 
 	if !hadErrorMsg {
-		buf.Write([]byte(entry.Message))
+		buf.WriteString(message(entry, options))
 	}
 
 	buf.WriteByte('\n')
@@ -136,3 +165,18 @@ func levelColor(level string) aurora.Color {
 		return aurora.YellowFg
 	}
 }
+
+var appColors = []aurora.Color{
+	aurora.CyanFg,
+	aurora.MagentaFg,
+	aurora.YellowFg,
+	aurora.GreenFg,
+	aurora.BlueFg,
+	aurora.RedFg,
+}
+
+func appColor(app string) aurora.Color {
+	h := fnv.New32a()
+	h.Write([]byte(app))
+	return appColors[h.Sum32()%uint32(len(appColors))]
+}
@@ -1,19 +1,25 @@
 package wireguard
 
 import (
+	"bytes"
 	"context"
 	"crypto/rand"
 	"encoding/base64"
+	"encoding/json"
 	"fmt"
+	"math"
 	"os"
 	"regexp"
+	"sort"
 	"strings"
+	"sync"
 
 	"github.com/oklog/ulid/v2"
 	"github.com/pkg/errors"
 	"github.com/spf13/viper"
 	"github.com/superfly/flyctl/api"
 	"github.com/superfly/flyctl/flyctl"
+	"github.com/superfly/flyctl/internal/config"
 	"github.com/superfly/flyctl/terminal"
 	"github.com/superfly/flyctl/wg"
 	"golang.org/x/crypto/curve25519"
@@ -43,8 +49,24 @@ func StateForOrg(apiClient *api.Client, org *api.Organization, regionCode string
 	if err != nil {
 		return nil, err
 	}
+
+	if regionCode == "" {
+		regionCode = PinnedRegion(org.Slug)
+	}
+
 	if state != nil && !recycle {
-		return state, nil
+		if regionCode == "" || state.Region == regionCode {
+			return state, nil
+		}
+
+		// the pinned region changed; prefer the fallback peer there, if any
+		if promoted := promote(state, regionCode); promoted != nil {
+			if err := setWireGuardStateForOrg(org.Slug, promoted); err != nil {
+				return nil, err
+			}
+
+			return promoted, nil
+		}
 	}
 
 	terminal.Debugf("Can't find matching WireGuard configuration; creating new one\n")
@@ -64,6 +86,14 @@ func StateForOrg(apiClient *api.Client, org *api.Organization, regionCode string
 		return nil, err
 	}
 
+	if state != nil {
+		stateb.Fallbacks = state.Fallbacks
+		if !recycle {
+			// keep the peer of the previous region to fail over to
+			stateb.Fallbacks = append([]*wg.WireGuardState{withoutFallbacks(state)}, stateb.Fallbacks...)
+		}
+	}
+
 	if err := setWireGuardStateForOrg(org.Slug, stateb); err != nil {
 		return nil, err
 	}
@@ -71,6 +101,178 @@ func StateForOrg(apiClient *api.Client, org *api.Organization, regionCode string
 	return stateb, nil
 }
 
+// promote returns the state with its fallback peer in the region as the
+// preferred peer, or nil if there's no fallback peer in the region.
+func promote(state *wg.WireGuardState, region string) *wg.WireGuardState {
+	for i, fallback := range state.Fallbacks {
+		if fallback.Region != region {
+			continue
+		}
+
+		promoted := withoutFallbacks(fallback)
+		promoted.Fallbacks = append(promoted.Fallbacks, withoutFallbacks(state))
+		promoted.Fallbacks = append(promoted.Fallbacks, state.Fallbacks[:i]...)
+		promoted.Fallbacks = append(promoted.Fallbacks, state.Fallbacks[i+1:]...)
+
+		return promoted
+	}
+
+	return nil
+}
+
+// PreferFallback makes the organization's fallback peer in the region its
+// preferred peer, so that tunnels keep going through it rather than through
+// the peer it took over from. Nothing changes when the preferred peer is
+// already in the region or there's no fallback peer there.
+func PreferFallback(orgSlug, region string) error {
+	state, err := getWireGuardStateForOrg(orgSlug)
+	if err != nil || state == nil || state.Region == region {
+		return err
+	}
+
+	promoted := promote(state, region)
+	if promoted == nil {
+		return nil
+	}
+
+	return setWireGuardStateForOrg(orgSlug, promoted)
+}
+
+func withoutFallbacks(state *wg.WireGuardState) *wg.WireGuardState {
+	s := *state
+	s.Fallbacks = nil
+
+	return &s
+}
+
+// FallbackForOrg returns a peer of the organization in a gateway region other
+// than the excluded ones. Unless the organization already has such a peer, one
+// is created in the closest gateway region that isn't excluded.
+func FallbackForOrg(ctx context.Context, apiClient *api.Client, org *api.Organization, exclude ...string) (*wg.WireGuardState, error) {
+	state, err := getWireGuardStateForOrg(org.Slug)
+	if err != nil {
+		return nil, err
+	}
+	if state == nil {
+		return nil, fmt.Errorf("no WireGuard peer for organization %s", org.Slug)
+	}
+
+	excluded := func(region string) bool {
+		for _, r := range exclude {
+			if r == region {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	for _, fallback := range state.Fallbacks {
+		if !excluded(fallback.Region) {
+			return fallback, nil
+		}
+	}
+
+	regions, err := GatewayRegions(ctx, apiClient)
+	if err != nil {
+		return nil, err
+	}
+
+	var regionCode string
+	for _, region := range regions {
+		if !excluded(region.Code) {
+			regionCode = region.Code
+
+			break
+		}
+	}
+	if regionCode == "" {
+		return nil, errors.New("no other gateway region to fail over to")
+	}
+
+	name, err := generatePeerName(ctx, apiClient)
+	if err != nil {
+		return nil, err
+	}
+
+	fallback, err := Create(apiClient, org, regionCode, fmt.Sprintf("interactive-agent-%s", name))
+	if err != nil {
+		return nil, err
+	}
+
+	state.Fallbacks = append(state.Fallbacks, fallback)
+	if err := setWireGuardStateForOrg(org.Slug, state); err != nil {
+		return nil, err
+	}
+
+	return fallback, nil
+}
+
+// GatewayRegions returns the regions WireGuard peers may be created in,
+// closest first.
+func GatewayRegions(ctx context.Context, apiClient *api.Client) ([]api.Region, error) {
+	all, nearest, err := apiClient.PlatformRegions(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	regions := make([]api.Region, 0, len(all))
+	for _, region := range all {
+		if region.GatewayAvailable {
+			regions = append(regions, region)
+		}
+	}
+
+	if nearest != nil {
+		sort.SliceStable(regions, func(i, j int) bool {
+			return distance(*nearest, regions[i]) < distance(*nearest, regions[j])
+		})
+	}
+
+	return regions, nil
+}
+
+// distance returns the great-circle distance between the regions, in radians.
+func distance(a, b api.Region) float64 {
+	rad := func(deg float32) float64 {
+		return float64(deg) * math.Pi / 180
+	}
+
+	lat1, lat2 := rad(a.Latitude), rad(b.Latitude)
+	dlat, dlon := lat2-lat1, rad(b.Longitude)-rad(a.Longitude)
+
+	h := math.Pow(math.Sin(dlat/2), 2) + math.Cos(lat1)*math.Cos(lat2)*math.Pow(math.Sin(dlon/2), 2)
+
+	return 2 * math.Asin(math.Sqrt(h))
+}
+
+// PinnedRegion returns the gateway region pinned for the organization, if any.
+func PinnedRegion(orgSlug string) string {
+	return viper.GetStringMapString(flyctl.ConfigWireGuardRegions)[orgSlug]
+}
+
+// PinRegion pins the gateway region of the organization's peer. An empty
+// region unpins it.
+func PinRegion(orgSlug, region string) error {
+	regions := map[string]string{}
+	for org, r := range viper.GetStringMapString(flyctl.ConfigWireGuardRegions) {
+		regions[org] = r
+	}
+
+	if region == "" {
+		delete(regions, orgSlug)
+	} else {
+		regions[orgSlug] = region
+	}
+
+	viper.Set(flyctl.ConfigWireGuardRegions, regions)
+	if err := flyctl.SaveConfig(); err != nil {
+		return errors.Wrap(err, "error saving config file")
+	}
+
+	return nil
+}
+
 func Create(apiClient *api.Client, org *api.Organization, regionCode, name string) (*wg.WireGuardState, error) {
 	ctx := context.TODO()
 	var (
@@ -140,6 +342,23 @@ func C25519pair() (string, string) {
 
 type WireGuardStates map[string]*wg.WireGuardState
 
+var (
+	credentialsOnce  sync.Once
+	credentials      config.CredentialStore
+	credentialsError error
+)
+
+// credentialStore returns the store the WireGuard state is kept in, or nil
+// when it's kept in the config file. The store is opened once, so that its
+// key is derived once.
+func credentialStore() (config.CredentialStore, error) {
+	credentialsOnce.Do(func() {
+		credentials, credentialsError = config.OpenCredentialStore(flyctl.ConfigFilePath())
+	})
+
+	return credentials, credentialsError
+}
+
 func GetWireGuardState() (WireGuardStates, error) {
 	states := WireGuardStates{}
 
@@ -147,7 +366,53 @@ func GetWireGuardState() (WireGuardStates, error) {
 		return nil, errors.Wrap(err, "invalid wireguard state")
 	}
 
-	return states, nil
+	store, err := credentialStore()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed opening credential store")
+	}
+	if store == nil {
+		return states, nil
+	}
+
+	stored, err := loadStoredWireGuardState(store)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(states) == 0 {
+		return stored, nil
+	}
+
+	// the config file still keeps peers in plain text; move them to the store
+	merged := WireGuardStates{}
+	for org, state := range states {
+		merged[org] = state
+	}
+	for org, state := range stored {
+		merged[org] = state
+	}
+
+	switch err := storeWireGuardState(store, merged); {
+	case err == nil:
+		break
+	case errors.Is(err, config.ErrCredentialsReadOnly):
+		// the peers stay in the file, and being what flyctl last wrote, take
+		// precedence over the store's
+		for org, state := range states {
+			stored[org] = state
+		}
+
+		return stored, nil
+	default:
+		return nil, err
+	}
+
+	viper.Set(flyctl.ConfigWireGuardState, WireGuardStates{})
+	if err := flyctl.SaveConfig(); err != nil {
+		return nil, errors.Wrap(err, "error saving config file")
+	}
+
+	return merged, nil
 }
 
 func getWireGuardStateForOrg(orgSlug string) (*wg.WireGuardState, error) {
@@ -159,7 +424,56 @@ func getWireGuardStateForOrg(orgSlug string) (*wg.WireGuardState, error) {
 	return states[orgSlug], nil
 }
 
+func loadStoredWireGuardState(store config.CredentialStore) (WireGuardStates, error) {
+	stored := WireGuardStates{}
+
+	switch data, err := store.Get(config.WireGuardStateFileKey); {
+	case err != nil:
+		return nil, errors.Wrap(err, "failed reading wireguard state")
+	case data != "":
+		if err := json.Unmarshal([]byte(data), &stored); err != nil {
+			return nil, errors.Wrap(err, "invalid wireguard state")
+		}
+	}
+
+	return stored, nil
+}
+
+func storeWireGuardState(store config.CredentialStore, s WireGuardStates) error {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+
+	if err := store.Set(config.WireGuardStateFileKey, string(data)); err != nil {
+		return errors.Wrap(err, "error saving wireguard state")
+	}
+
+	return nil
+}
+
+// setWireGuardState saves the state to the credential store, if any, or else to
+// the config file. With a read-only store, the peers the store doesn't already
+// have go to the config file.
 func setWireGuardState(s WireGuardStates) error {
+	store, err := credentialStore()
+	if err != nil {
+		return errors.Wrap(err, "failed opening credential store")
+	}
+
+	if store != nil {
+		switch err := storeWireGuardState(store, s); {
+		case err == nil:
+			s = WireGuardStates{}
+		case errors.Is(err, config.ErrCredentialsReadOnly):
+			if s, err = unstoredWireGuardStates(store, s); err != nil {
+				return err
+			}
+		default:
+			return err
+		}
+	}
+
 	viper.Set(flyctl.ConfigWireGuardState, s)
 	if err := flyctl.SaveConfig(); err != nil {
 		return errors.Wrap(err, "error saving config file")
@@ -168,6 +482,32 @@ func setWireGuardState(s WireGuardStates) error {
 	return nil
 }
 
+// unstoredWireGuardStates returns the states of s the store doesn't have, so
+// that the peers a read-only store provides aren't copied to the config file.
+func unstoredWireGuardStates(store config.CredentialStore, s WireGuardStates) (WireGuardStates, error) {
+	stored, err := loadStoredWireGuardState(store)
+	if err != nil {
+		return nil, err
+	}
+
+	unstored := WireGuardStates{}
+	for org, state := range s {
+		if prev, ok := stored[org]; ok && sameWireGuardState(prev, state) {
+			continue
+		}
+		unstored[org] = state
+	}
+
+	return unstored, nil
+}
+
+func sameWireGuardState(a, b *wg.WireGuardState) bool {
+	ja, erra := json.Marshal(a)
+	jb, errb := json.Marshal(b)
+
+	return erra == nil && errb == nil && bytes.Equal(ja, jb)
+}
+
 func setWireGuardStateForOrg(orgSlug string, s *wg.WireGuardState) error {
 	states, err := GetWireGuardState()
 	if err != nil {
@@ -188,6 +528,9 @@ func PruneInvalidPeers(ctx context.Context, apiClient *api.Client) error {
 	peerIPs := make([]string, 0, len(state))
 	for _, peer := range state {
 		peerIPs = append(peerIPs, peer.Peer.Peerip)
+		for _, fallback := range peer.Fallbacks {
+			peerIPs = append(peerIPs, fallback.Peer.Peerip)
+		}
 	}
 
 	invalidPeerIPs, err := apiClient.ValidateWireGuardPeers(ctx, peerIPs)
@@ -197,10 +540,31 @@ func PruneInvalidPeers(ctx context.Context, apiClient *api.Client) error {
 
 	for _, invalidPeerIP := range invalidPeerIPs {
 		for orgSlug, peer := range state {
-			if peer.Peer.Peerip == invalidPeerIP {
-				terminal.Debugf("removing invalid peer %s for organization %s", invalidPeerIP, orgSlug)
+			fallbacks := peer.Fallbacks[:0]
+			for _, fallback := range peer.Fallbacks {
+				if fallback.Peer.Peerip == invalidPeerIP {
+					terminal.Debugf("removing invalid fallback peer %s for organization %s", invalidPeerIP, orgSlug)
+					continue
+				}
+				fallbacks = append(fallbacks, fallback)
+			}
+			peer.Fallbacks = fallbacks
+
+			if peer.Peer.Peerip != invalidPeerIP {
+				continue
+			}
+
+			terminal.Debugf("removing invalid peer %s for organization %s", invalidPeerIP, orgSlug)
+			if len(peer.Fallbacks) == 0 {
 				delete(state, orgSlug)
+
+				continue
 			}
+
+			// the first fallback peer takes over
+			promoted := withoutFallbacks(peer.Fallbacks[0])
+			promoted.Fallbacks = peer.Fallbacks[1:]
+			state[orgSlug] = promoted
 		}
 	}
 
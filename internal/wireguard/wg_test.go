@@ -0,0 +1,318 @@
+package wireguard
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/superfly/flyctl/api"
+	"github.com/superfly/flyctl/flyctl"
+	"github.com/superfly/flyctl/internal/config"
+	"github.com/superfly/flyctl/wg"
+)
+
+// memStore is a credential store kept in memory.
+type memStore struct {
+	creds    map[string]string
+	readOnly bool
+}
+
+func (s *memStore) Get(name string) (string, error) {
+	return s.creds[name], nil
+}
+
+func (s *memStore) Set(name, value string) error {
+	if s.readOnly {
+		return config.ErrCredentialsReadOnly
+	}
+	s.creds[name] = value
+
+	return nil
+}
+
+// useStore makes the WireGuard state go through store, and the config file be
+// written to a temporary directory.
+func useStore(t *testing.T, store config.CredentialStore) {
+	t.Helper()
+
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	require.NoError(t, os.Chdir(t.TempDir()))
+
+	credentialsOnce.Do(func() {})
+	credentials, credentialsError = store, nil
+
+	t.Cleanup(func() {
+		_ = os.Chdir(wd)
+		credentials = nil
+		viper.Reset()
+	})
+}
+
+func testState(org, peerIP string) *wg.WireGuardState {
+	return &wg.WireGuardState{
+		Org:    org,
+		Region: "ams",
+		Peer:   api.CreatedWireGuardPeer{Peerip: peerIP},
+	}
+}
+
+func fileStates(t *testing.T) WireGuardStates {
+	t.Helper()
+
+	states := WireGuardStates{}
+	require.NoError(t, viper.UnmarshalKey(flyctl.ConfigWireGuardState, &states))
+
+	return states
+}
+
+func TestGetWireGuardStateMigrates(t *testing.T) {
+	store := &memStore{creds: map[string]string{}}
+	useStore(t, store)
+
+	require.NoError(t, storeWireGuardState(store, WireGuardStates{"b": testState("b", "fdaa::2")}))
+	viper.Set(flyctl.ConfigWireGuardState, WireGuardStates{"a": testState("a", "fdaa::1")})
+
+	states, err := GetWireGuardState()
+	require.NoError(t, err)
+	assert.Equal(t, WireGuardStates{"a": testState("a", "fdaa::1"), "b": testState("b", "fdaa::2")}, states)
+
+	// the peers moved out of the config file and into the store
+	assert.Empty(t, fileStates(t))
+	stored, err := loadStoredWireGuardState(store)
+	require.NoError(t, err)
+	assert.Equal(t, states, stored)
+
+	_, err = os.Stat("config.yml")
+	assert.NoError(t, err)
+}
+
+func TestGetWireGuardStateReadOnlyStore(t *testing.T) {
+	store := &memStore{creds: map[string]string{}}
+	require.NoError(t, storeWireGuardState(store, WireGuardStates{
+		"a": testState("a", "fdaa::1"),
+		"b": testState("b", "fdaa::2"),
+	}))
+	store.readOnly = true
+	useStore(t, store)
+
+	viper.Set(flyctl.ConfigWireGuardState, WireGuardStates{"a": testState("a", "fdaa::3")})
+
+	// the file's peers take precedence and stay where they are
+	states, err := GetWireGuardState()
+	require.NoError(t, err)
+	assert.Equal(t, WireGuardStates{"a": testState("a", "fdaa::3"), "b": testState("b", "fdaa::2")}, states)
+	assert.Equal(t, WireGuardStates{"a": testState("a", "fdaa::3")}, fileStates(t))
+
+	// saving doesn't copy the store's peers to the file
+	states["c"] = testState("c", "fdaa::4")
+	require.NoError(t, setWireGuardState(states))
+	assert.Equal(t, WireGuardStates{"a": testState("a", "fdaa::3"), "c": testState("c", "fdaa::4")}, fileStates(t))
+
+	states, err = GetWireGuardState()
+	require.NoError(t, err)
+	assert.Len(t, states, 3)
+}
+
+// fakeAPI returns a client of a GraphQL API that answers with what respond
+// returns for the query and variables of each request.
+func fakeAPI(t *testing.T, respond func(query string, vars map[string]interface{}) interface{}) *api.Client {
+	t.Helper()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Query     string                 `json:"query"`
+			Variables map[string]interface{} `json:"variables"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"data": respond(req.Query, req.Variables),
+		})
+	}))
+	t.Cleanup(srv.Close)
+
+	return api.NewClientFromOptions(api.ClientOptions{BaseURL: srv.URL})
+}
+
+func TestPromote(t *testing.T) {
+	state := testState("org", "fdaa::1")
+	state.Fallbacks = []*wg.WireGuardState{
+		{Org: "org", Region: "ord", Peer: api.CreatedWireGuardPeer{Peerip: "fdaa::2"}},
+		{Org: "org", Region: "syd", Peer: api.CreatedWireGuardPeer{Peerip: "fdaa::3"}},
+	}
+
+	promoted := promote(state, "syd")
+	require.NotNil(t, promoted)
+	assert.Equal(t, "syd", promoted.Region)
+	assert.Equal(t, []string{"ams", "ord"}, regionsOf(promoted.Fallbacks))
+	for _, fallback := range promoted.Fallbacks {
+		assert.Empty(t, fallback.Fallbacks)
+	}
+
+	// the original is left alone
+	assert.Equal(t, "ams", state.Region)
+	assert.Equal(t, []string{"ord", "syd"}, regionsOf(state.Fallbacks))
+
+	assert.Nil(t, promote(state, "lhr"))
+	assert.Nil(t, promote(state, "ams"))
+}
+
+func regionsOf(states []*wg.WireGuardState) []string {
+	regions := make([]string, 0, len(states))
+	for _, s := range states {
+		regions = append(regions, s.Region)
+	}
+
+	return regions
+}
+
+func TestStateForOrgPinnedRegion(t *testing.T) {
+	useStore(t, nil)
+
+	state := testState("org", "fdaa::1")
+	state.Fallbacks = []*wg.WireGuardState{testState("org", "fdaa::2")}
+	state.Fallbacks[0].Region = "ord"
+	require.NoError(t, setWireGuardState(WireGuardStates{"org": state}))
+
+	org := &api.Organization{Slug: "org"}
+
+	// no peers are created, so no API calls are made
+	got, err := StateForOrg(nil, org, "", "", false)
+	require.NoError(t, err)
+	assert.Equal(t, "ams", got.Region)
+
+	require.NoError(t, PinRegion("org", "ord"))
+
+	got, err = StateForOrg(nil, org, "", "", false)
+	require.NoError(t, err)
+	assert.Equal(t, "ord", got.Region)
+	assert.Equal(t, []string{"ams"}, regionsOf(got.Fallbacks))
+
+	// the fallback peer stays preferred
+	saved, err := getWireGuardStateForOrg("org")
+	require.NoError(t, err)
+	assert.Equal(t, got, saved)
+}
+
+func TestPreferFallback(t *testing.T) {
+	useStore(t, nil)
+
+	state := testState("org", "fdaa::1")
+	state.Fallbacks = []*wg.WireGuardState{testState("org", "fdaa::2")}
+	state.Fallbacks[0].Region = "ord"
+	require.NoError(t, setWireGuardState(WireGuardStates{"org": state}))
+
+	require.NoError(t, PreferFallback("org", "ord"))
+
+	saved, err := getWireGuardStateForOrg("org")
+	require.NoError(t, err)
+	assert.Equal(t, "fdaa::2", saved.Peer.Peerip)
+	assert.Equal(t, []string{"ams"}, regionsOf(saved.Fallbacks))
+
+	// already preferred, or unknown
+	require.NoError(t, PreferFallback("org", "ord"))
+	require.NoError(t, PreferFallback("org", "lhr"))
+	require.NoError(t, PreferFallback("other", "ord"))
+
+	saved, err = getWireGuardStateForOrg("org")
+	require.NoError(t, err)
+	assert.Equal(t, "ord", saved.Region)
+}
+
+func TestPruneInvalidPeersPromotesFallback(t *testing.T) {
+	useStore(t, nil)
+
+	withFallbacks := testState("a", "fdaa::1")
+	withFallbacks.Fallbacks = []*wg.WireGuardState{
+		{Org: "a", Region: "ord", Peer: api.CreatedWireGuardPeer{Peerip: "fdaa::2"}},
+		{Org: "a", Region: "syd", Peer: api.CreatedWireGuardPeer{Peerip: "fdaa::3"}},
+	}
+	require.NoError(t, setWireGuardState(WireGuardStates{
+		"a": withFallbacks,
+		"b": testState("b", "fdaa::4"),
+		"c": testState("c", "fdaa::5"),
+	}))
+
+	var validated []interface{}
+	client := fakeAPI(t, func(query string, vars map[string]interface{}) interface{} {
+		validated = vars["input"].(map[string]interface{})["peerIps"].([]interface{})
+
+		return map[string]interface{}{
+			"validateWireGuardPeers": map[string]interface{}{
+				"invalidPeerIps": []string{"fdaa::1", "fdaa::3", "fdaa::4"},
+			},
+		}
+	})
+
+	require.NoError(t, PruneInvalidPeers(context.Background(), client))
+	assert.ElementsMatch(t, []interface{}{"fdaa::1", "fdaa::2", "fdaa::3", "fdaa::4", "fdaa::5"}, validated)
+
+	states, err := GetWireGuardState()
+	require.NoError(t, err)
+
+	// a's first valid fallback took over, b had none left and c was valid
+	require.Len(t, states, 2)
+	assert.Equal(t, "fdaa::2", states["a"].Peer.Peerip)
+	assert.Empty(t, states["a"].Fallbacks)
+	assert.Equal(t, "fdaa::5", states["c"].Peer.Peerip)
+}
+
+func TestGatewayRegions(t *testing.T) {
+	client := fakeAPI(t, func(string, map[string]interface{}) interface{} {
+		region := func(code string, lat, lon float32, gateway bool) map[string]interface{} {
+			return map[string]interface{}{
+				"code":             code,
+				"latitude":         lat,
+				"longitude":        lon,
+				"gatewayAvailable": gateway,
+			}
+		}
+
+		return map[string]interface{}{
+			"platform": map[string]interface{}{
+				"requestRegion": "ams",
+				"regions": []interface{}{
+					region("syd", -33.9, 151.2, true),
+					region("ord", 41.9, -87.6, true),
+					region("lhr", 51.5, -0.1, true),
+					region("cdg", 48.9, 2.4, false),
+					region("ams", 52.4, 4.9, true),
+				},
+			},
+		}
+	})
+
+	regions, err := GatewayRegions(context.Background(), client)
+	require.NoError(t, err)
+
+	codes := make([]string, 0, len(regions))
+	for _, r := range regions {
+		codes = append(codes, r.Code)
+	}
+	assert.Equal(t, []string{"ams", "lhr", "ord", "syd"}, codes)
+}
+
+func TestDistance(t *testing.T) {
+	ams := api.Region{Latitude: 52.4, Longitude: 4.9}
+	lhr := api.Region{Latitude: 51.5, Longitude: -0.1}
+	syd := api.Region{Latitude: -33.9, Longitude: 151.2}
+
+	assert.Zero(t, distance(ams, ams))
+	assert.InDelta(t, distance(ams, lhr), distance(lhr, ams), 1e-12)
+	assert.Less(t, distance(ams, lhr), distance(ams, syd))
+
+	// antipodes are half way around
+	assert.InDelta(t, math.Pi, distance(api.Region{}, api.Region{Longitude: 180}), 1e-6)
+}
@@ -1,6 +1,7 @@
 package logs
 
 type LogEntry struct {
+	App       string `json:"app,omitempty"`
 	Level     string `json:"level"`
 	Instance  string `json:"instance"`
 	Message   string `json:"message"`
@@ -46,7 +47,12 @@ type natsLog struct {
 		Region string `json:"region"`
 	} `json:"fly"`
 	Host string `json:"host"`
-	Log  struct {
+	HTTP struct {
+		Response struct {
+			StatusCode int `json:"status_code"`
+		} `json:"response"`
+	} `json:"http"`
+	Log struct {
 		Level string `json:"level"`
 	} `json:"log"`
 	Message   string `json:"message"`
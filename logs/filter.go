@@ -0,0 +1,202 @@
+package logs
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Filter selects which log entries are returned by a LogStream. The zero value,
+// like a nil *Filter, matches every entry. All the criteria that are set must
+// match for an entry to be returned.
+type Filter struct {
+	// Levels matches entries with any of these levels, ignoring case.
+	Levels []string
+	// Instances matches entries emitted by any of these instances.
+	Instances []string
+	// Grep matches entries whose message matches the expression.
+	Grep *regexp.Regexp
+	// Exclude drops entries whose message matches the expression.
+	Exclude *regexp.Regexp
+	// Statuses matches HTTP request entries whose response status falls in
+	// any of these ranges.
+	Statuses []StatusRange
+	// Fields matches entries with a JSON message satisfying all of these.
+	Fields []FieldFilter
+	// After drops entries emitted at or before this time.
+	After time.Time
+}
+
+// StatusRange is an inclusive range of HTTP status codes.
+type StatusRange struct {
+	Min, Max int
+}
+
+// ParseStatusRange parses an HTTP status filter, which is either a status code
+// (404), a class of status codes (5xx) or an inclusive range (500-503).
+func ParseStatusRange(s string) (StatusRange, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+
+	if len(s) == 3 && strings.HasSuffix(s, "xx") && s[0] >= '1' && s[0] <= '5' {
+		class := int(s[0]-'0') * 100
+		return StatusRange{Min: class, Max: class + 99}, nil
+	}
+
+	from, to, isRange := strings.Cut(s, "-")
+
+	var (
+		r   StatusRange
+		err error
+	)
+	if r.Min, err = strconv.Atoi(from); err != nil {
+		return StatusRange{}, fmt.Errorf("invalid status filter %q", s)
+	}
+	r.Max = r.Min
+	if isRange {
+		if r.Max, err = strconv.Atoi(to); err != nil || r.Max < r.Min {
+			return StatusRange{}, fmt.Errorf("invalid status filter %q", s)
+		}
+	}
+
+	return r, nil
+}
+
+func (r StatusRange) contains(status int) bool {
+	return status >= r.Min && status <= r.Max
+}
+
+// FieldFilter matches a field of JSON log messages against a value.
+type FieldFilter struct {
+	Path   []string
+	Value  string
+	Negate bool
+}
+
+// ParseFieldFilter parses a field filter such as msg.user_id=42 or
+// msg.request.method!=GET. Fields are looked up in the log message decoded as
+// JSON, following the dotted path after the msg prefix.
+func ParseFieldFilter(s string) (FieldFilter, error) {
+	var f FieldFilter
+
+	key, value, ok := strings.Cut(s, "!=")
+	if ok {
+		f.Negate = true
+	} else if key, value, ok = strings.Cut(s, "="); !ok {
+		return f, fmt.Errorf("invalid field filter %q, expected msg.<field>=<value>", s)
+	}
+
+	path := strings.Split(strings.TrimSpace(key), ".")
+	if len(path) < 2 || path[0] != "msg" || hasEmptyKey(path) {
+		return f, fmt.Errorf("invalid field filter %q, fields must be given as msg.<field>", s)
+	}
+
+	f.Path = path[1:]
+	f.Value = strings.TrimSpace(value)
+	return f, nil
+}
+
+func hasEmptyKey(path []string) bool {
+	for _, key := range path {
+		if key == "" {
+			return true
+		}
+	}
+	return false
+}
+
+func (f FieldFilter) matches(msg map[string]interface{}) bool {
+	var value interface{} = msg
+	for _, key := range f.Path {
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			return f.Negate
+		}
+		if value, ok = obj[key]; !ok {
+			return f.Negate
+		}
+	}
+
+	return (fmt.Sprint(value) == f.Value) != f.Negate
+}
+
+// Matches reports whether the entry satisfies the filter.
+func (f *Filter) Matches(entry LogEntry) bool {
+	if f == nil {
+		return true
+	}
+
+	if len(f.Levels) > 0 && !containsFold(f.Levels, entry.Level) {
+		return false
+	}
+	if len(f.Instances) > 0 && !containsFold(f.Instances, entry.Instance) {
+		return false
+	}
+	if f.Grep != nil && !f.Grep.MatchString(entry.Message) {
+		return false
+	}
+	if f.Exclude != nil && f.Exclude.MatchString(entry.Message) {
+		return false
+	}
+
+	if !f.After.IsZero() {
+		if t, err := time.Parse(time.RFC3339Nano, entry.Timestamp); err == nil && !t.After(f.After) {
+			return false
+		}
+	}
+
+	if len(f.Statuses) > 0 {
+		status := entry.Meta.HTTP.Response.StatusCode
+		matched := false
+		for _, r := range f.Statuses {
+			if r.contains(status) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+
+	if len(f.Fields) > 0 {
+		msg, ok := decodeMessage(entry.Message)
+		if !ok {
+			return false
+		}
+		for _, field := range f.Fields {
+			if !field.matches(msg) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+func decodeMessage(message string) (map[string]interface{}, bool) {
+	message = strings.TrimSpace(message)
+	if !strings.HasPrefix(message, "{") {
+		return nil, false
+	}
+
+	var msg map[string]interface{}
+	dec := json.NewDecoder(bytes.NewBufferString(message))
+	dec.UseNumber()
+	if err := dec.Decode(&msg); err != nil {
+		return nil, false
+	}
+	return msg, true
+}
+
+func containsFold(values []string, s string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,80 @@
+package logs
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseStatusRange(t *testing.T) {
+	cases := map[string]StatusRange{
+		"404":     {Min: 404, Max: 404},
+		"5xx":     {Min: 500, Max: 599},
+		"2XX":     {Min: 200, Max: 299},
+		"500-503": {Min: 500, Max: 503},
+	}
+	for input, want := range cases {
+		got, err := ParseStatusRange(input)
+		require.NoError(t, err, input)
+		assert.Equal(t, want, got, input)
+	}
+
+	for _, input := range []string{"", "abc", "6xx", "503-500", "500-"} {
+		_, err := ParseStatusRange(input)
+		assert.Error(t, err, input)
+	}
+}
+
+func TestParseFieldFilter(t *testing.T) {
+	f, err := ParseFieldFilter("msg.user.id=42")
+	require.NoError(t, err)
+	assert.Equal(t, FieldFilter{Path: []string{"user", "id"}, Value: "42"}, f)
+
+	f, err = ParseFieldFilter("msg.method!=GET")
+	require.NoError(t, err)
+	assert.Equal(t, FieldFilter{Path: []string{"method"}, Value: "GET", Negate: true}, f)
+
+	for _, input := range []string{"msg.user_id", "user_id=42", "msg=42", "msg..id=42"} {
+		_, err := ParseFieldFilter(input)
+		assert.Error(t, err, input)
+	}
+}
+
+func TestFilterMatches(t *testing.T) {
+	var nilFilter *Filter
+	assert.True(t, nilFilter.Matches(LogEntry{Message: "anything"}))
+
+	entry := LogEntry{
+		Level:    "error",
+		Instance: "abc123",
+		Message:  `{"user_id": 42, "request": {"method": "POST"}}`,
+	}
+	entry.Meta.HTTP.Response.StatusCode = 502
+
+	userID, err := ParseFieldFilter("msg.user_id=42")
+	require.NoError(t, err)
+	notGet, err := ParseFieldFilter("msg.request.method!=GET")
+	require.NoError(t, err)
+	otherUser, err := ParseFieldFilter("msg.user_id=7")
+	require.NoError(t, err)
+
+	matching := &Filter{
+		Levels:    []string{"ERROR"},
+		Instances: []string{"abc123"},
+		Grep:      regexp.MustCompile(`user_id`),
+		Exclude:   regexp.MustCompile(`healthcheck`),
+		Statuses:  []StatusRange{{Min: 500, Max: 599}},
+		Fields:    []FieldFilter{userID, notGet},
+	}
+	assert.True(t, matching.Matches(entry))
+
+	assert.False(t, (&Filter{Levels: []string{"info"}}).Matches(entry))
+	assert.False(t, (&Filter{Instances: []string{"def456"}}).Matches(entry))
+	assert.False(t, (&Filter{Grep: regexp.MustCompile(`healthcheck`)}).Matches(entry))
+	assert.False(t, (&Filter{Exclude: regexp.MustCompile(`POST`)}).Matches(entry))
+	assert.False(t, (&Filter{Statuses: []StatusRange{{Min: 400, Max: 499}}}).Matches(entry))
+	assert.False(t, (&Filter{Fields: []FieldFilter{otherUser}}).Matches(entry))
+	assert.False(t, (&Filter{Fields: []FieldFilter{userID}}).Matches(LogEntry{Message: "not json"}))
+}
@@ -0,0 +1,132 @@
+package logs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/azazeal/pause"
+
+	"github.com/superfly/flyctl/api"
+)
+
+// historyGapTolerance is how long after since the first log entry fetched may
+// be before Fetch reports that the logs in between may be missing.
+const historyGapTolerance = time.Minute
+
+// HistoryGapError is returned by Fetch, once it has sent what it could fetch,
+// when the logs it sent may not go back to the start of the window: the API
+// returned none from the start of the window until First.
+type HistoryGapError struct {
+	App   string
+	Since time.Time
+	First time.Time
+}
+
+func (e *HistoryGapError) Error() string {
+	return fmt.Sprintf("no logs of %s were fetched between %s and %s; the API may not have returned them",
+		e.App, e.Since.Format(time.RFC3339), e.First.Format(time.RFC3339))
+}
+
+// Fetch sends the logs emitted between since and until, oldest first, and
+// returns once the whole window has been sent. A zero until fetches the logs up
+// to now.
+//
+// Pages follow each other forward in time from since. The API may not honor
+// the start of the window, though, in which case it returns the most recent
+// logs. Fetch tells when the first page starts well after since, or when a
+// later page goes back past it, and returns a *HistoryGapError then rather
+// than silently send less than the window.
+func Fetch(ctx context.Context, out chan<- LogEntry, client *api.Client, opts *LogOptions, since, until time.Time) error {
+	const (
+		minWait = time.Millisecond << 6
+		maxWait = minWait << 6
+	)
+
+	var (
+		errorCount int
+		token      string
+		waitFor    = minWait
+		first      time.Time // the earliest in the window on the first page
+		reached    bool      // whether the first page went back to since
+	)
+
+	gap := func() error {
+		if since.IsZero() || reached || first.IsZero() || first.Sub(since) <= historyGapTolerance {
+			return nil
+		}
+		return &HistoryGapError{App: opts.AppName, Since: since, First: first}
+	}
+
+	for {
+		entries, next, err := client.GetAppLogsSince(ctx, opts.AppName, since, token, opts.RegionCode, opts.VMID)
+		if err != nil {
+			switch errorCount++; {
+			case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+				return err
+			case api.IsNotAuthenticatedError(err), api.IsNotFoundError(err):
+				return err
+			case errorCount > 9:
+				return err
+			}
+
+			pause.For(ctx, waitFor)
+			waitFor = backoff(waitFor, maxWait)
+			continue
+		}
+		errorCount = 0
+		waitFor = minWait
+
+		for _, entry := range entries {
+			entry := LogEntry{
+				App:       opts.AppName,
+				Instance:  entry.Instance,
+				Level:     entry.Level,
+				Message:   entry.Message,
+				Region:    entry.Region,
+				Timestamp: entry.Timestamp,
+				Meta:      entry.Meta,
+			}
+
+			// Entries whose timestamp can't be parsed are kept rather than
+			// silently dropped from the window.
+			if t, err := time.Parse(time.RFC3339Nano, entry.Timestamp); err == nil {
+				if t.Before(since) {
+					if token != "" {
+						// the API isn't paging from since, so this page
+						// repeats logs sent already
+						if reached || first.IsZero() {
+							return nil
+						}
+						return &HistoryGapError{App: opts.AppName, Since: since, First: first}
+					}
+					reached = true
+					continue
+				}
+				if token == "" && (first.IsZero() || t.Before(first)) {
+					first = t
+				}
+				if !until.IsZero() && t.After(until) {
+					return gap()
+				}
+			}
+
+			if !opts.Filter.Matches(entry) {
+				continue
+			}
+
+			select {
+			case out <- entry:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+
+		// We've caught up with the present once a page comes back empty.
+		if len(entries) == 0 || next == "" || next == token {
+			return gap()
+		}
+		token = next
+	}
+}
@@ -0,0 +1,175 @@
+package logs
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/superfly/flyctl/api"
+)
+
+type logsPage struct {
+	timestamps []string
+	next       string
+}
+
+// fakeLogsAPI serves the pages by their token, the first one by the empty
+// token, and returns a client of it and the queries it got.
+func fakeLogsAPI(t *testing.T, pages map[string]logsPage) (*api.Client, func() []map[string]string) {
+	t.Helper()
+
+	var (
+		mu      sync.Mutex
+		queries []map[string]string
+	)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/v1/apps/my-app/logs", r.URL.Path)
+
+		query := map[string]string{}
+		for key := range r.URL.Query() {
+			query[key] = r.URL.Query().Get(key)
+		}
+
+		mu.Lock()
+		queries = append(queries, query)
+		mu.Unlock()
+
+		page := pages[query["next_token"]]
+
+		var res struct {
+			Data []map[string]interface{} `json:"data"`
+			Meta map[string]string        `json:"meta"`
+		}
+		res.Data = []map[string]interface{}{}
+		for _, ts := range page.timestamps {
+			res.Data = append(res.Data, map[string]interface{}{
+				"id":         ts,
+				"attributes": map[string]string{"timestamp": ts, "message": "at " + ts},
+			})
+		}
+		res.Meta = map[string]string{"next_token": page.next}
+
+		_ = json.NewEncoder(w).Encode(res)
+	}))
+	t.Cleanup(srv.Close)
+
+	api.SetBaseURL(srv.URL)
+	t.Cleanup(func() { api.SetBaseURL("") })
+
+	return api.NewClientFromOptions(api.ClientOptions{BaseURL: srv.URL}), func() []map[string]string {
+		mu.Lock()
+		defer mu.Unlock()
+
+		return queries
+	}
+}
+
+func fetchAll(t *testing.T, client *api.Client, since, until time.Time) ([]string, error) {
+	t.Helper()
+
+	out := make(chan LogEntry, 100)
+	err := Fetch(context.Background(), out, client, &LogOptions{AppName: "my-app"}, since, until)
+	close(out)
+
+	var timestamps []string
+	for entry := range out {
+		timestamps = append(timestamps, entry.Timestamp)
+	}
+
+	return timestamps, err
+}
+
+func TestFetchPaginates(t *testing.T) {
+	client, queries := fakeLogsAPI(t, map[string]logsPage{
+		"":   {timestamps: []string{"2023-06-01T11:59:59Z", "2023-06-01T12:00:00Z", "2023-06-01T12:00:01Z"}, next: "p2"},
+		"p2": {timestamps: []string{"2023-06-01T12:00:02Z", "2023-06-01T12:00:03Z"}, next: "p3"},
+		"p3": {timestamps: []string{"2023-06-01T12:00:04Z", "2023-06-01T12:00:05Z"}, next: "p4"},
+		"p4": {next: "p4"},
+	})
+
+	since := time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	timestamps, err := fetchAll(t, client, since, time.Time{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"2023-06-01T12:00:00Z",
+		"2023-06-01T12:00:01Z",
+		"2023-06-01T12:00:02Z",
+		"2023-06-01T12:00:03Z",
+		"2023-06-01T12:00:04Z",
+		"2023-06-01T12:00:05Z",
+	}, timestamps)
+
+	q := queries()
+	require.Len(t, q, 4)
+	assert.Equal(t, "2023-06-01T12:00:00Z", q[0]["start_time"])
+	assert.Equal(t, "p2", q[1]["next_token"])
+	assert.NotContains(t, q[1], "start_time")
+
+	// fetching stops past until
+	timestamps, err = fetchAll(t, client, since, since.Add(2*time.Second))
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"2023-06-01T12:00:00Z",
+		"2023-06-01T12:00:01Z",
+		"2023-06-01T12:00:02Z",
+	}, timestamps)
+	assert.Len(t, queries(), 6)
+}
+
+func TestFetchStopsWhenPagesGoBackPastSince(t *testing.T) {
+	// the API pages backwards in time, as it would if it ignored start_time
+	client, queries := fakeLogsAPI(t, map[string]logsPage{
+		"":   {timestamps: []string{"2023-06-01T12:00:04Z", "2023-06-01T12:00:05Z"}, next: "p2"},
+		"p2": {timestamps: []string{"2023-06-01T11:00:00Z", "2023-06-01T12:00:04Z"}, next: "p3"},
+		"p3": {timestamps: []string{"2023-06-01T12:00:04Z"}, next: "p2"},
+	})
+
+	since := time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	timestamps, err := fetchAll(t, client, since, time.Time{})
+	assert.Equal(t, []string{
+		"2023-06-01T12:00:04Z",
+		"2023-06-01T12:00:05Z",
+	}, timestamps)
+	assert.Len(t, queries(), 2)
+
+	var gap *HistoryGapError
+	require.ErrorAs(t, err, &gap)
+	assert.Equal(t, &HistoryGapError{App: "my-app", Since: since, First: since.Add(4 * time.Second)}, gap)
+}
+
+func TestFetchReportsHistoryGap(t *testing.T) {
+	// the API returns the most recent logs, as it would if it ignored
+	// start_time
+	client, _ := fakeLogsAPI(t, map[string]logsPage{
+		"":   {timestamps: []string{"2023-06-01T14:00:00Z", "2023-06-01T14:00:01Z"}, next: "p2"},
+		"p2": {next: "p2"},
+	})
+
+	since := time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	timestamps, err := fetchAll(t, client, since, time.Time{})
+	assert.Equal(t, []string{"2023-06-01T14:00:00Z", "2023-06-01T14:00:01Z"}, timestamps)
+
+	var gap *HistoryGapError
+	require.ErrorAs(t, err, &gap)
+	assert.Equal(t, since.Add(2*time.Hour), gap.First)
+	assert.EqualError(t, err, "no logs of my-app were fetched between 2023-06-01T12:00:00Z and 2023-06-01T14:00:00Z; the API may not have returned them")
+
+	// logs shortly after since are just the first ones of the window
+	_, err = fetchAll(t, client, since.Add(2*time.Hour-30*time.Second), time.Time{})
+	assert.NoError(t, err)
+
+	// without a start, there's no window to miss logs of
+	_, err = fetchAll(t, client, time.Time{}, time.Time{})
+	assert.NoError(t, err)
+}
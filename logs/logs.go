@@ -5,6 +5,9 @@ import (
 	"fmt"
 	"io"
 	"time"
+
+	"github.com/superfly/flyctl/api"
+	"github.com/superfly/flyctl/internal/logger"
 )
 
 type LogOptions struct {
@@ -14,6 +17,10 @@ type LogOptions struct {
 	AppName    string
 	VMID       string
 	RegionCode string
+
+	// Filter, when set, drops the entries it doesn't match before they are
+	// sent down the stream.
+	Filter *Filter
 }
 
 func (opts *LogOptions) toNatsSubject() (subject string) {
@@ -37,3 +44,18 @@ type LogStream interface {
 	Err() error
 	Stream(ctx context.Context, opts *LogOptions) <-chan LogEntry
 }
+
+// NewStream returns a LogStream backed by NATS, falling back to polling the API
+// when the WireGuard tunnel to NATS can't be established.
+func NewStream(ctx context.Context, apiClient *api.Client, opts *LogOptions) LogStream {
+	stream, err := NewNatsStream(ctx, apiClient, opts)
+	if err != nil {
+		logger := logger.FromContext(ctx)
+
+		logger.Debugf("could not connect to wireguard tunnel: %v\n", err)
+		logger.Debug("falling back to log polling...")
+
+		stream, _ = NewPollingStream(apiClient, opts)
+	}
+	return stream
+}
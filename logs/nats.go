@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net"
+	"sync"
 
 	"github.com/nats-io/nats.go"
 
@@ -14,7 +15,9 @@ import (
 )
 
 type natsLogStream struct {
-	nc  *nats.Conn
+	nc *nats.Conn
+
+	mu  sync.Mutex
 	err error
 }
 
@@ -24,21 +27,28 @@ func NewNatsStream(ctx context.Context, apiClient *api.Client, opts *LogOptions)
 		return nil, fmt.Errorf("failed fetching target app: %w", err)
 	}
 
+	return NewOrgNatsStream(ctx, apiClient, app.Organization.Slug)
+}
+
+// NewOrgNatsStream returns a LogStream that can stream the logs of any app of
+// the organization. Each call to Stream opens a new subscription over the same
+// connection.
+func NewOrgNatsStream(ctx context.Context, apiClient *api.Client, orgSlug string) (LogStream, error) {
 	agentclient, err := agent.Establish(ctx, apiClient)
 	if err != nil {
 		return nil, fmt.Errorf("failed establishing agent: %w", err)
 	}
 
-	dialer, err := agentclient.Dialer(ctx, app.Organization.Slug)
+	dialer, err := agentclient.Dialer(ctx, orgSlug)
 	if err != nil {
-		return nil, fmt.Errorf("failed establishing wireguard connection for %s organization: %w", app.Organization.Slug, err)
+		return nil, fmt.Errorf("failed establishing wireguard connection for %s organization: %w", orgSlug, err)
 	}
 
-	if err = agentclient.WaitForTunnel(ctx, app.Organization.Slug); err != nil {
+	if err = agentclient.WaitForTunnel(ctx, orgSlug); err != nil {
 		return nil, fmt.Errorf("failed connecting to WireGuard tunnel: %w", err)
 	}
 
-	nc, err := newNatsClient(ctx, dialer, app.Organization.Slug)
+	nc, err := newNatsClient(ctx, dialer, orgSlug)
 	if err != nil {
 		return nil, fmt.Errorf("failed creating nats connection: %w", err)
 	}
@@ -53,13 +63,20 @@ func (s *natsLogStream) Stream(ctx context.Context, opts *LogOptions) <-chan Log
 	go func() {
 		defer close(out)
 
-		s.err = fromNats(ctx, out, s.nc, opts)
+		if err := fromNats(ctx, out, s.nc, opts); err != nil {
+			s.mu.Lock()
+			s.err = err
+			s.mu.Unlock()
+		}
 	}()
 
 	return out
 }
 
 func (s *natsLogStream) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	return s.err
 }
 
@@ -99,9 +116,11 @@ func fromNats(ctx context.Context, out chan<- LogEntry, nc *nats.Conn, opts *Log
 	}
 	defer sub.Unsubscribe()
 
-	var log natsLog
 	for {
-		var msg *nats.Msg
+		var (
+			msg *nats.Msg
+			log natsLog
+		)
 		if msg, err = sub.NextMsgWithContext(ctx); err != nil {
 			break
 		}
@@ -112,7 +131,8 @@ func fromNats(ctx context.Context, out chan<- LogEntry, nc *nats.Conn, opts *Log
 			break
 		}
 
-		out <- LogEntry{
+		entry := LogEntry{
+			App:       opts.AppName,
 			Instance:  log.Fly.App.Instance,
 			Level:     log.Log.Level,
 			Message:   log.Message,
@@ -124,6 +144,10 @@ func fromNats(ctx context.Context, out chan<- LogEntry, nc *nats.Conn, opts *Log
 				Event:    struct{ Provider string }{log.Event.Provider},
 			},
 		}
+		entry.Meta.HTTP.Response.StatusCode = log.HTTP.Response.StatusCode
+		if opts.Filter.Matches(entry) {
+			out <- entry
+		}
 	}
 
 	return
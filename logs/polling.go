@@ -82,7 +82,8 @@ func Poll(ctx context.Context, out chan<- LogEntry, client *api.Client, opts *Lo
 		}
 
 		for _, entry := range entries {
-			out <- LogEntry{
+			entry := LogEntry{
+				App:       opts.AppName,
 				Instance:  entry.Instance,
 				Level:     entry.Level,
 				Message:   entry.Message,
@@ -90,6 +91,9 @@ func Poll(ctx context.Context, out chan<- LogEntry, client *api.Client, opts *Lo
 				Timestamp: entry.Timestamp,
 				Meta:      entry.Meta,
 			}
+			if opts.Filter.Matches(entry) {
+				out <- entry
+			}
 		}
 	}
 }
@@ -0,0 +1,288 @@
+package logs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/azazeal/pause"
+	"github.com/dustin/go-humanize"
+)
+
+// LogSink delivers log entries to a destination other than the terminal.
+// Implementations are safe for concurrent use.
+type LogSink interface {
+	// Write queues the entry for delivery. It blocks when the sink can't keep
+	// up, until there's room for the entry or ctx is done.
+	Write(ctx context.Context, entry LogEntry) error
+	// Close flushes the queued entries and releases the sink's resources.
+	Close(ctx context.Context) error
+}
+
+// NewSink returns the sink described by spec, which is one of:
+//
+//	file:<path>[?max-size=100MB&max-files=5]
+//	syslog+tcp://<host>:<port>, syslog+udp://<host>:<port>
+//	http://<url>, https://<url>
+//	loki+http://<host>:<port>, loki+https://<host>:<port>
+//
+// appName identifies the logs in destinations that expect it, for entries
+// that don't carry the name of their app. Remote sinks report entries they
+// drop to errOut.
+func NewSink(spec, appName string, errOut io.Writer) (LogSink, error) {
+	u, err := url.Parse(spec)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sink %q: %w", spec, err)
+	}
+
+	switch u.Scheme {
+	case "file":
+		path := u.Opaque
+		if path == "" {
+			path = u.Path
+		}
+		if path == "" {
+			return nil, fmt.Errorf("invalid sink %q: missing file path", spec)
+		}
+		maxSize, maxFiles, err := parseRotation(u.Query())
+		if err != nil {
+			return nil, fmt.Errorf("invalid sink %q: %w", spec, err)
+		}
+		return newFileSink(path, maxSize, maxFiles)
+	case "syslog+tcp", "syslog+udp":
+		if u.Host == "" {
+			return nil, fmt.Errorf("invalid sink %q: missing host", spec)
+		}
+		network := strings.TrimPrefix(u.Scheme, "syslog+")
+		return newBatchingSink(u.Redacted(), newSyslogWriter(network, u.Host, appName), errOut), nil
+	case "http", "https":
+		return newBatchingSink(u.Redacted(), newHTTPWriter(spec), errOut), nil
+	case "loki+http", "loki+https":
+		name := u.Redacted()
+		u.Scheme = strings.TrimPrefix(u.Scheme, "loki+")
+		if u.Path == "" || u.Path == "/" {
+			u.Path = "/loki/api/v1/push"
+		}
+		return newBatchingSink(name, newLokiWriter(u.String(), appName), errOut), nil
+	default:
+		return nil, fmt.Errorf("invalid sink %q: unsupported scheme %q", spec, u.Scheme)
+	}
+}
+
+func parseRotation(query url.Values) (maxSize int64, maxFiles int, err error) {
+	maxSize, maxFiles = 100*1000*1000, 5
+
+	if s := query.Get("max-size"); s != "" {
+		size, err := humanize.ParseBytes(s)
+		if err != nil {
+			return 0, 0, fmt.Errorf("invalid max-size: %w", err)
+		}
+		maxSize = int64(size)
+	}
+	if s := query.Get("max-files"); s != "" {
+		if maxFiles, err = strconv.Atoi(s); err != nil || maxFiles < 1 {
+			return 0, 0, fmt.Errorf("invalid max-files %q", s)
+		}
+	}
+
+	return maxSize, maxFiles, nil
+}
+
+// batchWriter sends batches of entries to a remote destination. It's only
+// ever called from a single goroutine. After an error, the next call is
+// expected to reconnect if needed. Errors retrying won't fix, like the
+// destination rejecting the batch, are wrapped in a permanentError.
+type batchWriter interface {
+	WriteBatch(ctx context.Context, entries []LogEntry) error
+	Close() error
+}
+
+const (
+	sinkQueueSize     = 1000
+	sinkBatchSize     = 100
+	sinkFlushInterval = time.Second
+	sinkMaxBackoff    = 30 * time.Second
+	sinkMaxAttempts   = 5
+)
+
+var errSinkClosed = errors.New("log sink is closed")
+
+// permanentError is an error sending a batch that retrying won't fix.
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+// batchingSink queues entries and hands them to its writer in batches,
+// retrying failed batches with backoff. Once the queue is full, Write blocks,
+// which slows down the stream feeding the sink rather than dropping logs.
+// Batches that still fail after sinkMaxAttempts, or that the destination
+// rejects, are dropped so that a misconfigured sink doesn't stall the stream.
+type batchingSink struct {
+	name   string
+	w      batchWriter
+	errOut io.Writer
+	queue  chan LogEntry
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	mu     sync.RWMutex
+	closed bool
+
+	// dropped counts the entries given up on. Only run touches it.
+	dropped int
+}
+
+func newBatchingSink(name string, w batchWriter, errOut io.Writer) *batchingSink {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	s := &batchingSink{
+		name:   name,
+		w:      w,
+		errOut: errOut,
+		queue:  make(chan LogEntry, sinkQueueSize),
+		ctx:    ctx,
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	go s.run()
+
+	return s
+}
+
+func (s *batchingSink) Write(ctx context.Context, entry LogEntry) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.closed {
+		return errSinkClosed
+	}
+
+	select {
+	case s.queue <- entry:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s *batchingSink) Close(ctx context.Context) error {
+	s.mu.Lock()
+	if !s.closed {
+		s.closed = true
+		close(s.queue)
+	}
+	s.mu.Unlock()
+
+	// Give the queued entries a chance to be flushed, then give up on them.
+	select {
+	case <-s.done:
+	case <-ctx.Done():
+		s.cancel()
+		<-s.done
+	}
+
+	if s.dropped > 0 {
+		fmt.Fprintf(s.errOut, "log sink %s dropped %d entries\n", s.name, s.dropped)
+	}
+
+	return s.w.Close()
+}
+
+func (s *batchingSink) run() {
+	defer close(s.done)
+
+	var (
+		batch = make([]LogEntry, 0, sinkBatchSize)
+		timer = time.NewTimer(sinkFlushInterval)
+	)
+	defer timer.Stop()
+
+	for {
+		select {
+		case entry, ok := <-s.queue:
+			if !ok {
+				s.flush(batch)
+				return
+			}
+			if batch = append(batch, entry); len(batch) < sinkBatchSize {
+				continue
+			}
+		case <-timer.C:
+		}
+
+		s.flush(batch)
+		batch = batch[:0]
+
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(sinkFlushInterval)
+	}
+}
+
+// flush sends the batch, retrying up to sinkMaxAttempts times unless the sink
+// is cancelled or the error is permanent. Batches that can't be sent are
+// dropped; the first time that happens, the error is reported.
+func (s *batchingSink) flush(batch []LogEntry) {
+	if len(batch) == 0 {
+		return
+	}
+
+	var (
+		err  error
+		perm *permanentError
+	)
+
+	wait := 100 * time.Millisecond
+	for attempt := 1; ; attempt++ {
+		if err = s.w.WriteBatch(s.ctx, batch); err == nil || s.ctx.Err() != nil {
+			return
+		}
+		if errors.As(err, &perm) || attempt == sinkMaxAttempts {
+			break
+		}
+		if pause.For(s.ctx, wait); s.ctx.Err() != nil {
+			return
+		}
+		wait = backoff(wait, sinkMaxBackoff)
+	}
+
+	if s.dropped == 0 {
+		fmt.Fprintf(s.errOut, "log sink %s: dropping %d entries: %v\n", s.name, len(batch), err)
+	}
+	s.dropped += len(batch)
+}
+
+// entryTime returns the time the entry was emitted, or now if its timestamp
+// can't be parsed.
+func entryTime(entry LogEntry) time.Time {
+	if t, err := time.Parse(time.RFC3339Nano, entry.Timestamp); err == nil {
+		return t
+	}
+	return time.Now()
+}
+
+func entryApp(entry LogEntry, appName string) string {
+	if entry.App != "" {
+		return entry.App
+	}
+	return appName
+}
@@ -0,0 +1,143 @@
+package logs
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// httpWriter POSTs batches of entries to an HTTP endpoint as a JSON array.
+type httpWriter struct {
+	url    string
+	client *http.Client
+}
+
+func newHTTPWriter(url string) *httpWriter {
+	return &httpWriter{
+		url:    url,
+		client: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+func (w *httpWriter) WriteBatch(ctx context.Context, entries []LogEntry) error {
+	body, err := json.Marshal(entries)
+	if err != nil {
+		return err
+	}
+	return postJSON(ctx, w.client, w.url, body)
+}
+
+func (w *httpWriter) Close() error {
+	return nil
+}
+
+// lokiWriter pushes batches of entries to Loki, labeling them with the app,
+// region, instance and level.
+type lokiWriter struct {
+	url     string
+	appName string
+	client  *http.Client
+}
+
+func newLokiWriter(url, appName string) *lokiWriter {
+	return &lokiWriter{
+		url:     url,
+		appName: appName,
+		client:  &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+type lokiPush struct {
+	Streams []lokiStream `json:"streams"`
+}
+
+type lokiStream struct {
+	Stream map[string]string `json:"stream"`
+	Values [][2]string       `json:"values"`
+}
+
+func (w *lokiWriter) WriteBatch(ctx context.Context, entries []LogEntry) error {
+	body, err := json.Marshal(lokiPayload(entries, w.appName))
+	if err != nil {
+		return err
+	}
+	return postJSON(ctx, w.client, w.url, body)
+}
+
+func (w *lokiWriter) Close() error {
+	return nil
+}
+
+// lokiPayload groups the entries into one Loki stream per set of labels.
+func lokiPayload(entries []LogEntry, appName string) lokiPush {
+	var (
+		streams = map[string]*lokiStream{}
+		keys    []string
+	)
+
+	for _, entry := range entries {
+		labels := map[string]string{
+			"app":      entryApp(entry, appName),
+			"region":   entry.Region,
+			"instance": entry.Instance,
+			"level":    entry.Level,
+		}
+		key := fmt.Sprint(labels)
+
+		stream, ok := streams[key]
+		if !ok {
+			stream = &lokiStream{Stream: labels}
+			streams[key] = stream
+			keys = append(keys, key)
+		}
+
+		ts := strconv.FormatInt(entryTime(entry).UnixNano(), 10)
+		stream.Values = append(stream.Values, [2]string{ts, entry.Message})
+	}
+
+	// Keep the output stable, mostly for the sake of tests.
+	sort.Strings(keys)
+
+	push := lokiPush{Streams: make([]lokiStream, 0, len(keys))}
+	for _, key := range keys {
+		push.Streams = append(push.Streams, *streams[key])
+	}
+	return push
+}
+
+func postJSON(ctx context.Context, client *http.Client, url string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send logs: %w", err)
+	}
+	defer res.Body.Close() // skipcq: GO-S2307
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		msg, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+		err := fmt.Errorf("failed to send logs: %s: %s", res.Status, bytes.TrimSpace(msg))
+
+		// Client errors mean the logs were rejected, and will be again, except
+		// for timeouts and rate limiting.
+		if res.StatusCode >= 400 && res.StatusCode < 500 &&
+			res.StatusCode != http.StatusRequestTimeout && res.StatusCode != http.StatusTooManyRequests {
+			err = &permanentError{err}
+		}
+
+		return err
+	}
+
+	_, _ = io.Copy(io.Discard, res.Body)
+	return nil
+}
@@ -0,0 +1,116 @@
+package logs
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+const syslogFacilityUser = 1
+
+// syslogWriter sends entries to a syslog server as RFC 5424 messages. Over
+// TCP, messages are framed with octet counting as described in RFC 6587.
+type syslogWriter struct {
+	network string
+	addr    string
+	appName string
+
+	dialer net.Dialer
+	conn   net.Conn
+}
+
+func newSyslogWriter(network, addr, appName string) *syslogWriter {
+	return &syslogWriter{
+		network: network,
+		addr:    addr,
+		appName: appName,
+		dialer:  net.Dialer{Timeout: 10 * time.Second},
+	}
+}
+
+func (w *syslogWriter) WriteBatch(ctx context.Context, entries []LogEntry) error {
+	if w.conn == nil {
+		conn, err := w.dialer.DialContext(ctx, w.network, w.addr)
+		if err != nil {
+			return fmt.Errorf("failed to connect to syslog server: %w", err)
+		}
+		w.conn = conn
+	}
+
+	var err error
+	if w.network == "udp" {
+		for _, entry := range entries {
+			if _, err = w.conn.Write(formatSyslog(entry, w.appName)); err != nil {
+				break
+			}
+		}
+	} else {
+		var buf bytes.Buffer
+		for _, entry := range entries {
+			msg := formatSyslog(entry, w.appName)
+			fmt.Fprintf(&buf, "%d ", len(msg))
+			buf.Write(msg)
+		}
+		_, err = w.conn.Write(buf.Bytes())
+	}
+
+	if err != nil {
+		// Reconnect on the next batch.
+		w.conn.Close()
+		w.conn = nil
+		return fmt.Errorf("failed to write to syslog server: %w", err)
+	}
+	return nil
+}
+
+func (w *syslogWriter) Close() error {
+	if w.conn == nil {
+		return nil
+	}
+	return w.conn.Close()
+}
+
+// formatSyslog formats the entry as an RFC 5424 message, using the instance
+// as the hostname.
+func formatSyslog(entry LogEntry, appName string) []byte {
+	return []byte(fmt.Sprintf("<%d>1 %s %s %s - - - %s",
+		syslogFacilityUser*8+syslogSeverity(entry.Level),
+		entryTime(entry).UTC().Format(time.RFC3339Nano),
+		syslogHeaderField(entry.Instance),
+		syslogHeaderField(entryApp(entry, appName)),
+		entry.Message,
+	))
+}
+
+func syslogSeverity(level string) int {
+	switch strings.ToLower(level) {
+	case "emerg", "emergency", "fatal", "panic":
+		return 0
+	case "alert":
+		return 1
+	case "crit", "critical":
+		return 2
+	case "err", "error":
+		return 3
+	case "warn", "warning":
+		return 4
+	case "notice":
+		return 5
+	case "debug", "trace":
+		return 7
+	default:
+		return 6
+	}
+}
+
+// syslogHeaderField returns a value usable as a header field, which can't be
+// empty or contain spaces.
+func syslogHeaderField(s string) string {
+	if s = strings.Join(strings.Fields(s), "_"); s == "" {
+		return "-"
+	}
+	return s
+}
@@ -0,0 +1,217 @@
+package logs
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewSink(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	for _, spec := range []string{
+		"file:" + filepath.Join(dir, "app.log") + "?max-size=10MB&max-files=2",
+		"syslog+tcp://localhost:514",
+		"syslog+udp://localhost:514",
+		"https://logs.example.com/ingest",
+		"loki+http://localhost:3100",
+	} {
+		sink, err := NewSink(spec, "my-app", io.Discard)
+		require.NoError(t, err, spec)
+		require.NoError(t, sink.Close(ctx), spec)
+	}
+
+	for _, spec := range []string{
+		"file:",
+		"file:app.log?max-files=0",
+		"syslog+tcp://",
+		"ftp://example.com",
+	} {
+		_, err := NewSink(spec, "my-app", io.Discard)
+		assert.Error(t, err, spec)
+	}
+}
+
+func TestFormatSyslog(t *testing.T) {
+	entry := LogEntry{
+		Level:     "error",
+		Instance:  "abc123",
+		Message:   "something broke",
+		Timestamp: "2023-06-01T12:00:00.5Z",
+	}
+
+	assert.Equal(t,
+		"<11>1 2023-06-01T12:00:00.5Z abc123 my-app - - - something broke",
+		string(formatSyslog(entry, "my-app")),
+	)
+
+	entry.Instance = ""
+	entry.Level = ""
+	assert.Equal(t,
+		"<14>1 2023-06-01T12:00:00.5Z - my-app - - - something broke",
+		string(formatSyslog(entry, "my-app")),
+	)
+}
+
+func TestLokiPayload(t *testing.T) {
+	entries := []LogEntry{
+		{Level: "info", Instance: "abc", Region: "ams", Message: "one", Timestamp: "2023-06-01T12:00:00Z"},
+		{Level: "error", Instance: "abc", Region: "ams", Message: "two", Timestamp: "2023-06-01T12:00:01Z"},
+		{Level: "info", Instance: "abc", Region: "ams", Message: "three", Timestamp: "2023-06-01T12:00:02Z"},
+	}
+
+	push := lokiPayload(entries, "my-app")
+	require.Len(t, push.Streams, 2)
+
+	assert.Equal(t, "error", push.Streams[0].Stream["level"])
+	assert.Equal(t, [][2]string{{"1685620801000000000", "two"}}, push.Streams[0].Values)
+
+	assert.Equal(t, map[string]string{"app": "my-app", "region": "ams", "instance": "abc", "level": "info"}, push.Streams[1].Stream)
+	assert.Equal(t, [][2]string{
+		{"1685620800000000000", "one"},
+		{"1685620802000000000", "three"},
+	}, push.Streams[1].Values)
+}
+
+func TestFileSinkRotation(t *testing.T) {
+	var (
+		ctx  = context.Background()
+		path = filepath.Join(t.TempDir(), "app.log")
+	)
+
+	sink, err := newFileSink(path, 600, 2)
+	require.NoError(t, err)
+
+	for i := 0; i < 10; i++ {
+		require.NoError(t, sink.Write(ctx, LogEntry{Message: strings.Repeat("x", 20)}))
+	}
+	require.NoError(t, sink.Close(ctx))
+
+	for _, name := range []string{path, path + ".1", path + ".2"} {
+		info, err := os.Stat(name)
+		require.NoError(t, err, name)
+		assert.LessOrEqual(t, info.Size(), int64(600), name)
+	}
+	_, err = os.Stat(path + ".3")
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestFileSinkRecoversFromFailedRotation(t *testing.T) {
+	var (
+		ctx   = context.Background()
+		path  = filepath.Join(t.TempDir(), "app.log")
+		entry = LogEntry{Message: strings.Repeat("x", 20)}
+	)
+
+	sink, err := newFileSink(path, 1, 1)
+	require.NoError(t, err)
+	defer sink.Close(ctx)
+
+	// app.log can't be renamed over a directory that isn't empty
+	require.NoError(t, os.MkdirAll(filepath.Join(path+".1", "busy"), 0o755))
+
+	require.NoError(t, sink.Write(ctx, entry))
+	assert.ErrorContains(t, sink.Write(ctx, entry), "failed to rotate log file")
+
+	require.NoError(t, os.RemoveAll(path+".1"))
+	require.NoError(t, sink.Write(ctx, entry))
+
+	rotated, err := os.ReadFile(path + ".1")
+	require.NoError(t, err)
+	assert.Equal(t, 1, strings.Count(string(rotated), "\n"))
+
+	current, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, 1, strings.Count(string(current), "\n"))
+}
+
+type recordingWriter struct {
+	mu      sync.Mutex
+	entries []LogEntry
+	fails   int
+}
+
+func (w *recordingWriter) WriteBatch(_ context.Context, entries []LogEntry) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.fails > 0 {
+		w.fails--
+		return assert.AnError
+	}
+	w.entries = append(w.entries, entries...)
+	return nil
+}
+
+func (w *recordingWriter) Close() error {
+	return nil
+}
+
+func TestBatchingSinkRetriesAndFlushesOnClose(t *testing.T) {
+	ctx := context.Background()
+	w := &recordingWriter{fails: 2}
+
+	sink := newBatchingSink("test", w, io.Discard)
+	for i := 0; i < sinkBatchSize+10; i++ {
+		require.NoError(t, sink.Write(ctx, LogEntry{Message: "hello"}))
+	}
+	require.NoError(t, sink.Close(ctx))
+
+	assert.Len(t, w.entries, sinkBatchSize+10)
+	assert.ErrorIs(t, sink.Write(ctx, LogEntry{}), errSinkClosed)
+}
+
+func TestBatchingSinkDropsAfterMaxAttempts(t *testing.T) {
+	ctx := context.Background()
+	w := &recordingWriter{fails: sinkMaxAttempts}
+
+	var errOut bytes.Buffer
+	sink := newBatchingSink("test", w, &errOut)
+	require.NoError(t, sink.Write(ctx, LogEntry{Message: "lost"}))
+	require.NoError(t, sink.Close(ctx))
+
+	assert.Empty(t, w.entries)
+	assert.Zero(t, w.fails)
+	assert.Equal(t, "log sink test: dropping 1 entries: "+assert.AnError.Error()+"\n"+
+		"log sink test dropped 1 entries\n", errOut.String())
+}
+
+func TestHTTPSinkDropsRejectedBatches(t *testing.T) {
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		http.Error(w, "bad label", http.StatusBadRequest)
+	}))
+	defer srv.Close()
+
+	ctx := context.Background()
+
+	var errOut bytes.Buffer
+	sink, err := NewSink("loki+"+srv.URL, "my-app", &errOut)
+	require.NoError(t, err)
+
+	for i := 0; i < 2*sinkBatchSize; i++ {
+		require.NoError(t, sink.Write(ctx, LogEntry{Message: "hello"}))
+	}
+	require.NoError(t, sink.Close(ctx))
+
+	// each batch is sent once, not retried
+	assert.Equal(t, int32(2), requests.Load())
+
+	lines := strings.Split(strings.TrimSpace(errOut.String()), "\n")
+	require.Len(t, lines, 2)
+	assert.Contains(t, lines[0], "dropping 100 entries: failed to send logs: 400 Bad Request: bad label")
+	assert.Contains(t, lines[1], "dropped 200 entries")
+}
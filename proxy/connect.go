@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"net"
 	"strconv"
+	"time"
 
 	"github.com/AlecAivazis/survey/v2"
 	"github.com/superfly/flyctl/agent"
@@ -21,11 +22,20 @@ type ConnectParams struct {
 	RemoteHost       string
 	PromptInstance   bool
 	DisableSpinner   bool
+
+	// UDP relays UDP datagrams rather than TCP connections. UDPIdleTimeout
+	// is how long flows are kept without traffic.
+	UDP            bool
+	UDPIdleTimeout time.Duration
 }
 
 // Binds to a local port and runs a proxy to a remote address over Wireguard.
 // Blocks until context is cancelled.
 func Connect(ctx context.Context, p *ConnectParams) (err error) {
+	if p.UDP {
+		return connectUDP(ctx, p)
+	}
+
 	server, err := NewServer(ctx, p)
 	if err != nil {
 		return err
@@ -34,6 +44,31 @@ func Connect(ctx context.Context, p *ConnectParams) (err error) {
 	return server.ProxyServer(ctx)
 }
 
+func connectUDP(ctx context.Context, p *ConnectParams) error {
+	io := iostreams.FromContext(ctx)
+
+	remoteAddr, err := RemoteAddr(ctx, p)
+	if err != nil {
+		return err
+	}
+
+	conn, err := ListenUDP(p.Ports[0])
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(io.Out, "Proxying local UDP port %s to remote %s\n", p.Ports[0], remoteAddr)
+
+	server := &UDPServer{
+		Addr:        remoteAddr,
+		Conn:        conn,
+		Dial:        p.Dialer.DialContext,
+		IdleTimeout: p.UDPIdleTimeout,
+	}
+
+	return server.ProxyUDP(ctx)
+}
+
 // Binds to a local port and then starts a goroutine to run a proxy to a remote
 // address over Wireguard. Proxy runs until context is cancelled.
 // Blocks only until local listener is bound and ready to accept connections.
@@ -52,11 +87,37 @@ func Start(ctx context.Context, p *ConnectParams) error {
 
 func NewServer(ctx context.Context, p *ConnectParams) (*Server, error) {
 	var (
-		io         = iostreams.FromContext(ctx)
+		io        = iostreams.FromContext(ctx)
+		localPort = p.Ports[0]
+	)
+
+	remoteAddr, err := RemoteAddr(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+
+	listener, err := Listen(localPort)
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Fprintf(io.Out, "Proxying local port %s to remote %s\n", localPort, remoteAddr)
+
+	return &Server{
+		Addr:     remoteAddr,
+		Listener: listener,
+		Dial:     p.Dialer.DialContext,
+	}, nil
+}
+
+// RemoteAddr returns the remote address connections should be proxied to,
+// prompting for the instance to use or waiting for the remote host to resolve
+// as requested.
+func RemoteAddr(ctx context.Context, p *ConnectParams) (string, error) {
+	var (
 		client     = client.FromContext(ctx).API()
 		orgSlug    = p.OrganizationSlug
-		localPort  = p.Ports[0]
-		remotePort = localPort
+		remotePort = p.Ports[0]
 		remoteAddr string
 	)
 
@@ -66,14 +127,14 @@ func NewServer(ctx context.Context, p *ConnectParams) (*Server, error) {
 
 	agentclient, err := agent.Establish(ctx, client)
 	if err != nil {
-		return nil, err
+		return "", err
 	}
 
 	// Prompt for a specific instance and set it as the remote target
 	if p.PromptInstance {
 		instance, err := selectInstance(ctx, p.OrganizationSlug, p.AppName, agentclient)
 		if err != nil {
-			return nil, err
+			return "", err
 		}
 
 		remoteAddr = fmt.Sprintf("[%s]:%s", instance, remotePort)
@@ -85,15 +146,19 @@ func NewServer(ctx context.Context, p *ConnectParams) (*Server, error) {
 		// entry to resolve
 		if !ip.IsV6(p.RemoteHost) {
 			if err := agentclient.WaitForDNS(ctx, p.Dialer, orgSlug, p.RemoteHost); err != nil {
-				return nil, fmt.Errorf("%s: %w", p.RemoteHost, err)
+				return "", fmt.Errorf("%s: %w", p.RemoteHost, err)
 			}
 		}
 
 		remoteAddr = fmt.Sprintf("[%s]:%s", p.RemoteHost, remotePort)
 	}
 
-	var listener net.Listener
+	return remoteAddr, nil
+}
 
+// Listen binds to the local port, on the loopback interface, or to the unix
+// socket at the path given instead.
+func Listen(localPort string) (net.Listener, error) {
 	if _, err := strconv.Atoi(localPort); err == nil {
 		// just numbers
 		addr, err := net.ResolveTCPAddr("tcp", fmt.Sprintf("127.0.0.1:%s", localPort))
@@ -101,30 +166,16 @@ func NewServer(ctx context.Context, p *ConnectParams) (*Server, error) {
 			return nil, err
 		}
 
-		listener, err = net.ListenTCP("tcp", addr)
-		if err != nil {
-			return nil, err
-		}
-	} else {
-		// probably a unix path
-		addr, err := net.ResolveUnixAddr("unix", localPort)
-		if err != nil {
-			return nil, err
-		}
-
-		listener, err = net.ListenUnix("unix", addr)
-		if err != nil {
-			return nil, err
-		}
+		return net.ListenTCP("tcp", addr)
 	}
 
-	fmt.Fprintf(io.Out, "Proxying local port %s to remote %s\n", localPort, remoteAddr)
+	// probably a unix path
+	addr, err := net.ResolveUnixAddr("unix", localPort)
+	if err != nil {
+		return nil, err
+	}
 
-	return &Server{
-		Addr:     remoteAddr,
-		Listener: listener,
-		Dial:     p.Dialer.DialContext,
-	}, nil
+	return net.ListenUnix("unix", addr)
 }
 
 func selectInstance(ctx context.Context, org, app string, c *agent.Client) (instance string, err error) {
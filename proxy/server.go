@@ -43,6 +43,8 @@ func (srv *Server) ProxyServer(ctx context.Context) error {
 					continue
 				}
 				terminal.Debug("Error accepting connection: ", err)
+
+				continue
 			}
 			terminal.Debug("accepted new connection from: ", source.RemoteAddr())
 
@@ -0,0 +1,309 @@
+package proxy
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/superfly/flyctl/terminal"
+)
+
+// SocksServer serves SOCKS5 and HTTP proxy requests received on Listener,
+// reaching the requested addresses with Dial. Both protocols share the
+// listener; the first byte a client sends tells them apart.
+//
+// Only the SOCKS5 CONNECT command, without authentication, is supported. Over
+// HTTP, CONNECT requests are tunneled and requests for absolute URLs are
+// forwarded.
+type SocksServer struct {
+	Listener net.Listener
+	Dial     func(ctx context.Context, network, addr string) (net.Conn, error)
+}
+
+// Serve serves proxy requests until ctx is cancelled.
+func (srv *SocksServer) Serve(ctx context.Context) error {
+	go func() {
+		<-ctx.Done()
+		_ = srv.Listener.Close()
+	}()
+
+	for {
+		conn, err := srv.Listener.Accept()
+		if err != nil {
+			if ctx.Err() != nil || errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+
+			terminal.Debug("Error accepting connection: ", err)
+
+			continue
+		}
+
+		go func() {
+			defer conn.Close() //skipcq: GO-S2307
+
+			if err := srv.serveConn(ctx, conn); err != nil {
+				terminal.Debug("proxy request from ", conn.RemoteAddr(), " failed: ", err)
+			}
+		}()
+	}
+}
+
+func (srv *SocksServer) serveConn(ctx context.Context, conn net.Conn) error {
+	br := bufio.NewReader(conn)
+
+	first, err := br.Peek(1)
+	if err != nil {
+		return err
+	}
+
+	if first[0] == socksVersion {
+		return srv.serveSocks(ctx, conn, br)
+	}
+
+	return srv.serveHTTP(ctx, conn, br)
+}
+
+const (
+	socksVersion = 5
+
+	socksNoAuth       = 0
+	socksNoAcceptable = 0xff
+
+	socksConnect = 1
+
+	socksIPv4   = 1
+	socksDomain = 3
+	socksIPv6   = 4
+
+	socksSucceeded           = 0
+	socksGeneralFailure      = 1
+	socksHostUnreachable     = 4
+	socksCommandNotSupported = 7
+	socksAddrNotSupported    = 8
+)
+
+func (srv *SocksServer) serveSocks(ctx context.Context, conn net.Conn, br *bufio.Reader) error {
+	// greeting: version, number of methods, methods
+	var greeting [2]byte
+	if _, err := io.ReadFull(br, greeting[:]); err != nil {
+		return err
+	}
+
+	methods := make([]byte, greeting[1])
+	if _, err := io.ReadFull(br, methods); err != nil {
+		return err
+	}
+
+	method := byte(socksNoAcceptable)
+	for _, m := range methods {
+		if m == socksNoAuth {
+			method = socksNoAuth
+		}
+	}
+
+	if _, err := conn.Write([]byte{socksVersion, method}); err != nil {
+		return err
+	}
+	if method == socksNoAcceptable {
+		return errors.New("socks: client requires authentication")
+	}
+
+	// request: version, command, reserved, address type, address, port
+	var req [4]byte
+	if _, err := io.ReadFull(br, req[:]); err != nil {
+		return err
+	}
+
+	var host string
+	switch req[3] {
+	case socksIPv4, socksIPv6:
+		ip := make(net.IP, 4)
+		if req[3] == socksIPv6 {
+			ip = make(net.IP, 16)
+		}
+		if _, err := io.ReadFull(br, ip); err != nil {
+			return err
+		}
+		host = ip.String()
+	case socksDomain:
+		l, err := br.ReadByte()
+		if err != nil {
+			return err
+		}
+		name := make([]byte, l)
+		if _, err := io.ReadFull(br, name); err != nil {
+			return err
+		}
+		host = string(name)
+	default:
+		_ = socksReply(conn, socksAddrNotSupported)
+
+		return fmt.Errorf("socks: unsupported address type %d", req[3])
+	}
+
+	var port [2]byte
+	if _, err := io.ReadFull(br, port[:]); err != nil {
+		return err
+	}
+
+	if req[1] != socksConnect {
+		_ = socksReply(conn, socksCommandNotSupported)
+
+		return fmt.Errorf("socks: unsupported command %d", req[1])
+	}
+
+	addr := net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(port[:]))))
+
+	target, err := srv.dial(ctx, addr)
+	if err != nil {
+		code := byte(socksGeneralFailure)
+
+		var dnsErr *net.DNSError
+		if errors.As(err, &dnsErr) {
+			code = socksHostUnreachable
+		}
+		_ = socksReply(conn, code)
+
+		return err
+	}
+	defer target.Close() //skipcq: GO-S2307
+
+	if err := socksReply(conn, socksSucceeded); err != nil {
+		return err
+	}
+
+	pipe(&bufferedConn{Conn: conn, r: br}, target)
+
+	return nil
+}
+
+// socksReply writes a reply with the given code. The bound address, which
+// clients of CONNECT don't need, is left unspecified.
+func socksReply(w io.Writer, code byte) error {
+	_, err := w.Write([]byte{socksVersion, code, 0, socksIPv4, 0, 0, 0, 0, 0, 0})
+	return err
+}
+
+func (srv *SocksServer) serveHTTP(ctx context.Context, conn net.Conn, br *bufio.Reader) error {
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, _, addr string) (net.Conn, error) {
+			return srv.dial(ctx, addr)
+		},
+	}
+	defer transport.CloseIdleConnections()
+
+	for {
+		req, err := http.ReadRequest(br)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				err = nil
+			}
+
+			return err
+		}
+
+		if req.Method == http.MethodConnect {
+			return srv.serveConnect(ctx, conn, br, req)
+		}
+
+		if req.URL.Host == "" {
+			return writeHTTPError(conn, http.StatusBadRequest, "not a proxy request")
+		}
+
+		// forward the request as if it came from us
+		req.RequestURI = ""
+		req.Header.Del("Proxy-Connection")
+		req.Header.Del("Proxy-Authorization")
+
+		res, err := transport.RoundTrip(req.WithContext(ctx))
+		if err != nil {
+			return writeHTTPError(conn, http.StatusBadGateway, err.Error())
+		}
+
+		err = res.Write(conn)
+		res.Body.Close() //skipcq: GO-S2307
+		if err != nil || req.Close || res.Close {
+			return err
+		}
+	}
+}
+
+func (srv *SocksServer) serveConnect(ctx context.Context, conn net.Conn, br *bufio.Reader, req *http.Request) error {
+	target, err := srv.dial(ctx, req.Host)
+	if err != nil {
+		_ = writeHTTPError(conn, http.StatusBadGateway, err.Error())
+
+		return err
+	}
+	defer target.Close() //skipcq: GO-S2307
+
+	if _, err := io.WriteString(conn, "HTTP/1.1 200 Connection established\r\n\r\n"); err != nil {
+		return err
+	}
+
+	pipe(&bufferedConn{Conn: conn, r: br}, target)
+
+	return nil
+}
+
+func (srv *SocksServer) dial(ctx context.Context, addr string) (net.Conn, error) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	return srv.Dial(ctx, "tcp", addr)
+}
+
+func writeHTTPError(w io.Writer, status int, msg string) error {
+	_, err := fmt.Fprintf(w, "HTTP/1.1 %d %s\r\nContent-Type: text/plain\r\nContent-Length: %d\r\nConnection: close\r\n\r\n%s\n",
+		status, http.StatusText(status), len(msg)+1, msg)
+	return err
+}
+
+// bufferedConn reads the bytes buffered while parsing the request before the
+// rest of the connection.
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *bufferedConn) Read(p []byte) (int, error) {
+	return c.r.Read(p)
+}
+
+func (c *bufferedConn) CloseWrite() error {
+	if conn, ok := c.Conn.(ClosableWrite); ok {
+		return conn.CloseWrite()
+	}
+
+	return c.Conn.Close()
+}
+
+// pipe copies between the connections until both directions are done.
+func pipe(a, b net.Conn) {
+	var wg sync.WaitGroup
+	wg.Add(2)
+
+	copyFunc := func(dst, src net.Conn) {
+		defer wg.Done()
+		_, _ = io.Copy(dst, src)
+
+		// close the write half if it exports a CloseWrite() method
+		if conn, ok := dst.(ClosableWrite); ok {
+			_ = conn.CloseWrite()
+		}
+	}
+
+	go copyFunc(a, b)
+	go copyFunc(b, a)
+
+	wg.Wait()
+}
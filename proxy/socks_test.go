@@ -0,0 +1,79 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	xproxy "golang.org/x/net/proxy"
+)
+
+func TestSocksServer(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "hello %s", r.URL.Path)
+	}))
+	defer backend.Close()
+
+	tlsBackend := httptest.NewTLSServer(backend.Config.Handler)
+	defer tlsBackend.Close()
+
+	// the names of the private network resolve to the backends
+	names := map[string]string{
+		"plain.internal:80": backend.Listener.Addr().String(),
+		"tls.internal:443":  tlsBackend.Listener.Addr().String(),
+	}
+
+	var d net.Dialer
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	srv := &SocksServer{
+		Listener: listener,
+		Dial: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			if mapped, ok := names[addr]; ok {
+				addr = mapped
+			}
+			return d.DialContext(ctx, network, addr)
+		},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = srv.Serve(ctx) }()
+
+	get := func(client *http.Client, url string) string {
+		res, err := client.Get(url)
+		require.NoError(t, err, url)
+		defer res.Body.Close()
+
+		body, err := io.ReadAll(res.Body)
+		require.NoError(t, err)
+		return string(body)
+	}
+
+	socks, err := xproxy.SOCKS5("tcp", listener.Addr().String(), nil, xproxy.Direct)
+	require.NoError(t, err)
+	socksClient := &http.Client{Transport: &http.Transport{
+		DialContext: socks.(xproxy.ContextDialer).DialContext,
+	}}
+	assert.Equal(t, "hello /socks", get(socksClient, "http://plain.internal/socks"))
+
+	proxyURL, err := url.Parse("http://" + listener.Addr().String())
+	require.NoError(t, err)
+
+	httpTransport := tlsBackend.Client().Transport.(*http.Transport).Clone()
+	httpTransport.Proxy = http.ProxyURL(proxyURL)
+	httpClient := &http.Client{Transport: httpTransport}
+	assert.Equal(t, "hello /forwarded", get(httpClient, "http://plain.internal/forwarded"))
+	assert.Equal(t, "hello /again", get(httpClient, "http://plain.internal/again"))
+
+	httpTransport.TLSClientConfig.ServerName = "example.com"
+	assert.Equal(t, "hello /connect", get(httpClient, "https://tls.internal/connect"))
+}
@@ -0,0 +1,206 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/superfly/flyctl/terminal"
+)
+
+// DefaultUDPIdleTimeout is how long UDP flows are kept without traffic.
+const DefaultUDPIdleTimeout = 2 * time.Minute
+
+// UDPServer relays the datagrams it receives on Conn to Addr. Every source
+// address gets a flow of its own, with its own connection to Addr, so that
+// replies are relayed back to the right source. Flows without traffic for
+// IdleTimeout are closed.
+type UDPServer struct {
+	Addr        string
+	Conn        net.PacketConn
+	Dial        func(ctx context.Context, network, addr string) (net.Conn, error)
+	IdleTimeout time.Duration
+
+	mu    sync.Mutex
+	flows map[string]*udpFlow
+}
+
+type udpFlow struct {
+	src      net.Addr
+	queue    chan []byte
+	lastSeen int64 // unix nanoseconds
+
+	cancel context.CancelFunc
+}
+
+func (f *udpFlow) touch() {
+	atomic.StoreInt64(&f.lastSeen, time.Now().UnixNano())
+}
+
+func (f *udpFlow) idleFor() time.Duration {
+	return time.Since(time.Unix(0, atomic.LoadInt64(&f.lastSeen)))
+}
+
+// ListenUDP binds to the local UDP port on the loopback interface.
+func ListenUDP(localPort string) (net.PacketConn, error) {
+	return net.ListenPacket("udp", net.JoinHostPort("127.0.0.1", localPort))
+}
+
+// ProxyUDP relays datagrams until ctx is cancelled.
+func (srv *UDPServer) ProxyUDP(ctx context.Context) error {
+	defer srv.Conn.Close() //skipcq: GO-S2307
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	if srv.IdleTimeout <= 0 {
+		srv.IdleTimeout = DefaultUDPIdleTimeout
+	}
+	srv.flows = make(map[string]*udpFlow)
+
+	go func() {
+		<-ctx.Done()
+		_ = srv.Conn.Close()
+	}()
+
+	go srv.expire(ctx)
+
+	buf := make([]byte, 64*1024)
+	for {
+		n, src, err := srv.Conn.ReadFrom(buf)
+		if err != nil {
+			if ctx.Err() != nil || errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+
+			terminal.Debug("Error reading datagram: ", err)
+
+			continue
+		}
+
+		datagram := make([]byte, n)
+		copy(datagram, buf[:n])
+
+		flow := srv.flowFor(ctx, src)
+		flow.touch()
+
+		select {
+		case flow.queue <- datagram:
+		default:
+			terminal.Debug("dropped datagram from ", src, ": flow is backed up")
+		}
+	}
+}
+
+// flowFor returns the flow of the source address, starting one if needed.
+func (srv *UDPServer) flowFor(ctx context.Context, src net.Addr) *udpFlow {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+
+	if flow, ok := srv.flows[src.String()]; ok {
+		return flow
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+
+	flow := &udpFlow{
+		src:    src,
+		queue:  make(chan []byte, 64),
+		cancel: cancel,
+	}
+	flow.touch()
+	srv.flows[src.String()] = flow
+
+	terminal.Debug("new UDP flow from: ", src)
+
+	go srv.relay(ctx, flow)
+
+	return flow
+}
+
+// relay dials the remote address for the flow and relays its datagrams until
+// the flow is closed or fails.
+func (srv *UDPServer) relay(ctx context.Context, flow *udpFlow) {
+	defer srv.close(flow)
+
+	target, err := srv.Dial(ctx, "udp", srv.Addr)
+	if err != nil {
+		terminal.Debug("failed to connect to target: ", err)
+
+		return
+	}
+	defer target.Close() //skipcq: GO-S2307
+
+	go func() {
+		<-ctx.Done()
+		_ = target.Close()
+	}()
+
+	go func() {
+		defer flow.cancel()
+
+		buf := make([]byte, 64*1024)
+		for {
+			n, err := target.Read(buf)
+			if err != nil {
+				return
+			}
+			flow.touch()
+
+			if _, err := srv.Conn.WriteTo(buf[:n], flow.src); err != nil {
+				terminal.Debug("failed relaying datagram to ", flow.src, ": ", err)
+			}
+		}
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case datagram := <-flow.queue:
+			if _, err := target.Write(datagram); err != nil {
+				terminal.Debug("failed relaying datagram from ", flow.src, ": ", err)
+
+				return
+			}
+		}
+	}
+}
+
+func (srv *UDPServer) close(flow *udpFlow) {
+	flow.cancel()
+
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+
+	if srv.flows[flow.src.String()] == flow {
+		delete(srv.flows, flow.src.String())
+	}
+
+	terminal.Debug("UDP flow closed: ", flow.src)
+}
+
+// expire closes the flows that have been idle for too long.
+func (srv *UDPServer) expire(ctx context.Context) {
+	ticker := time.NewTicker(srv.IdleTimeout / 4)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		srv.mu.Lock()
+		for _, flow := range srv.flows {
+			if flow.idleFor() >= srv.IdleTimeout {
+				flow.cancel()
+			}
+		}
+		srv.mu.Unlock()
+	}
+}
@@ -0,0 +1,77 @@
+package proxy
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUDPServer(t *testing.T) {
+	echo, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer echo.Close()
+
+	go func() {
+		buf := make([]byte, 1500)
+		for {
+			n, addr, err := echo.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			_, _ = echo.WriteTo(buf[:n], addr)
+		}
+	}()
+
+	conn, err := ListenUDP("0")
+	require.NoError(t, err)
+
+	var d net.Dialer
+	srv := &UDPServer{
+		Addr:        echo.LocalAddr().String(),
+		Conn:        conn,
+		Dial:        d.DialContext,
+		IdleTimeout: 200 * time.Millisecond,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go func() { _ = srv.ProxyUDP(ctx) }()
+
+	roundTrip := func(c net.Conn, msg string) string {
+		_, err := c.Write([]byte(msg))
+		require.NoError(t, err)
+
+		require.NoError(t, c.SetReadDeadline(time.Now().Add(2*time.Second)))
+		buf := make([]byte, 1500)
+		n, err := c.Read(buf)
+		require.NoError(t, err)
+		return string(buf[:n])
+	}
+
+	a, err := net.Dial("udp", conn.LocalAddr().String())
+	require.NoError(t, err)
+	defer a.Close()
+	b, err := net.Dial("udp", conn.LocalAddr().String())
+	require.NoError(t, err)
+	defer b.Close()
+
+	assert.Equal(t, "hello from a", roundTrip(a, "hello from a"))
+	assert.Equal(t, "hello from b", roundTrip(b, "hello from b"))
+
+	flows := func() int {
+		srv.mu.Lock()
+		defer srv.mu.Unlock()
+		return len(srv.flows)
+	}
+	assert.Equal(t, 2, flows())
+
+	assert.Eventually(t, func() bool { return flows() == 0 }, 2*time.Second, 20*time.Millisecond)
+
+	// Idle flows are started anew.
+	assert.Equal(t, "again", roundTrip(a, "again"))
+}
@@ -35,6 +35,9 @@ type SessionIO struct {
 
 	AllocPTY bool
 	TermEnv  string
+
+	// Recorder, when set, records what the session writes to the terminal.
+	Recorder *Recorder
 }
 
 func getFd(reader io.Reader) (fd int, ok bool) {
@@ -48,8 +51,8 @@ func getFd(reader io.Reader) (fd int, ok bool) {
 }
 
 func (s *SessionIO) attach(ctx context.Context, sess *ssh.Session, cmd string) error {
+	width, height := DefaultWidth, DefaultHeight
 	if s.AllocPTY {
-		width, height := DefaultWidth, DefaultHeight
 		if fd, ok := getFd(s.Stdin); ok {
 			state, err := term.MakeRaw(fd)
 			if err != nil {
@@ -66,7 +69,7 @@ func (s *SessionIO) attach(ctx context.Context, sess *ssh.Session, cmd string) e
 					return err
 				}
 
-				go watchWindowSize(ctx, fd, sess)
+				go watchWindowSize(ctx, fd, sess, s.Recorder)
 			}
 		}
 
@@ -75,6 +78,12 @@ func (s *SessionIO) attach(ctx context.Context, sess *ssh.Session, cmd string) e
 		}
 	}
 
+	if s.Recorder != nil {
+		if err := s.Recorder.begin(width, height, s.TermEnv); err != nil {
+			return err
+		}
+	}
+
 	var closeStdin sync.Once
 	stdin, err := sess.StdinPipe()
 	if err != nil {
@@ -103,11 +112,11 @@ func (s *SessionIO) attach(ctx context.Context, sess *ssh.Session, cmd string) e
 		}
 	}()
 	if s.Stdout != nil {
-		go io.Copy(s.Stdout, stdout)
+		go io.Copy(s.tee(s.Stdout), stdout)
 	}
 
 	if s.Stderr != nil {
-		go io.Copy(s.Stderr, stderr)
+		go io.Copy(s.tee(s.Stderr), stderr)
 	}
 
 	cmdC := make(chan error, 1)
@@ -130,3 +139,12 @@ func (s *SessionIO) attach(ctx context.Context, sess *ssh.Session, cmd string) e
 		return errors.New("session forcibly closed; the remote process may still be running")
 	}
 }
+
+// tee has what's written to w recorded too, when the session's recorded.
+func (s *SessionIO) tee(w io.Writer) io.Writer {
+	if s.Recorder == nil {
+		return w
+	}
+
+	return io.MultiWriter(w, s.Recorder)
+}
@@ -0,0 +1,226 @@
+package ssh
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// Recorder records what a session writes to the terminal, and how the
+// terminal's resized, as an asciicast v2 recording. See
+// https://docs.asciinema.org/manual/asciicast/v2/.
+type Recorder struct {
+	mu sync.Mutex
+
+	w     *bufio.Writer
+	title string
+
+	start   time.Time
+	pending []byte
+
+	// err is the first error writing the recording failed with. Recording
+	// stops at it, but the session goes on.
+	err error
+}
+
+// NewRecorder returns a Recorder that writes the recording to w.
+func NewRecorder(w io.Writer, title string) *Recorder {
+	return &Recorder{
+		w:     bufio.NewWriter(w),
+		title: title,
+	}
+}
+
+type castHeader struct {
+	Version   int               `json:"version"`
+	Width     int               `json:"width"`
+	Height    int               `json:"height"`
+	Timestamp int64             `json:"timestamp"`
+	Title     string            `json:"title,omitempty"`
+	Env       map[string]string `json:"env,omitempty"`
+}
+
+// begin writes the header of the recording of a terminal of the given size.
+func (r *Recorder) begin(width, height int, term string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.start = time.Now()
+
+	header := castHeader{
+		Version:   2,
+		Width:     width,
+		Height:    height,
+		Timestamp: r.start.Unix(),
+		Title:     r.title,
+		Env:       map[string]string{"TERM": term},
+	}
+
+	if err := json.NewEncoder(r.w).Encode(header); err != nil {
+		return err
+	}
+
+	return r.w.Flush()
+}
+
+// Write records p as output. It doesn't fail, so that recording errors don't
+// interrupt the session; Close reports them.
+func (r *Recorder) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	data := append(r.pending, p...)
+
+	// hold back a trailing partial UTF-8 sequence for the next write, since
+	// events carry strings
+	n := len(data)
+	for i := 1; i < utf8.UTFMax && i <= n; i++ {
+		if utf8.RuneStart(data[n-i]) {
+			if !utf8.FullRune(data[n-i:]) {
+				n -= i
+			}
+
+			break
+		}
+	}
+	r.pending = append([]byte(nil), data[n:]...)
+
+	if n > 0 {
+		r.event("o", string(data[:n]))
+	}
+
+	return len(p), nil
+}
+
+// resize records the terminal's new size.
+func (r *Recorder) resize(width, height int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.event("r", fmt.Sprintf("%dx%d", width, height))
+}
+
+func (r *Recorder) event(kind, data string) {
+	if r.err != nil {
+		return
+	}
+
+	elapsed := time.Since(r.start).Seconds()
+
+	line, err := json.Marshal([]interface{}{elapsed, kind, data})
+	if err == nil {
+		_, err = r.w.Write(append(line, '\n'))
+	}
+	if err == nil {
+		err = r.w.Flush()
+	}
+
+	r.err = err
+}
+
+// Close records what's pending and returns the first error recording failed
+// with. It doesn't close the underlying writer.
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(r.pending) > 0 {
+		r.event("o", string(r.pending))
+		r.pending = nil
+	}
+
+	return r.err
+}
+
+// ReplayOptions tune Replay.
+type ReplayOptions struct {
+	// Speed multiplies the speed of the replay. Zero means 1.
+	Speed float64
+
+	// IdleLimit caps the pauses between events, when set.
+	IdleLimit time.Duration
+}
+
+// Replay plays the asciicast v2 recording r back to w in real time, or as the
+// options have it, until it ends or ctx is done.
+func Replay(ctx context.Context, r io.Reader, w io.Writer, opts ReplayOptions) error {
+	speed := opts.Speed
+	if speed <= 0 {
+		speed = 1
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	if !scanner.Scan() {
+		if err := scanner.Err(); err != nil {
+			return err
+		}
+
+		return errors.New("empty recording")
+	}
+
+	var header castHeader
+	if err := json.Unmarshal(scanner.Bytes(), &header); err != nil {
+		return fmt.Errorf("invalid recording header: %w", err)
+	}
+	if header.Version != 2 {
+		return fmt.Errorf("unsupported asciicast version %d", header.Version)
+	}
+
+	var (
+		start = time.Now()
+		last  float64
+		skew  time.Duration
+	)
+
+	for line := 2; scanner.Scan(); line++ {
+		var event []interface{}
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			return fmt.Errorf("invalid event on line %d: %w", line, err)
+		}
+		if len(event) != 3 {
+			return fmt.Errorf("invalid event on line %d", line)
+		}
+
+		at, ok1 := event[0].(float64)
+		kind, ok2 := event[1].(string)
+		data, ok3 := event[2].(string)
+		if !ok1 || !ok2 || !ok3 {
+			return fmt.Errorf("invalid event on line %d", line)
+		}
+
+		// pauses beyond the idle limit are cut out of the timeline
+		if pause := time.Duration((at - last) * float64(time.Second)); opts.IdleLimit > 0 && pause > opts.IdleLimit {
+			skew += pause - opts.IdleLimit
+		}
+		last = at
+
+		due := start.Add(time.Duration(float64(time.Duration(at*float64(time.Second))-skew) / speed))
+
+		timer := time.NewTimer(time.Until(due))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+
+			return ctx.Err()
+		case <-timer.C:
+		}
+
+		if kind != "o" {
+			continue // resizes and input don't replay
+		}
+
+		if _, err := io.WriteString(w, data); err != nil {
+			return err
+		}
+	}
+
+	return scanner.Err()
+}
@@ -0,0 +1,43 @@
+package ssh
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecordReplay(t *testing.T) {
+	var cast bytes.Buffer
+
+	rec := NewRecorder(&cast, "test")
+	require.NoError(t, rec.begin(80, 24, "xterm"))
+
+	// "é" split across writes
+	out := []byte("$ echo café\r\ncafé\r\n")
+	split := bytes.Index(out, []byte("é")) + 1
+
+	_, _ = rec.Write(out[:split])
+	rec.resize(100, 30)
+	_, _ = rec.Write(out[split:])
+	require.NoError(t, rec.Close())
+
+	lines := strings.Split(strings.TrimSpace(cast.String()), "\n")
+	require.Len(t, lines, 4)
+
+	var header castHeader
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &header))
+	assert.Equal(t, 2, header.Version)
+	assert.Equal(t, 80, header.Width)
+	assert.Equal(t, "test", header.Title)
+
+	assert.Contains(t, lines[2], `"r","100x30"`)
+
+	var replayed bytes.Buffer
+	require.NoError(t, Replay(context.Background(), &cast, &replayed, ReplayOptions{Speed: 1000}))
+	assert.Equal(t, string(out), replayed.String())
+}
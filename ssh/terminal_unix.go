@@ -13,7 +13,7 @@ import (
 	"golang.org/x/term"
 )
 
-func watchWindowSize(ctx context.Context, fd int, sess *ssh.Session) error {
+func watchWindowSize(ctx context.Context, fd int, sess *ssh.Session, rec *Recorder) error {
 	sigc := make(chan os.Signal, 1)
 	signal.Notify(sigc, syscall.SIGWINCH)
 
@@ -32,5 +32,9 @@ func watchWindowSize(ctx context.Context, fd int, sess *ssh.Session) error {
 		if err := sess.WindowChange(height, width); err != nil {
 			return err
 		}
+
+		if rec != nil {
+			rec.resize(width, height)
+		}
 	}
 }
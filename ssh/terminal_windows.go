@@ -9,7 +9,7 @@ import (
 	"golang.org/x/crypto/ssh"
 )
 
-func watchWindowSize(ctx context.Context, fd int, sess *ssh.Session) error {
+func watchWindowSize(ctx context.Context, fd int, sess *ssh.Session, rec *Recorder) error {
 	// TODO: SIGWINCH for windows?
 	return nil
 }
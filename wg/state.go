@@ -17,6 +17,11 @@ type WireGuardState struct {
 	LocalPrivate string                   `json:"localpublic"`
 	DNS          string                   `json:"dns"`
 	Peer         api.CreatedWireGuardPeer `json:"peer"`
+
+	// Fallbacks are peers of the same organization in other gateway
+	// regions, which the agent fails over to when this one stops
+	// handshaking.
+	Fallbacks []*WireGuardState `json:"fallbacks,omitempty"`
 }
 
 // BUG(tqbf): Obviously all this needs to go, and I should just
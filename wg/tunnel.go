@@ -4,10 +4,15 @@ import (
 	"bufio"
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"math/rand"
 	"net"
 	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/miekg/dns"
 	"golang.zx2c4.com/wireguard/conn"
@@ -26,6 +31,10 @@ type Tunnel struct {
 
 	wscancel func()
 	resolv   *net.Resolver
+
+	mu        sync.Mutex // guards dev and the endpoints
+	endpoints []string   // the addresses of the peer's endpoint, in the order they're tried
+	endpoint  int        // the index of the address in use
 }
 
 func Connect(ctx context.Context, state *WireGuardState) (*Tunnel, error) {
@@ -68,10 +77,15 @@ func doConnect(ctx context.Context, state *WireGuardState, wswg bool) (*Tunnel,
 		return nil, err
 	}
 
-	endpointIP := endpointIPs[rand.Intn(len(endpointIPs))]
-	endpointAddr := net.JoinHostPort(endpointIP.String(), endpointPort)
+	endpoints := make([]string, 0, len(endpointIPs))
+	for _, i := range rand.Perm(len(endpointIPs)) {
+		endpoints = append(endpoints, net.JoinHostPort(endpointIPs[i].String(), endpointPort))
+	}
+	endpointAddr := endpoints[0]
 
 	if wswg {
+		endpoints = nil // the websocket relay is the only endpoint
+
 		port, err := websocketConnect(ctx, endpointHost)
 		if err != nil {
 			return nil, err
@@ -102,6 +116,8 @@ func doConnect(ctx context.Context, state *WireGuardState, wswg bool) (*Tunnel,
 		Config: cfg,
 		State:  state,
 
+		endpoints: endpoints,
+
 		resolv: &net.Resolver{
 			PreferGo: true,
 			Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
@@ -118,14 +134,65 @@ func (t *Tunnel) Close() error {
 		t.wscancel = nil
 	}
 
-	if t.dev != nil {
-		t.dev.Close()
+	// the agent checks the health of tunnels while it replaces them
+	t.mu.Lock()
+	dev := t.dev
+	t.dev, t.net, t.tun = nil, nil, nil
+	t.mu.Unlock()
+
+	if dev != nil {
+		dev.Close()
 	}
 
-	t.dev, t.net, t.tun = nil, nil, nil
 	return nil
 }
 
+// NextEndpoint switches the tunnel to the next address the endpoint of its
+// peer resolved to. It reports false once every address has been tried.
+func (t *Tunnel) NextEndpoint() (string, bool, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.dev == nil || t.endpoint+1 >= len(t.endpoints) {
+		return "", false, nil
+	}
+	t.endpoint++
+
+	endpoint := t.endpoints[t.endpoint]
+	ipc := fmt.Sprintf("public_key=%s\nupdate_only=true\nendpoint=%s\n", t.Config.RemotePublicKey.ToHex(), endpoint)
+
+	if err := t.dev.IpcSet(ipc); err != nil {
+		return "", true, fmt.Errorf("failed switching to endpoint %s: %w", endpoint, err)
+	}
+
+	return endpoint, true, nil
+}
+
+// AwaitHandshake waits for a handshake with the peer to complete after since
+// and returns how long after since it completed. The handshake happens when
+// traffic needs one, so callers should send some.
+func (t *Tunnel) AwaitHandshake(ctx context.Context, since time.Time) (time.Duration, error) {
+	ticker := time.NewTicker(50 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		stats, err := t.Stats()
+		if err != nil {
+			return 0, err
+		}
+
+		if stats.LastHandshake.After(since) {
+			return stats.LastHandshake.Sub(since), nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
 func (t *Tunnel) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
 	return t.net.DialContext(ctx, network, addr)
 }
@@ -210,3 +277,60 @@ func (t *Tunnel) queryDNS(ctx context.Context, msg *dns.Msg) (*dns.Msg, error) {
 	r, _, err := client.ExchangeWithConn(msg, conn)
 	return r, err
 }
+
+// PeerStats are the statistics WireGuard keeps for the peer of a tunnel.
+type PeerStats struct {
+	Endpoint      string
+	LastHandshake time.Time
+	RxBytes       uint64
+	TxBytes       uint64
+}
+
+// Stats returns the statistics of the tunnel's peer.
+func (t *Tunnel) Stats() (*PeerStats, error) {
+	t.mu.Lock()
+	dev := t.dev
+	t.mu.Unlock()
+
+	if dev == nil {
+		return nil, errors.New("tunnel closed")
+	}
+
+	ipc, err := dev.IpcGet()
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		stats PeerStats
+		sec   int64
+		nsec  int64
+	)
+
+	scanner := bufio.NewScanner(strings.NewReader(ipc))
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), "=")
+		if !ok {
+			continue
+		}
+
+		switch key {
+		case "endpoint":
+			stats.Endpoint = value
+		case "rx_bytes":
+			stats.RxBytes, _ = strconv.ParseUint(value, 10, 64)
+		case "tx_bytes":
+			stats.TxBytes, _ = strconv.ParseUint(value, 10, 64)
+		case "last_handshake_time_sec":
+			sec, _ = strconv.ParseInt(value, 10, 64)
+		case "last_handshake_time_nsec":
+			nsec, _ = strconv.ParseInt(value, 10, 64)
+		}
+	}
+
+	if sec != 0 || nsec != 0 {
+		stats.LastHandshake = time.Unix(sec, nsec)
+	}
+
+	return &stats, scanner.Err()
+}